@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"syscall"
+
+	"github.com/histrio/rssbook/pkg/daemon"
+	"github.com/histrio/rssbook/pkg/manifest"
+	"github.com/histrio/rssbook/pkg/rssbook"
+	"github.com/histrio/rssbook/pkg/utils"
+)
+
+// requestArgs returns build flags overriding defaults for the request
+func requestArgs(req daemon.Request) []string {
+	args := []string{}
+	if req.Name != "" {
+		args = append(args, "-name", req.Name)
+	}
+	if req.Title != "" {
+		args = append(args, "-title", req.Title)
+	}
+	if req.Author != "" {
+		args = append(args, "-author", req.Author)
+	}
+	if req.SeriesIndex > 0 {
+		args = append(args, "-series-index", strconv.Itoa(req.SeriesIndex))
+	}
+	if req.Schedule != "" {
+		args = append(args, "-schedule", req.Schedule)
+	}
+	if req.Order != "" {
+		args = append(args, "-order", req.Order)
+	}
+	if req.Loudnorm != "" {
+		args = append(args, "-loudnorm", req.Loudnorm)
+	}
+	if req.LUFS != 0 {
+		args = append(args, "-lufs", strconv.FormatFloat(req.LUFS, 'g', -1, 64))
+	}
+	if req.TruePeak != 0 {
+		args = append(args, "-true-peak", strconv.FormatFloat(req.TruePeak, 'g', -1, 64))
+	}
+	if req.Update {
+		args = append(args, "-update")
+	}
+	return args
+}
+
+// daemonCommand runs conversions submitted over a JSON HTTP API
+func daemonCommand(args []string) {
+	fs := flag.NewFlagSet("daemon", flag.ExitOnError)
+	var addr string
+	var dst string
+	var jobsDir string
+	var sources string
+	var concurrency int
+	fs.StringVar(&addr, "addr", "127.0.0.1:8081", "Address to listen on")
+	fs.StringVar(&dst, "dst", "", "Library to build books into")
+	fs.StringVar(&jobsDir, "jobs", "", "Directory keeping jobs and their logs. By default it is .rssbook-jobs in the library.")
+	fs.StringVar(&sources, "sources", "", "Accept sources inside this directory only")
+	fs.IntVar(&concurrency, "concurrency", 1, "How many books are built at once")
+	var lo logOptions
+	lo.register(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: rssbookcli daemon [flags] [build flags]")
+		fmt.Fprintln(fs.Output(), "Build flags, e.g. -tz Europe/Berlin, are passed to every build. Requests override them.")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	lo.apply(os.Stderr)
+	buildArgs := fs.Args()
+
+	var err error
+	if dst == "" {
+		dst, err = os.Getwd()
+		utils.Check(err)
+		logger.Warning("No destination specified, the current directory is used", "dst", dst)
+	}
+	if jobsDir == "" {
+		jobsDir = filepath.Join(dst, ".rssbook-jobs")
+	}
+	store, err := daemon.OpenStore(jobsDir)
+	if err != nil {
+		logger.Fatal("Opening jobs failed", "err", err)
+	}
+	exe, err := os.Executable()
+	utils.Check(err)
+
+	build := func(ctx context.Context, req daemon.Request, log io.Writer) (daemon.Result, error) {
+		args := append(append([]string{"-dst", dst}, lo.args()...), buildArgs...)
+		args = append(append(args, requestArgs(req)...), req.Source)
+		cmd := exec.CommandContext(ctx, exe, args...)
+		cmd.Stdout = log
+		cmd.Stderr = log
+		if err := cmd.Run(); err != nil {
+			return daemon.Result{}, err
+		}
+		bookID := req.Name
+		if bookID == "" {
+			bookID = rssbook.DefaultID(req.Source)
+		}
+		dir := filepath.Join(dst, bookID)
+		m, err := manifest.Read(dir)
+		if err != nil {
+			return daemon.Result{}, err
+		}
+		return daemon.Result{
+			BookID:   bookID,
+			Dir:      dir,
+			Feed:     filepath.Join(dir, bookID+".xml"),
+			Episodes: len(m.Book.Episodes),
+		}, nil
+	}
+
+	d := daemon.New(store, concurrency, build)
+	d.Log = logger
+	d.Start()
+	srv := &http.Server{Addr: addr, Handler: &daemon.API{Daemon: d, SourceRoot: sources}}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		logger.Info("Stopping, running jobs are queued again")
+		srv.Shutdown(context.Background())
+	}()
+
+	logger.Info("Listening", "addr", addr, "dst", dst)
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		logger.Fatal("Serving failed", "err", err)
+	}
+	d.Stop()
+}
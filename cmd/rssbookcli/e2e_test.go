@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/histrio/rssbook/pkg/audio"
+	"github.com/histrio/rssbook/pkg/audio/audiotest"
+	"github.com/histrio/rssbook/pkg/manifest"
+	"github.com/histrio/rssbook/pkg/probe"
+	"github.com/histrio/rssbook/pkg/progress"
+	"github.com/histrio/rssbook/pkg/rss"
+	"github.com/histrio/rssbook/pkg/utils"
+)
+
+// runMainEnv makes the test binary run main instead of tests, so end-to-end
+// tests run the command as users do
+const runMainEnv = "RSSBOOKCLI_TEST_MAIN"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(runMainEnv) == "1" {
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// rssbookcli runs the command with the arguments and returns its stdout
+func rssbookcli(t *testing.T, args ...string) []byte {
+	t.Helper()
+	cmd := exec.Command(os.Args[0], args...)
+	cmd.Env = append(os.Environ(), runMainEnv+"=1")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("rssbookcli %s: %s\n%s", strings.Join(args, " "), err, stderr.String())
+	}
+	return stdout.Bytes()
+}
+
+func TestEndToEnd(t *testing.T) {
+	if testing.Short() || !audiotest.Available() {
+		t.Skip("ffmpeg is not available")
+	}
+	src := filepath.Join(t.TempDir(), "Test Book")
+	fixtures := []audiotest.Fixture{}
+	for i := 1; i <= 3; i++ {
+		fixtures = append(fixtures, audiotest.Fixture{
+			Name:     fmt.Sprintf("%02d.mp3", i),
+			Segments: audiotest.Tones(4*time.Minute, 20*time.Second, time.Second),
+			Tags: map[string]string{
+				"title":  "Test Book",
+				"artist": "Test Author",
+				"track":  fmt.Sprint(i),
+			},
+			Cover: i == 1,
+		})
+	}
+	if _, err := audiotest.Book(src, fixtures...); err != nil {
+		t.Fatal(err)
+	}
+	dst := t.TempDir()
+
+	stdout := rssbookcli(t, "-dst", dst, "-progress", "json", src)
+
+	dir := filepath.Join(dst, "test-book")
+	m, err := manifest.Read(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	book := m.Book
+	// 12 minutes split by 8 minutes episodes
+	if len(book.Episodes) != 2 {
+		t.Fatalf("%d episodes, want 2", len(book.Episodes))
+	}
+	if book.Title != "Test Book" {
+		t.Errorf("title = %q, want Test Book", book.Title)
+	}
+	if book.Author != "Test Author" {
+		t.Errorf("author = %q, want Test Author", book.Author)
+	}
+
+	total := time.Duration(0)
+	p := audio.Pipeline{}
+	for i, ep := range book.Episodes {
+		file := filepath.Join(dir, ep.File)
+		if ep.File != fmt.Sprintf("episode-%03d.mp3", i+1) {
+			t.Errorf("episode %d file = %s", i+1, ep.File)
+		}
+		if m.Files[ep.File] == "" {
+			t.Errorf("%s: no checksum in the manifest", ep.File)
+		}
+		if d, err := p.GetDuration(utils.FileName(file)); err != nil || math.Abs((d-ep.Duration).Seconds()) > 1 {
+			t.Errorf("%s: duration = %v, %v, manifest says %v", ep.File, d, err, ep.Duration)
+		}
+		total += ep.Duration
+	}
+	// Splits are aligned to silences within two minutes
+	if first := book.Episodes[0].Duration; math.Abs((first - 8*time.Minute).Seconds()) > 120 {
+		t.Errorf("first episode lasts %v", first)
+	}
+	if math.Abs((total - 12*time.Minute).Seconds()) > 3 {
+		t.Errorf("episodes last %v, want 12m", total)
+	}
+
+	feed, err := rss.ParseFile(filepath.Join(dir, "test-book.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if feed.Channel.Title != book.Title || len(feed.Channel.Entries) != 2 {
+		t.Errorf("feed title = %q with %d items", feed.Channel.Title, len(feed.Channel.Entries))
+	}
+	for i, item := range feed.Channel.Entries {
+		if !strings.HasSuffix(item.Enclosure.URL, "/test-book/"+book.Episodes[i].File) {
+			t.Errorf("item %d enclosure = %s", i+1, item.Enclosure.URL)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "test-book.m3u")); err != nil {
+		t.Error(err)
+	}
+
+	var last progress.Event
+	scanner := bufio.NewScanner(bytes.NewReader(stdout))
+	for scanner.Scan() {
+		if err := json.Unmarshal(scanner.Bytes(), &last); err != nil {
+			t.Fatalf("progress %q: %v", scanner.Text(), err)
+		}
+	}
+	if last.Stage != progress.Finished || last.Done != 2 || last.Percent != 100 {
+		t.Errorf("last progress event = %+v", last)
+	}
+}
+
+func TestEndToEndHostileNames(t *testing.T) {
+	if testing.Short() || !audiotest.Available() {
+		t.Skip("ffmpeg is not available")
+	}
+	tmp := filepath.Join(t.TempDir(), "it's \"tmp\" ёлка")
+	if err := os.Mkdir(tmp, 0777); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TMPDIR", tmp)
+
+	src := filepath.Join(t.TempDir(), "Л. Толстой: it's \"War\"")
+	fixtures := []audiotest.Fixture{}
+	for i, name := range []string{"01 it's.mp3", "02 Part 1: Intro.mp3", "03 line\nbreak.mp3"} {
+		fixtures = append(fixtures, audiotest.Fixture{
+			Name:     name,
+			Segments: audiotest.Tones(time.Minute, 20*time.Second, time.Second),
+			Tags:     map[string]string{"album": "War & Peace, Vol. 1", "artist": "Tolstoy, Leo", "track": fmt.Sprint(i + 1)},
+		})
+	}
+	if _, err := audiotest.Book(src, fixtures...); err != nil {
+		t.Fatal(err)
+	}
+	dst := t.TempDir()
+
+	rssbookcli(t, "-dst", dst, "-name", "hostile", src)
+
+	m, err := manifest.Read(filepath.Join(dst, "hostile"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Book.Title != "War & Peace, Vol. 1" || m.Book.Author != "Tolstoy, Leo" {
+		t.Errorf("title = %q, author = %q", m.Book.Title, m.Book.Author)
+	}
+	if len(m.Book.Episodes) != 1 || math.Abs((m.Book.Episodes[0].Duration-3*time.Minute).Seconds()) > 2 {
+		t.Errorf("episodes = %+v, want one of 3m", m.Book.Episodes)
+	}
+}
+
+func TestEndToEndLoudnorm(t *testing.T) {
+	if testing.Short() || !audiotest.Available() {
+		t.Skip("ffmpeg is not available")
+	}
+	src := filepath.Join(t.TempDir(), "Quiet Book")
+	fixtures := []audiotest.Fixture{}
+	for _, name := range []string{"01.mp3", "02.mp3"} {
+		fixtures = append(fixtures, audiotest.Fixture{
+			Name:     name,
+			Segments: audiotest.Tones(time.Minute, 20*time.Second, time.Second),
+			Tags:     map[string]string{"album": "Quiet Book", "artist": "Author"},
+		})
+	}
+	if _, err := audiotest.Book(src, fixtures...); err != nil {
+		t.Fatal(err)
+	}
+	dst := t.TempDir()
+
+	rssbookcli(t, "-dst", dst, "-loudnorm", "file", "-lufs", "-18", src)
+
+	dir := filepath.Join(dst, "quiet-book")
+	m, err := manifest.Read(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Loudness) != 2 || len(m.Book.Episodes) != 1 {
+		t.Fatalf("loudness = %+v, episodes = %+v", m.Loudness, m.Book.Episodes)
+	}
+	got, err := (audio.Pipeline{}).MeasureLoudness(utils.FileName(filepath.Join(dir, m.Book.Episodes[0].File)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(got.Integrated+18) > 2 {
+		t.Errorf("episode loudness = %g LUFS, want -18", got.Integrated)
+	}
+}
+
+func TestEndToEndFormats(t *testing.T) {
+	if testing.Short() || !audiotest.Available() {
+		t.Skip("ffmpeg is not available")
+	}
+	src := filepath.Join(t.TempDir(), "Mixed Book")
+	fixtures := []audiotest.Fixture{}
+	for i, name := range []string{"01.flac", "02.m4b", "03.mp3"} {
+		fixtures = append(fixtures, audiotest.Fixture{
+			Name:     name,
+			Segments: audiotest.Tones(time.Minute, 20*time.Second, time.Second),
+			Tags:     map[string]string{"album": "Mixed Book", "artist": "Author", "track": fmt.Sprint(i + 1)},
+		})
+	}
+	if _, err := audiotest.Book(src, fixtures...); err != nil {
+		t.Fatal(err)
+	}
+	dst := t.TempDir()
+
+	rssbookcli(t, "-dst", dst, src)
+
+	dir := filepath.Join(dst, "mixed-book")
+	m, err := manifest.Read(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Book.Title != "Mixed Book" || m.Book.Author != "Author" {
+		t.Errorf("title = %q, author = %q", m.Book.Title, m.Book.Author)
+	}
+	// Parts of every format are joined into one mp3 episode
+	if len(m.Book.Episodes) != 1 || math.Abs((m.Book.Episodes[0].Duration-3*time.Minute).Seconds()) > 2 {
+		t.Fatalf("episodes = %+v, want one of 3m", m.Book.Episodes)
+	}
+	info, err := probe.File(filepath.Join(dir, m.Book.Episodes[0].File))
+	if err != nil || info.Format != "mp3" {
+		t.Errorf("episode format = %q, %v", info.Format, err)
+	}
+}
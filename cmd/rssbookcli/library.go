@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/histrio/rssbook/pkg/library"
+	"github.com/histrio/rssbook/pkg/rss"
+	"github.com/histrio/rssbook/pkg/utils"
+)
+
+// libraryCommand writes an OPML list, an index page and an optional
+// aggregate feed for all books built into a directory
+func libraryCommand(args []string) {
+	fs := flag.NewFlagSet("library", flag.ExitOnError)
+	var title string
+	var baseURL string
+	var aggregate int
+	fs.StringVar(&title, "title", "Audiobooks", "Library title")
+	fs.StringVar(&baseURL, "base-url", "", "Public URL of the library root. By default books keep their own URLs.")
+	fs.IntVar(&aggregate, "aggregate", 0, "Write a \"new in library\" feed with this many latest episodes. 0 to skip.")
+	var lo logOptions
+	lo.register(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: rssbookcli library [flags] <library dir>")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	lo.apply(os.Stderr)
+
+	if fs.NArg() != 1 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	root := fs.Arg(0)
+	entries, err := library.Scan(root)
+	if err != nil {
+		logger.Fatal("Scanning failed", "err", err)
+	}
+	lib := library.Library{Title: title, BaseURL: baseURL, Entries: entries}
+	now := utils.Now()
+
+	var opml bytes.Buffer
+	utils.Check(lib.WriteOPML(&opml, now))
+	utils.Check(os.WriteFile(filepath.Join(root, library.OPMLFile), opml.Bytes(), 0644))
+
+	var index bytes.Buffer
+	utils.Check(lib.WriteHTML(&index, aggregate > 0))
+	utils.Check(os.WriteFile(filepath.Join(root, library.IndexFile), index.Bytes(), 0644))
+
+	if aggregate > 0 {
+		feed, err := rss.RenderXML(lib.Aggregate(aggregate, now))
+		utils.Check(err)
+		utils.Check(os.WriteFile(filepath.Join(root, library.AggregateFile), []byte(feed), 0644))
+	}
+	logger.Info("Library written", "dir", root, "books", len(entries))
+}
@@ -1,148 +1,213 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"io"
 	"os"
-	"path"
 	"path/filepath"
 	"strings"
+	"time"
 
-	"github.com/gosimple/slug"
 	"github.com/histrio/rssbook/pkg/audio"
 	"github.com/histrio/rssbook/pkg/loggers"
+	"github.com/histrio/rssbook/pkg/playlist"
+	"github.com/histrio/rssbook/pkg/progress"
 	"github.com/histrio/rssbook/pkg/rss"
+	"github.com/histrio/rssbook/pkg/rssbook"
+	"github.com/histrio/rssbook/pkg/schedule"
 	"github.com/histrio/rssbook/pkg/utils"
 	"github.com/histrio/rssbook/pkg/version"
 )
 
-const _defaultBookAuthor string = "< Book Author >"
-const _defaultBookTitle string = "< Title >"
-const episodeMin int = 8
+// progressReporter returns a reporter for the progress mode, nil if progress
+// is not shown
+func progressReporter(mode string) (progress.Reporter, error) {
+	switch mode {
+	case "auto":
+		if fi, err := os.Stderr.Stat(); err == nil && fi.Mode()&os.ModeCharDevice != 0 {
+			return progress.Bar(os.Stderr), nil
+		}
+		return nil, nil
+	case "bar":
+		return progress.Bar(os.Stderr), nil
+	case "json":
+		return progress.JSON(os.Stdout), nil
+	case "none":
+		return nil, nil
+	}
+	return nil, fmt.Errorf("unknown progress mode %q", mode)
+}
 
-func getTitleAndAuthor(src string) (string, string) {
-	firstFieldName := <-utils.GetFiles(src)
-	result, err := utils.SimpleExec("ffprobe", "-loglevel", "error", "-show_entries", "format_tags=title,artist", "-of", "default=noprint_wrappers=1:nokey=1", "-of", "csv", string(firstFieldName))
-	utils.Check(err)
-	artistAndTitle := strings.Split(result, ",")
-	if len(artistAndTitle) < 3 {
-		return "", ""
+// logger is the program log, commands set it up by their flags
+var logger = loggers.New(loggers.TextHandler(os.Stderr), loggers.LevelInfo)
+
+// logOptions are flags shared by all commands
+type logOptions struct {
+	level  string
+	format string
+}
+
+func (o *logOptions) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.level, "log-level", "info", "Log level: debug, info, warning or error.")
+	fs.StringVar(&o.format, "log-format", "text", "Log format: text or json.")
+}
+
+// apply sets the program log up writing to w
+func (o logOptions) apply(w io.Writer) {
+	l, err := loggers.Open(w, o.format, o.level)
+	if err != nil {
+		logger.Fatal(err.Error())
 	}
-	return artistAndTitle[1], artistAndTitle[2]
+	logger = l
 }
 
-func cookAudio(src string) chan utils.FileName {
-	files := utils.GetFiles(src)
-	splittedFiles := audio.GetSplittedEpisodes(files, episodeMin)
-	mergedEpisodes := audio.GetMergedEpisodes(splittedFiles)
-	compressedEpisodes := audio.GetCompressedEpisodes(mergedEpisodes)
-	return compressedEpisodes
+// args returns the flags for builds run as child processes
+func (o logOptions) args() []string {
+	return []string{"-log-level", o.level, "-log-format", o.format}
 }
 
-func cookRss(book utils.BookMeta, dst string) utils.FileName {
-	xmlDest := path.Join(dst, book.ID+".xml")
-	f, err := os.Create(xmlDest)
-	utils.Check(err)
-	defer f.Close()
-	f.WriteString(rss.GenerateXML(book))
-	return utils.FileName(xmlDest)
+// playlistOptions are flags shared by commands writing playlists
+type playlistOptions struct {
+	formats  string
+	absolute bool
 }
 
-func cookM3U(book utils.BookMeta, dst string) string {
-	m3uDest := path.Join(dst, book.ID+".m3u")
-	f, err := os.Create(m3uDest)
-	utils.Check(err)
-	f.WriteString("#EXTM3U\n\n")
-	for _, ep := range book.Episodes {
-		f.WriteString(ep.File + ".mp3\n")
+func (o *playlistOptions) register(fs *flag.FlagSet) {
+	fs.StringVar(&o.formats, "playlists", "m3u", "Comma separated playlist formats: "+strings.Join(playlist.FormatNames(), ", ")+". Empty to skip playlists.")
+	fs.BoolVar(&o.absolute, "playlist-absolute", false, "Use absolute episode URLs in playlists instead of relative paths.")
+}
+
+func (o playlistOptions) validate() error {
+	for _, format := range strings.Split(o.formats, ",") {
+		if _, ok := playlist.Formats[format]; format != "" && !ok {
+			return fmt.Errorf("unknown playlist format %q", format)
+		}
 	}
-	return m3uDest
+	return nil
+}
+
+// list returns the playlist formats
+func (o playlistOptions) list() []string {
+	result := []string{}
+	for _, format := range strings.Split(o.formats, ",") {
+		if format != "" {
+			result = append(result, format)
+		}
+	}
+	return result
+}
+
+// writeFeeds writes the feed and playlists of the book into the directory
+func writeFeeds(book utils.BookMeta, dir string, update bool, o playlistOptions, location *time.Location) {
+	if _, err := rssbook.WriteFeed(book, dir, update, rss.Location(location)); err != nil {
+		logger.Fatal("Writing feed failed", "dir", dir, "err", err)
+	}
+	if _, err := rssbook.WritePlaylists(book, dir, o.list(), o.absolute); err != nil {
+		logger.Fatal("Writing playlists failed", "dir", dir, "err", err)
+	}
+}
+
+// buildBook converts audio files of the source folder or archive into a book in the
+// destination and returns the book with the directory it was written to
+func buildBook(src string, dst string, b rssbook.Builder) (utils.BookMeta, string) {
+	b.Log = logger
+	book, err := b.Build(context.Background(), src, dst)
+	if err != nil {
+		logger.Fatal("Build failed", "source", src, "err", err)
+	}
+	return book, filepath.Join(dst, book.ID)
+}
+
+// commands are subcommands available besides the default book conversion
+var commands = map[string]func(args []string){
+	"daemon":   daemonCommand,
+	"library":  libraryCommand,
+	"publish":  publishCommand,
+	"render":   renderCommand,
+	"series":   seriesCommand,
+	"serve":    serveCommand,
+	"token":    tokenCommand,
+	"validate": validateCommand,
+	"watch":    watchCommand,
 }
 
 func main() {
-	loggers.InitLoggers(os.Stdout, os.Stdout, os.Stdout, os.Stderr)
-	loggers.Info.Printf(
-		"Starting ...\ncommit: %s, build time: %s, release: %s",
-		version.Commit, version.BuildTime, version.Release,
-	)
-	var dst string
+	if len(os.Args) > 1 {
+		if command, ok := commands[os.Args[1]]; ok {
+			command(os.Args[2:])
+			return
+		}
+	}
 	var src string
-	var bookID string
-	var bookTitle string
-	var bookAuthor string
+	var dst string
+	var timeZone string
+	var progressMode string
+	var lo logOptions
+	var playlists playlistOptions
+	var b rssbook.Builder
 
 	flag.StringVar(&dst, "dst", "", "Generated files destination")
 	//flag.StringVar(&src, "src", "", "Source of audiofiles")
-	flag.StringVar(&bookID, "name", "", "Set a shortname for the podcast. By default it would be a slugifyed source folder name.")
-	flag.StringVar(&bookTitle, "title", "", "Set title for the podcast. By default it would take a title from the first file of the book.")
-	flag.StringVar(&bookAuthor, "author", "", "Set an author for the podcast. By default it would take an artist from the first file of the book.")
+	flag.StringVar(&b.BookID, "name", "", "Set a shortname for the podcast. By default it would be a slugifyed source folder or archive name.")
+	flag.StringVar(&b.Title, "title", "", "Set title for the podcast. By default it would take the album most files of the book agree on, or their title.")
+	flag.StringVar(&b.Author, "author", "", "Set an author for the podcast. By default it would take the artist most files of the book agree on.")
+	flag.IntVar(&b.SeriesIndex, "series-index", 0, "Set a number of the book in its series. By default it would take a series tag most files of the book agree on.")
+	flag.StringVar(&timeZone, "tz", "UTC", "Set a time zone for the feed dates, e.g. Europe/Berlin.")
+	flag.StringVar(&b.Schedule, "schedule", "", "Release episodes gradually, e.g. \"one episode per weekday at 07:00 Europe/Berlin starting 2026-11-01\". The feed includes released episodes only, run the render command to update it.")
+	flag.StringVar(&b.Order, "order", "", "Order source files by their names naturally (name) or by disc and track tags (tags). An order.txt or M3U playlist in the source folder takes precedence. By default it is name.")
+	flag.StringVar(&b.Loudnorm, "loudnorm", "", "Normalize loudness of episodes measuring every source file (file) or the whole book (book). Measurements are cached in the manifest. Off by default.")
+	flag.Float64Var(&b.Loudness.Integrated, "lufs", audio.DefaultTarget.Integrated, "Set a target integrated loudness of normalization in LUFS.")
+	flag.Float64Var(&b.Loudness.TruePeak, "true-peak", audio.DefaultTarget.TruePeak, "Set a maximum true peak of normalization in dBTP.")
+	flag.BoolVar(&b.Update, "update", false, "Update an existing book: merge episodes into its feed by GUID keeping hand-edited fields and publication dates.")
+	flag.StringVar(&progressMode, "progress", "auto", "Show progress: bar, json for newline delimited events on stdout, none, or auto for a bar on a terminal.")
+	playlists.register(flag.CommandLine)
+	lo.register(flag.CommandLine)
 	flag.Parse()
 
-	if flag.NArg() == 1 {
-		src = flag.Arg(0)
+	var err error
+	b.Progress, err = progressReporter(progressMode)
+	if err != nil {
+		logger.Fatal(err.Error())
+	}
+	if bar, ok := b.Progress.(io.Writer); ok {
+		// Log lines are kept above the progress bar
+		lo.apply(bar)
 	} else {
-		loggers.Error.Fatalln("No source found.")
+		lo.apply(os.Stderr)
 	}
+	logger.Info("Starting", "commit", version.Commit, "buildTime", version.BuildTime, "release", version.Release)
 
-	pwd, err := os.Getwd()
-	utils.Check(err)
-
-	if dst == "" {
-		dst = pwd
-		loggers.Warning.Println("No destination specified. '" + pwd + "' used")
+	if err := playlists.validate(); err != nil {
+		logger.Fatal(err.Error())
 	}
+	b.Playlists, b.AbsolutePlaylists = playlists.list(), playlists.absolute
 
-	if bookID == "" {
-		bookID = slug.Make(filepath.Base(src))
-		loggers.Warning.Println("No book-id specified. '" + bookID + "' used")
+	b.Location, err = time.LoadLocation(timeZone)
+	if err != nil {
+		logger.Fatal("Unknown time zone", "tz", timeZone)
 	}
 
-	dest := path.Join(dst, bookID)
-	err = os.Mkdir(dest, 0777)
-	utils.Check(err)
-
-	_title, _author := getTitleAndAuthor(src)
-	if bookAuthor == "" {
-		bookAuthor = _author
-		loggers.Warning.Println("No book author specified. '" + bookAuthor + "' used")
-	}
-	if bookTitle == "" {
-		bookTitle = _title
-		loggers.Warning.Println("No book author specified. '" + bookTitle + "' used")
+	if b.Schedule != "" {
+		if _, err := schedule.Parse(b.Schedule); err != nil {
+			logger.Fatal("Wrong schedule", "err", err)
+		}
 	}
 
-	book := utils.BookMeta{
-		ID:     bookID,
-		Title:  bookTitle,
-		Author: bookAuthor,
+	if flag.NArg() == 1 {
+		src = flag.Arg(0)
+	} else {
+		logger.Fatal("No source found")
 	}
 
-	pos := 0
-	for epFile := range cookAudio(src) {
-
-		pos = pos + 1
-		outFile := fmt.Sprintf("episode-%03d.mp3", pos)
-
-		ep := utils.BookEpisode{
-			Pos:      pos,
-			Name:     fmt.Sprintf("Episode %03d", pos),
-			File:     outFile,
-			FileSize: utils.GetFileSize(epFile),
-			Href:     utils.S3Url + book.ID + "/" + outFile,
-			Duration: audio.GetDuration(epFile),
-		}
-
-		go func() {
-			utils.CopyFile(epFile, path.Join(dest, outFile))
-			utils.Check(err)
-			loggers.Info.Println("Issued: " + outFile)
-			err := os.Remove(string(epFile))
-			utils.Check(err)
-		}()
+	pwd, err := os.Getwd()
+	utils.Check(err)
 
-		book.Episodes = append(book.Episodes, ep)
+	if dst == "" {
+		dst = pwd
+		logger.Warning("No destination specified, the current directory is used", "dst", pwd)
 	}
 
-	cookRss(book, dest)
-	cookM3U(book, dest)
+	buildBook(src, dst, b)
 }
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/histrio/rssbook/pkg/manifest"
+	"github.com/histrio/rssbook/pkg/publish"
+)
+
+// publishCommand uploads built books to a storage
+func publishCommand(args []string) {
+	fs := flag.NewFlagSet("publish", flag.ExitOnError)
+	var target string
+	var prefix string
+	var public bool
+	var o publish.SyncOptions
+	fs.StringVar(&target, "to", "", "Publish target: a directory, s3://bucket/prefix?endpoint=URL&region=R&path-style=1&storage-class=C, dav://host/path, davs://host/path or sftp://user@host:port/path?identity=key")
+	fs.StringVar(&prefix, "prefix", "", "Path inside the target to put books into")
+	fs.BoolVar(&public, "public", false, "Make uploaded files readable by anyone")
+	fs.BoolVar(&o.Delete, "delete", false, "Delete remote files of the book missing locally")
+	fs.BoolVar(&o.Force, "force", false, "Upload all files even if they are unchanged")
+	var lo logOptions
+	lo.register(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: rssbookcli publish -to <target> [flags] <book dir>...")
+		fmt.Fprintln(fs.Output(), "S3 credentials are taken from AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY.")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	lo.apply(os.Stderr)
+
+	if fs.NArg() == 0 || target == "" {
+		fs.Usage()
+		os.Exit(2)
+	}
+	p, err := publish.Open(target, public)
+	if err != nil {
+		logger.Fatal("Wrong target", "target", target, "err", err)
+	}
+	for _, dir := range fs.Args() {
+		bookID := filepath.Base(filepath.Clean(dir))
+		o.Checksums = nil
+		if m, err := manifest.Read(dir); err == nil {
+			bookID = m.Book.ID
+			o.Checksums = m.Files
+		}
+		log := logger.With("book", bookID)
+		result, err := publish.Sync(p, dir, prefix, bookID, o)
+		if err != nil {
+			log.Fatal("Publishing failed", "err", err)
+		}
+		for _, name := range result.Uploaded {
+			log.Debug("Uploaded", "file", name)
+		}
+		for _, name := range result.Deleted {
+			log.Debug("Deleted", "file", name)
+		}
+		log.Info("Published", "dir", dir, "uploaded", len(result.Uploaded), "unchanged", len(result.Unchanged), "deleted", len(result.Deleted))
+	}
+}
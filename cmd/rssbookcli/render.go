@@ -0,0 +1,59 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/histrio/rssbook/pkg/manifest"
+	"github.com/histrio/rssbook/pkg/utils"
+)
+
+// renderCommand regenerates feeds of built books from their manifests. Run by
+// cron it releases scheduled episodes as their dates come.
+func renderCommand(args []string) {
+	fs := flag.NewFlagSet("render", flag.ExitOnError)
+	var all bool
+	var update bool
+	var timeZone string
+	var playlists playlistOptions
+	fs.BoolVar(&all, "all", false, "Include episodes scheduled for the future")
+	fs.BoolVar(&update, "update", false, "Merge episodes into the existing feed keeping hand-edited fields and publication dates")
+	fs.StringVar(&timeZone, "tz", "UTC", "Set a time zone for the feed dates, e.g. Europe/Berlin.")
+	playlists.register(fs)
+	var lo logOptions
+	lo.register(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: rssbookcli render [flags] <book dir>...")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	lo.apply(os.Stderr)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if err := playlists.validate(); err != nil {
+		logger.Fatal(err.Error())
+	}
+	location, err := time.LoadLocation(timeZone)
+	if err != nil {
+		logger.Fatal("Unknown time zone", "tz", timeZone)
+	}
+
+	now := utils.Now()
+	for _, dir := range fs.Args() {
+		m, err := manifest.Read(dir)
+		if err != nil {
+			logger.Fatal("Reading manifest failed", "dir", dir, "err", err)
+		}
+		book := m.Book
+		if !all {
+			book = book.ReleasedBy(now)
+		}
+		writeFeeds(book, dir, update, playlists, location)
+		logger.Info("Rendered", "book", m.Book.ID, "dir", dir, "released", len(book.Episodes), "episodes", len(m.Book.Episodes))
+	}
+}
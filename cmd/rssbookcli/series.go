@@ -0,0 +1,142 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gosimple/slug"
+	"github.com/histrio/rssbook/pkg/manifest"
+	"github.com/histrio/rssbook/pkg/rssbook"
+	"github.com/histrio/rssbook/pkg/series"
+	"github.com/histrio/rssbook/pkg/utils"
+)
+
+// seriesVolume returns a built volume for the argument of the series
+// command. Source folders are converted first unless they are built already.
+func seriesVolume(arg string, dst string, b rssbook.Builder) (utils.BookMeta, string) {
+	if m, err := manifest.Read(arg); err == nil {
+		return m.Book, arg
+	}
+	dir := filepath.Join(dst, rssbook.DefaultID(arg))
+	if m, err := manifest.Read(dir); err == nil {
+		logger.Info("Built already", "source", arg, "dir", dir)
+		return m.Book, dir
+	}
+	return buildBook(arg, dst, b)
+}
+
+// seriesCommand combines several books into a single feed, volume after
+// volume in their series order
+func seriesCommand(args []string) {
+	fs := flag.NewFlagSet("series", flag.ExitOnError)
+	var dst string
+	var seriesID string
+	var title string
+	var timeZone string
+	var playlists playlistOptions
+	fs.StringVar(&dst, "dst", "", "Generated files destination")
+	fs.StringVar(&seriesID, "name", "", "Set a shortname for the series podcast. By default it would be a slugifyed series title.")
+	fs.StringVar(&title, "title", "", "Set title for the series podcast. By default it would take a series tag of the volumes.")
+	fs.StringVar(&timeZone, "tz", "UTC", "Set a time zone for the feed dates, e.g. Europe/Berlin.")
+	playlists.register(fs)
+	var lo logOptions
+	lo.register(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: rssbookcli series [flags] <source or book dir>...")
+		fmt.Fprintln(fs.Output(), "Volumes of an existing series are kept, so new ones can be appended.")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	lo.apply(os.Stderr)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if err := playlists.validate(); err != nil {
+		logger.Fatal(err.Error())
+	}
+	location, err := time.LoadLocation(timeZone)
+	if err != nil {
+		logger.Fatal("Unknown time zone", "tz", timeZone)
+	}
+
+	if dst == "" {
+		dst, err = os.Getwd()
+		utils.Check(err)
+		logger.Warning("No destination specified, the current directory is used", "dst", dst)
+	}
+
+	volumes := []series.Volume{}
+	dirs := map[string]string{}
+	for _, arg := range fs.Args() {
+		book, dir := seriesVolume(arg, dst, rssbook.Builder{Playlists: playlists.list(), AbsolutePlaylists: playlists.absolute})
+		if _, ok := dirs[book.ID]; !ok {
+			volumes = append(volumes, series.Volume{Book: book})
+		}
+		dirs[book.ID] = dir
+	}
+
+	if title == "" {
+		ordered := append([]series.Volume{}, volumes...)
+		series.Sort(ordered)
+		for _, v := range ordered {
+			if v.Book.Series != "" {
+				title = v.Book.Series
+				break
+			}
+		}
+	}
+	if seriesID == "" {
+		if title == "" {
+			logger.Fatal("No series title found, set it with -title or -name")
+		}
+		seriesID = slug.Make(title)
+		logger.Warning("No series id specified, the slugified title is used", "series", seriesID)
+	}
+	dest := filepath.Join(dst, seriesID)
+	err = os.MkdirAll(dest, 0777)
+	utils.Check(err)
+
+	// Volumes of the previous run go first, so new ones are appended
+	if m, err := manifest.Read(dest); err == nil {
+		if title == "" {
+			title = m.Book.Title
+		}
+		known := []series.Volume{}
+		for _, rel := range m.Volumes {
+			dir := filepath.Join(dest, filepath.FromSlash(rel))
+			vm, err := manifest.Read(dir)
+			if err != nil {
+				logger.Fatal("Reading volume failed", "dir", dir, "err", err)
+			}
+			if _, ok := dirs[vm.Book.ID]; !ok {
+				known = append(known, series.Volume{Book: vm.Book})
+				dirs[vm.Book.ID] = dir
+			}
+		}
+		volumes = append(known, volumes...)
+	}
+	if title == "" {
+		title = seriesID
+	}
+
+	rels := []string{}
+	for i, v := range volumes {
+		rel, err := filepath.Rel(dest, dirs[v.Book.ID])
+		utils.Check(err)
+		volumes[i].Dir = filepath.ToSlash(rel)
+		rels = append(rels, volumes[i].Dir)
+	}
+
+	book := series.Combine(seriesID, title, volumes)
+	err = manifest.Manifest{Book: book, Volumes: rels}.Write(dest)
+	utils.Check(err)
+
+	released := book.ReleasedBy(utils.Now())
+	writeFeeds(released, dest, true, playlists, location)
+	logger.Info("Series written", "series", seriesID, "dir", dest, "volumes", len(volumes), "episodes", len(book.Episodes))
+}
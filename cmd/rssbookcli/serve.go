@@ -0,0 +1,84 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/histrio/rssbook/pkg/access"
+	"github.com/histrio/rssbook/pkg/loggers"
+	"github.com/histrio/rssbook/pkg/server"
+)
+
+// serveCommand hosts built books over HTTP
+func serveCommand(args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	var addr string
+	var baseURL string
+	var trustProxy bool
+	var tokensFile string
+	var urlTTL time.Duration
+	var accessLog string
+	fs.StringVar(&addr, "addr", ":8080", "Address to listen on")
+	fs.StringVar(&baseURL, "base-url", "", "Public URL of the server used in feeds. By default it is taken from requests.")
+	fs.BoolVar(&trustProxy, "trust-proxy", false, "Take the scheme of requests from X-Forwarded-Proto set by a reverse proxy")
+	fs.StringVar(&tokensFile, "tokens", "", "Token file turning on private feeds, managed by the token command")
+	fs.DurationVar(&urlTTL, "url-ttl", server.DefaultURLTTL, "How long signed episode URLs of private feeds stay valid")
+	fs.StringVar(&accessLog, "access-log", "", "File to log private feed accesses to. By default they go to the main log.")
+	var lo logOptions
+	lo.register(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: rssbookcli serve [flags] <book or library dir>...")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	lo.apply(os.Stderr)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	srv, err := server.New(baseURL, fs.Args())
+	if err != nil {
+		logger.Fatal(err.Error())
+	}
+	srv.TrustProxy = trustProxy
+	srv.URLTTL = urlTTL
+	srv.Log = logger
+	if tokensFile != "" {
+		srv.Tokens, err = access.Open(tokensFile)
+		if err != nil {
+			logger.Fatal(err.Error())
+		}
+		logger.Info("Private feeds are served to tokens", "tokens", tokensFile)
+	}
+	if accessLog != "" {
+		f, err := os.OpenFile(accessLog, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err != nil {
+			logger.Fatal(err.Error())
+		}
+		defer f.Close()
+		// Accesses are kept whatever the level of the main log is
+		srv.AccessLog, err = loggers.Open(f, lo.format, "info")
+		if err != nil {
+			logger.Fatal(err.Error())
+		}
+	}
+	ids := []string{}
+	for id := range srv.Books {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		logger.Info("Serving", "book", id, "dir", srv.Books[id].Dir)
+	}
+	logger.Info("Listening", "addr", addr)
+	var handler http.Handler = srv
+	if srv.Tokens == nil {
+		handler = server.LogRequests(logger, srv)
+	}
+	logger.Fatal("Serving failed", "err", http.ListenAndServe(addr, handler))
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/histrio/rssbook/pkg/access"
+)
+
+// tokenCommand manages listener tokens of private feeds
+func tokenCommand(args []string) {
+	fs := flag.NewFlagSet("token", flag.ExitOnError)
+	var tokensFile string
+	var baseURL string
+	fs.StringVar(&tokensFile, "tokens", "tokens.json", "Token file")
+	fs.StringVar(&baseURL, "base-url", "", "Public URL of the server to print feed URLs for new tokens")
+	var lo logOptions
+	lo.register(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: rssbookcli token [flags] add <user> | revoke <token or user> | list")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	lo.apply(os.Stderr)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	store, err := access.Open(tokensFile)
+	if err != nil {
+		logger.Fatal(err.Error())
+	}
+
+	switch action := fs.Arg(0); {
+	case action == "add" && fs.NArg() == 2:
+		token, err := store.Add(fs.Arg(1))
+		if err != nil {
+			logger.Fatal(err.Error())
+		}
+		fmt.Println(token.Value)
+		if baseURL != "" {
+			fmt.Printf("Feed URLs: %s/%s/<book>/<book>.xml\n", baseURL, token.Value)
+		}
+	case action == "revoke" && fs.NArg() == 2:
+		n, err := store.Revoke(fs.Arg(1))
+		if err != nil {
+			logger.Fatal(err.Error())
+		}
+		if n == 0 {
+			logger.Fatal("No active tokens found", "user", fs.Arg(1))
+		}
+		fmt.Printf("%d token(s) revoked\n", n)
+	case action == "list" && fs.NArg() == 1:
+		tokens, err := store.Tokens()
+		if err != nil {
+			logger.Fatal(err.Error())
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "TOKEN\tUSER\tCREATED\tREVOKED")
+		for _, token := range tokens {
+			revoked := "-"
+			if !token.Active() {
+				revoked = token.Revoked.Format("2006-01-02 15:04")
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", token.Value, token.User, token.Created.Format("2006-01-02 15:04"), revoked)
+		}
+		w.Flush()
+	default:
+		fs.Usage()
+		os.Exit(2)
+	}
+}
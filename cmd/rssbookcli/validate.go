@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/histrio/rssbook/pkg/rss"
+)
+
+type validateReport struct {
+	Feed     string      `json:"feed"`
+	Errors   int         `json:"errors"`
+	Warnings int         `json:"warnings"`
+	Issues   []rss.Issue `json:"issues"`
+}
+
+func isRemote(src string) bool {
+	return strings.HasPrefix(src, "http://") || strings.HasPrefix(src, "https://")
+}
+
+// readFeed reads a local or remote feed, invalid dates are left for the
+// validation to report
+func readFeed(src string) (rss.RssBody, error) {
+	if !isRemote(src) {
+		f, err := os.Open(src)
+		if err != nil {
+			return rss.RssBody{}, err
+		}
+		defer f.Close()
+		return rss.ParseXMLLenient(f)
+	}
+	resp, err := http.Get(src)
+	if err != nil {
+		return rss.RssBody{}, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return rss.RssBody{}, fmt.Errorf("%s: %s", src, resp.Status)
+	}
+	return rss.ParseXMLLenient(resp.Body)
+}
+
+func validateFeed(src string, dir string) validateReport {
+	report := validateReport{Feed: src, Issues: []rss.Issue{}}
+	feed, err := readFeed(src)
+	if err != nil {
+		report.Issues = append(report.Issues, rss.Issue{
+			Severity: rss.SeverityError,
+			Path:     "rss",
+			Message:  "can't parse feed: " + err.Error(),
+		})
+	} else {
+		report.Issues = append(report.Issues, rss.Validate(feed, rss.ValidateOptions{Dir: dir})...)
+	}
+	for _, issue := range report.Issues {
+		switch issue.Severity {
+		case rss.SeverityError:
+			report.Errors++
+		case rss.SeverityWarning:
+			report.Warnings++
+		}
+	}
+	return report
+}
+
+func writeValidateReport(w io.Writer, reports []validateReport, format string) error {
+	if format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(reports)
+	}
+	for _, report := range reports {
+		for _, issue := range report.Issues {
+			fmt.Fprintf(w, "%s: %s\n", report.Feed, issue)
+		}
+		fmt.Fprintf(w, "%s: %d error(s), %d warning(s)\n", report.Feed, report.Errors, report.Warnings)
+	}
+	return nil
+}
+
+func validateCommand(args []string) {
+	fs := flag.NewFlagSet("validate", flag.ExitOnError)
+	var format string
+	var dir string
+	var strict bool
+	fs.StringVar(&format, "format", "text", "Report format: text or json")
+	fs.StringVar(&dir, "dir", "", "Directory with episodes and artwork. By default it is the feed's directory, remote feeds are not checked against files.")
+	fs.BoolVar(&strict, "strict", false, "Treat warnings as errors")
+	var lo logOptions
+	lo.register(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: rssbookcli validate [flags] <feed.xml|url>...")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	lo.apply(os.Stderr)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	if format != "text" && format != "json" {
+		fmt.Fprintf(os.Stderr, "Unknown report format %q\n", format)
+		os.Exit(2)
+	}
+
+	failed := false
+	reports := []validateReport{}
+	for _, src := range fs.Args() {
+		feedDir := dir
+		if feedDir == "" && !isRemote(src) {
+			feedDir = filepath.Dir(src)
+		}
+		report := validateFeed(src, feedDir)
+		if report.Errors > 0 || (strict && report.Warnings > 0) {
+			failed = true
+		}
+		reports = append(reports, report)
+	}
+	if err := writeValidateReport(os.Stdout, reports, format); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
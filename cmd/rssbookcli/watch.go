@@ -0,0 +1,102 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"path/filepath"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/histrio/rssbook/pkg/utils"
+	"github.com/histrio/rssbook/pkg/watch"
+)
+
+// watchCommand builds books dropped into an inbox folder
+func watchCommand(args []string) {
+	fs := flag.NewFlagSet("watch", flag.ExitOnError)
+	var dst string
+	var archive string
+	var queuePath string
+	var settle time.Duration
+	var poll time.Duration
+	fs.StringVar(&dst, "dst", "", "Library to build books into")
+	fs.StringVar(&archive, "archive", "", "Folder to move built sources to. By default it is an archive folder next to the inbox.")
+	fs.StringVar(&queuePath, "queue", "", "Queue file keeping pending builds between restarts. By default it is .rssbook-watch.json in the library.")
+	fs.DurationVar(&settle, "settle", watch.DefaultSettle, "How long a folder stays unchanged before it is built")
+	fs.DurationVar(&poll, "poll", 5*time.Second, "Interval of inbox rescans besides file system notifications")
+	var lo logOptions
+	lo.register(fs)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: rssbookcli watch [flags] <inbox> [build flags]")
+		fmt.Fprintln(fs.Output(), "Build flags, e.g. -update -tz Europe/Berlin, are passed to every build.")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	lo.apply(os.Stderr)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		os.Exit(2)
+	}
+	inbox := filepath.Clean(fs.Arg(0))
+	buildArgs := fs.Args()[1:]
+	var err error
+	if dst == "" {
+		dst, err = os.Getwd()
+		utils.Check(err)
+		logger.Warning("No destination specified, the current directory is used", "dst", dst)
+	}
+	if archive == "" {
+		archive = filepath.Join(filepath.Dir(inbox), "archive")
+	}
+	if queuePath == "" {
+		queuePath = filepath.Join(dst, ".rssbook-watch.json")
+	}
+	queue, err := watch.OpenQueue(queuePath)
+	if err != nil {
+		logger.Fatal("Opening queue failed", "err", err)
+	}
+	exe, err := os.Executable()
+	utils.Check(err)
+
+	var stopping int32
+	stop := make(chan struct{})
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		atomic.StoreInt32(&stopping, 1)
+		close(stop)
+	}()
+
+	w := &watch.Watcher{
+		Inbox:   inbox,
+		Archive: archive,
+		Settle:  settle,
+		Poll:    poll,
+		Queue:   queue,
+		Build: func(source string) error {
+			args := append(append([]string{"-dst", dst}, lo.args()...), buildArgs...)
+			cmd := exec.Command(exe, append(args, source)...)
+			cmd.Stdout = os.Stdout
+			cmd.Stderr = os.Stderr
+			err := cmd.Run()
+			if atomic.LoadInt32(&stopping) == 1 {
+				// The job stays running in the queue and is retried after
+				// a restart
+				logger.Warning("Interrupted", "source", source)
+				os.Exit(1)
+			}
+			return err
+		},
+		Log: logger,
+	}
+	logger.Info("Watching", "inbox", inbox, "dst", dst)
+	if err := w.Run(stop); err != nil {
+		logger.Fatal("Watching failed", "err", err)
+	}
+}
@@ -3,17 +3,76 @@ module histrio/rssbook
 go 1.17
 
 require (
-	github.com/gosimple/slug v1.11.0 // indirect
+	github.com/gosimple/slug v1.11.0
+	github.com/histrio/rssbook/pkg/access v0.0.0
+	github.com/histrio/rssbook/pkg/archive v0.0.0
+	github.com/histrio/rssbook/pkg/audio v0.0.0
+	github.com/histrio/rssbook/pkg/daemon v0.0.0
+	github.com/histrio/rssbook/pkg/internal/golden v0.0.0
+	github.com/histrio/rssbook/pkg/library v0.0.0
+	github.com/histrio/rssbook/pkg/loggers v0.0.0
+	github.com/histrio/rssbook/pkg/manifest v0.0.0
+	github.com/histrio/rssbook/pkg/order v0.0.0
+	github.com/histrio/rssbook/pkg/playlist v0.0.0
+	github.com/histrio/rssbook/pkg/probe v0.0.0
+	github.com/histrio/rssbook/pkg/progress v0.0.0
+	github.com/histrio/rssbook/pkg/publish v0.0.0
+	github.com/histrio/rssbook/pkg/rss v0.0.0
+	github.com/histrio/rssbook/pkg/rssbook v0.0.0
+	github.com/histrio/rssbook/pkg/schedule v0.0.0
+	github.com/histrio/rssbook/pkg/series v0.0.0
+	github.com/histrio/rssbook/pkg/server v0.0.0
+	github.com/histrio/rssbook/pkg/utils v0.0.0
+	github.com/histrio/rssbook/pkg/version v0.0.0
+	github.com/histrio/rssbook/pkg/watch v0.0.0
+	github.com/stretchr/testify v1.9.0
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/gosimple/unidecode v1.0.0 // indirect
-    github.com/histrio/rssbook/pkg/audio v0.0.0
-    github.com/histrio/rssbook/pkg/loggers v0.0.0
-    github.com/histrio/rssbook/pkg/rss v0.0.0
-    github.com/histrio/rssbook/pkg/utils v0.0.0
-    github.com/histrio/rssbook/pkg/version v0.0.0
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
 
+replace github.com/histrio/rssbook/pkg/access v0.0.0 => ./pkg/access
+
+replace github.com/histrio/rssbook/pkg/archive v0.0.0 => ./pkg/archive
+
 replace github.com/histrio/rssbook/pkg/audio v0.0.0 => ./pkg/audio
+
+replace github.com/histrio/rssbook/pkg/daemon v0.0.0 => ./pkg/daemon
+
+replace github.com/histrio/rssbook/pkg/internal/golden v0.0.0 => ./pkg/internal/golden
+
+replace github.com/histrio/rssbook/pkg/library v0.0.0 => ./pkg/library
+
 replace github.com/histrio/rssbook/pkg/loggers v0.0.0 => ./pkg/loggers
+
+replace github.com/histrio/rssbook/pkg/manifest v0.0.0 => ./pkg/manifest
+
+replace github.com/histrio/rssbook/pkg/order v0.0.0 => ./pkg/order
+
+replace github.com/histrio/rssbook/pkg/playlist v0.0.0 => ./pkg/playlist
+
+replace github.com/histrio/rssbook/pkg/probe v0.0.0 => ./pkg/probe
+
+replace github.com/histrio/rssbook/pkg/progress v0.0.0 => ./pkg/progress
+
+replace github.com/histrio/rssbook/pkg/publish v0.0.0 => ./pkg/publish
+
 replace github.com/histrio/rssbook/pkg/rss v0.0.0 => ./pkg/rss
+
+replace github.com/histrio/rssbook/pkg/rssbook v0.0.0 => ./pkg/rssbook
+
+replace github.com/histrio/rssbook/pkg/schedule v0.0.0 => ./pkg/schedule
+
+replace github.com/histrio/rssbook/pkg/series v0.0.0 => ./pkg/series
+
+replace github.com/histrio/rssbook/pkg/server v0.0.0 => ./pkg/server
+
 replace github.com/histrio/rssbook/pkg/utils v0.0.0 => ./pkg/utils
+
 replace github.com/histrio/rssbook/pkg/version v0.0.0 => ./pkg/version
+
+replace github.com/histrio/rssbook/pkg/watch v0.0.0 => ./pkg/watch
@@ -0,0 +1,265 @@
+package access
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Token grants a listener access to private feeds
+type Token struct {
+	Value   string    `json:"value"`
+	User    string    `json:"user"`
+	Created time.Time `json:"created"`
+	Revoked time.Time `json:"revoked"`
+}
+
+// Active tells whether the token is not revoked
+func (t Token) Active() bool {
+	return t.Revoked.IsZero()
+}
+
+type storeData struct {
+	Secret string  `json:"secret"`
+	Tokens []Token `json:"tokens"`
+}
+
+// Store keeps tokens and the URL signing secret in a JSON file. The file is
+// reloaded when it changes, so tokens revoked by another process stop working
+// without a restart.
+type Store struct {
+	path    string
+	mu      sync.Mutex
+	data    storeData
+	modTime time.Time
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Open loads the store, a missing file is created with a new secret
+func Open(path string) (*Store, error) {
+	s := &Store{path: path}
+	err := s.load()
+	if os.IsNotExist(err) {
+		s.data.Secret, err = randomHex(32)
+		if err != nil {
+			return nil, err
+		}
+		err = s.save()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Store) load() error {
+	fi, err := os.Stat(s.path)
+	if err != nil {
+		return err
+	}
+	content, err := os.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+	var data storeData
+	if err := json.Unmarshal(content, &data); err != nil {
+		return fmt.Errorf("%s: %s", s.path, err)
+	}
+	if data.Secret == "" {
+		return fmt.Errorf("%s: no secret", s.path)
+	}
+	s.data = data
+	s.modTime = fi.ModTime()
+	return nil
+}
+
+func (s *Store) save() error {
+	content, err := json.MarshalIndent(s.data, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, append(content, '\n'), 0600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return err
+	}
+	if fi, err := os.Stat(s.path); err == nil {
+		s.modTime = fi.ModTime()
+	}
+	return nil
+}
+
+// refresh reloads the file if it was changed since the last load
+func (s *Store) refresh() error {
+	fi, err := os.Stat(s.path)
+	if err != nil {
+		return err
+	}
+	if fi.ModTime().Equal(s.modTime) {
+		return nil
+	}
+	return s.load()
+}
+
+// Add issues a new token for the user
+func (s *Store) Add(user string) (Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.refresh(); err != nil {
+		return Token{}, err
+	}
+	value, err := randomHex(16)
+	if err != nil {
+		return Token{}, err
+	}
+	token := Token{Value: value, User: user, Created: time.Now().UTC()}
+	s.data.Tokens = append(s.data.Tokens, token)
+	return token, s.save()
+}
+
+// Revoke revokes active tokens with the value or issued for the user and
+// returns how many were revoked
+func (s *Store) Revoke(valueOrUser string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.refresh(); err != nil {
+		return 0, err
+	}
+	n := 0
+	now := time.Now().UTC()
+	for i, token := range s.data.Tokens {
+		if token.Active() && (token.Value == valueOrUser || token.User == valueOrUser) {
+			s.data.Tokens[i].Revoked = now
+			n++
+		}
+	}
+	if n == 0 {
+		return 0, nil
+	}
+	return n, s.save()
+}
+
+// Tokens returns all tokens including revoked ones
+func (s *Store) Tokens() ([]Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.refresh(); err != nil {
+		return nil, err
+	}
+	return append([]Token{}, s.data.Tokens...), nil
+}
+
+// Lookup returns an active token by its value
+func (s *Store) Lookup(value string) (Token, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.refresh(); err != nil {
+		return Token{}, false
+	}
+	for _, token := range s.data.Tokens {
+		if token.Active() && hmac.Equal([]byte(token.Value), []byte(value)) {
+			return token, true
+		}
+	}
+	return Token{}, false
+}
+
+// LookupID returns an active token by the ID signed URLs carry
+func (s *Store) LookupID(id string) (Token, bool) {
+	signer := s.Signer()
+	tokens, err := s.Tokens()
+	if err != nil {
+		return Token{}, false
+	}
+	for _, token := range tokens {
+		if token.Active() && hmac.Equal([]byte(signer.TokenID(token.Value)), []byte(id)) {
+			return token, true
+		}
+	}
+	return Token{}, false
+}
+
+// Signer returns a signer using the store's secret
+func (s *Store) Signer() Signer {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return Signer{Key: []byte(s.data.Secret)}
+}
+
+// Query parameters of signed URLs
+const (
+	ParamExpires   = "exp"
+	ParamTokenID   = "tid"
+	ParamSignature = "sig"
+)
+
+var (
+	ErrExpired   = errors.New("signed URL is expired")
+	ErrSignature = errors.New("signed URL has a wrong signature")
+)
+
+// Signer makes expiring URLs signed with HMAC-SHA256
+type Signer struct {
+	Key []byte
+}
+
+func (s Signer) signature(resource string, tokenID string, expires int64) string {
+	mac := hmac.New(sha256.New, s.Key)
+	fmt.Fprintf(mac, "%s\n%s\n%d", resource, tokenID, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// TokenID returns an opaque ID of the token. Signed URLs carry it instead of
+// the token, so a shared URL doesn't give access to the feeds.
+func (s Signer) TokenID(token string) string {
+	mac := hmac.New(sha256.New, s.Key)
+	fmt.Fprintf(mac, "token\n%s", token)
+	return hex.EncodeToString(mac.Sum(nil))[:32]
+}
+
+// Query returns query parameters granting the token access to the resource
+// until the expiration time
+func (s Signer) Query(resource string, token string, expires time.Time) url.Values {
+	id := s.TokenID(token)
+	q := url.Values{}
+	q.Set(ParamTokenID, id)
+	q.Set(ParamExpires, strconv.FormatInt(expires.Unix(), 10))
+	q.Set(ParamSignature, s.signature(resource, id, expires.Unix()))
+	return q
+}
+
+// Verify checks the signed query parameters of the resource and returns the
+// ID of the token they were issued for
+func (s Signer) Verify(resource string, q url.Values, now time.Time) (string, error) {
+	id := q.Get(ParamTokenID)
+	expires, err := strconv.ParseInt(q.Get(ParamExpires), 10, 64)
+	if err != nil {
+		return "", ErrSignature
+	}
+	want := s.signature(resource, id, expires)
+	if !hmac.Equal([]byte(want), []byte(q.Get(ParamSignature))) {
+		return "", ErrSignature
+	}
+	if now.Unix() > expires {
+		return id, ErrExpired
+	}
+	return id, nil
+}
@@ -0,0 +1,89 @@
+package access
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tokens.json")
+	store, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	alice, err := store.Add("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob, _ := store.Add("bob")
+
+	if got, ok := store.Lookup(alice.Value); !ok || got.User != "alice" {
+		t.Errorf("Lookup() = %v, %v", got, ok)
+	}
+	if got, ok := store.LookupID(store.Signer().TokenID(alice.Value)); !ok || got.Value != alice.Value {
+		t.Errorf("LookupID() = %v, %v", got, ok)
+	}
+	if _, ok := store.LookupID(alice.Value); ok {
+		t.Errorf("LookupID() found a token by its value")
+	}
+	if _, ok := store.Lookup("unknown"); ok {
+		t.Errorf("Lookup() found an unknown token")
+	}
+
+	// Revocation by another process is picked up
+	other, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, err := other.Revoke("alice"); n != 1 || err != nil {
+		t.Fatalf("Revoke() = %d, %v", n, err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	other.Add("carol")
+	if _, ok := store.Lookup(alice.Value); ok {
+		t.Errorf("revoked token is active")
+	}
+	if _, ok := store.Lookup(bob.Value); !ok {
+		t.Errorf("token of another user is revoked")
+	}
+	if n, _ := store.Revoke("alice"); n != 0 {
+		t.Errorf("Revoke() revoked %d tokens twice", n)
+	}
+	if tokens, _ := store.Tokens(); len(tokens) != 3 {
+		t.Errorf("Tokens() = %v", tokens)
+	}
+	if string(store.Signer().Key) != string(other.Signer().Key) {
+		t.Errorf("secret is not persisted")
+	}
+}
+
+func TestSigner(t *testing.T) {
+	s := Signer{Key: []byte("secret")}
+	now := time.Date(2026, 11, 1, 7, 0, 0, 0, time.UTC)
+	q := s.Query("book/episode-001.mp3", "token", now.Add(time.Hour))
+
+	if id, err := s.Verify("book/episode-001.mp3", q, now); err != nil || id != s.TokenID("token") {
+		t.Errorf("Verify() = %q, %v", id, err)
+	}
+	// The URL doesn't carry the token
+	for _, values := range q {
+		if strings.Contains(values[0], "token") {
+			t.Errorf("query %v has the token", q)
+		}
+	}
+	if _, err := s.Verify("book/episode-002.mp3", q, now); err != ErrSignature {
+		t.Errorf("Verify() of another resource = %v, want %v", err, ErrSignature)
+	}
+	if _, err := s.Verify("book/episode-001.mp3", q, now.Add(2*time.Hour)); err != ErrExpired {
+		t.Errorf("Verify() of expired URL = %v, want %v", err, ErrExpired)
+	}
+	if _, err := (Signer{Key: []byte("other")}).Verify("book/episode-001.mp3", q, now); err != ErrSignature {
+		t.Errorf("Verify() with another key = %v, want %v", err, ErrSignature)
+	}
+	q.Set(ParamTokenID, s.TokenID("forged"))
+	if _, err := s.Verify("book/episode-001.mp3", q, now); err != ErrSignature {
+		t.Errorf("Verify() with forged token = %v, want %v", err, ErrSignature)
+	}
+}
@@ -0,0 +1,3 @@
+module histrio/rssbook/pkg/access
+
+go 1.17
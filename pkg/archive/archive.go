@@ -0,0 +1,227 @@
+// Package archive extracts books from ZIP, tar and 7z archives into a
+// temporary folder
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/bzip2"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/histrio/rssbook/pkg/utils"
+)
+
+// Archive formats
+const (
+	formatZip      = "zip"
+	formatTar      = "tar"
+	formatTarGzip  = "tar.gz"
+	formatTarBzip2 = "tar.bz2"
+	format7z       = "7z"
+)
+
+// extensions map archive extensions to formats, longer ones go first
+var extensions = []struct {
+	ext    string
+	format string
+}{
+	{".tar.bz2", formatTarBzip2},
+	{".tar.gz", formatTarGzip},
+	{".tbz2", formatTarBzip2},
+	{".tgz", formatTarGzip},
+	{".tar", formatTar},
+	{".zip", formatZip},
+	{".7z", format7z},
+}
+
+// Exec runs the 7z command, 7z archives are extracted by it
+var Exec = utils.SimpleExec
+
+func format(path string) (string, string) {
+	lower := strings.ToLower(path)
+	for _, e := range extensions {
+		if strings.HasSuffix(lower, e.ext) {
+			return e.ext, e.format
+		}
+	}
+	return "", ""
+}
+
+// Supported tells whether the path names an archive of a known format
+func Supported(path string) bool {
+	_, f := format(path)
+	return f != ""
+}
+
+// Name returns the archive name without its extension, e.g. "Book" of
+// "/inbox/Book.tar.gz"
+func Name(path string) string {
+	name := filepath.Base(path)
+	ext, _ := format(name)
+	return name[:len(name)-len(ext)]
+}
+
+// wanted tells whether the entry is extracted: audio and order files
+func wanted(name string) bool {
+	if utils.IsAudio(name) {
+		return true
+	}
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".m3u", ".m3u8":
+		return true
+	}
+	return strings.EqualFold(filepath.Base(name), "order.txt")
+}
+
+// Extracted is an archive extracted into a temporary folder
+type Extracted struct {
+	// Dir holds extracted files. It is the top folder of the archive if
+	// everything is inside one.
+	Dir  string
+	temp string
+}
+
+// Close removes extracted files
+func (e *Extracted) Close() error {
+	return os.RemoveAll(e.temp)
+}
+
+// Extract extracts audio and order files of the archive into a new temporary
+// folder. Other files are skipped.
+func Extract(path string) (*Extracted, error) {
+	_, f := format(path)
+	if f == "" {
+		return nil, fmt.Errorf("%s: unknown archive format", path)
+	}
+	temp, err := ioutil.TempDir("", "rssbook_archive_")
+	if err != nil {
+		return nil, err
+	}
+	switch f {
+	case formatZip:
+		err = extractZip(path, temp)
+	case format7z:
+		err = extract7z(path, temp)
+	default:
+		err = extractTar(path, f, temp)
+	}
+	if err != nil {
+		os.RemoveAll(temp)
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &Extracted{Dir: top(temp), temp: temp}, nil
+}
+
+// top returns the only folder inside dir, or dir itself
+func top(dir string) string {
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) != 1 || !entries[0].IsDir() {
+		return dir
+	}
+	return filepath.Join(dir, entries[0].Name())
+}
+
+// target returns the path of an entry inside dir, entries escaping it are
+// refused
+func target(dir string, name string) (string, error) {
+	clean := filepath.Clean(filepath.FromSlash(name))
+	if filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s: entry outside of the archive", name)
+	}
+	return filepath.Join(dir, clean), nil
+}
+
+// write copies an entry into dir
+func write(dir string, name string, r io.Reader) error {
+	path, err := target(dir, name)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func extractZip(path string, dir string) error {
+	z, err := zip.OpenReader(path)
+	if err != nil {
+		return err
+	}
+	defer z.Close()
+	for _, entry := range z.File {
+		if !entry.Mode().IsRegular() || !wanted(entry.Name) {
+			continue
+		}
+		r, err := entry.Open()
+		if err != nil {
+			return err
+		}
+		err = write(dir, entry.Name, r)
+		r.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func extractTar(path string, f string, dir string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	var r io.Reader = file
+	switch f {
+	case formatTarGzip:
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	case formatTarBzip2:
+		r = bzip2.NewReader(file)
+	}
+	t := tar.NewReader(r)
+	for {
+		header, err := t.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !header.FileInfo().Mode().IsRegular() || !wanted(header.Name) {
+			continue
+		}
+		if err := write(dir, header.Name, t); err != nil {
+			return err
+		}
+	}
+}
+
+func extract7z(path string, dir string) error {
+	// 7z wildcards match the case as it is
+	args := []string{"x", "-y", "-r", "-o" + dir, "--", path}
+	for _, ext := range utils.AudioExtensions {
+		args = append(args, "*"+ext, "*"+strings.ToUpper(ext))
+	}
+	_, err := Exec("7z", append(args, "*.m3u", "*.m3u8", "order.txt")...)
+	return err
+}
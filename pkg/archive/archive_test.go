@@ -0,0 +1,189 @@
+package archive
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/histrio/rssbook/pkg/utils"
+)
+
+// entries are files of test archives, names ending with a slash are folders
+var entries = []struct {
+	name string
+	body string
+}{
+	{"Book/", ""},
+	{"Book/01.mp3", "one"},
+	{"Book/Disc 2/02.mp3", "two"},
+	{"Book/Track03.MP3", "three"},
+	{"Book/04.flac", "four"},
+	{"Book/order.txt", "Disc 2/02.mp3\n01.mp3\n"},
+	{"Book/cover.jpg", "jpeg"},
+}
+
+func writeZip(t *testing.T, path string, names ...string) {
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	z := zip.NewWriter(f)
+	for _, e := range entries {
+		w, err := z.Create(e.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(w, e.body)
+	}
+	for _, name := range names {
+		w, err := z.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.WriteString(w, name)
+	}
+	if err := z.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+}
+
+func writeTarGz(t *testing.T, path string) {
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz := gzip.NewWriter(f)
+	w := tar.NewWriter(gz)
+	w.WriteHeader(&tar.Header{Name: "Book/link.mp3", Typeflag: tar.TypeSymlink, Linkname: "/etc/passwd"})
+	for _, e := range entries {
+		if strings.HasSuffix(e.name, "/") {
+			w.WriteHeader(&tar.Header{Name: e.name, Typeflag: tar.TypeDir, Mode: 0755})
+			continue
+		}
+		w.WriteHeader(&tar.Header{Name: e.name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(e.body))})
+		io.WriteString(w, e.body)
+	}
+	w.Close()
+	gz.Close()
+	f.Close()
+}
+
+// files returns extracted files with their content
+func files(t *testing.T, dir string) map[string]string {
+	found := map[string]string{}
+	filepath.Walk(dir, func(path string, f os.FileInfo, err error) error {
+		if err != nil || f.IsDir() {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rel, _ := filepath.Rel(dir, path)
+		found[filepath.ToSlash(rel)] = string(data)
+		return nil
+	})
+	return found
+}
+
+func TestExtract(t *testing.T) {
+	dir := t.TempDir()
+	zipped, tarred := filepath.Join(dir, "War and Peace.zip"), filepath.Join(dir, "War and Peace.TAR.GZ")
+	writeZip(t, zipped)
+	writeTarGz(t, tarred)
+	want := map[string]string{"01.mp3": "one", "Disc 2/02.mp3": "two", "Track03.MP3": "three", "04.flac": "four", "order.txt": "Disc 2/02.mp3\n01.mp3\n"}
+	for _, path := range []string{zipped, tarred} {
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			if !Supported(path) || Name(path) != "War and Peace" {
+				t.Errorf("Supported() = %v, Name() = %q", Supported(path), Name(path))
+			}
+			e, err := Extract(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if filepath.Base(e.Dir) != "Book" {
+				t.Errorf("Dir = %s, want the top folder", e.Dir)
+			}
+			if got := files(t, e.Dir); !reflect.DeepEqual(got, want) {
+				t.Errorf("extracted %v, want %v", got, want)
+			}
+			// Extensions match in any case, as they do on extraction
+			sources := []string{}
+			found, err := utils.GetFiles(e.Dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, f := range found {
+				rel, _ := filepath.Rel(e.Dir, string(f))
+				sources = append(sources, filepath.ToSlash(rel))
+			}
+			if want := []string{"01.mp3", "04.flac", "Disc 2/02.mp3", "Track03.MP3"}; !reflect.DeepEqual(sources, want) {
+				t.Errorf("GetFiles() = %q, want %q", sources, want)
+			}
+			if err := e.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := os.Stat(e.temp); !os.IsNotExist(err) {
+				t.Errorf("extracted files are not removed: %v", err)
+			}
+		})
+	}
+}
+
+func TestExtractErrors(t *testing.T) {
+	dir, tmp := t.TempDir(), t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+	for _, name := range []string{"../escape.mp3", "/abs.mp3"} {
+		path := filepath.Join(dir, "slip.zip")
+		writeZip(t, path, name)
+		if e, err := Extract(path); err == nil {
+			e.Close()
+			t.Errorf("entry %q extracted", name)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "escape.mp3")); !os.IsNotExist(err) {
+		t.Error("entry escaped the archive")
+	}
+	broken := filepath.Join(dir, "broken.tgz")
+	os.WriteFile(broken, []byte("not gzip"), 0644)
+	if _, err := Extract(broken); err == nil {
+		t.Error("broken archive extracted")
+	}
+	if _, err := Extract(filepath.Join(dir, "book.rar")); err == nil || Supported("book.rar") {
+		t.Error("unknown format extracted")
+	}
+	if left, _ := os.ReadDir(tmp); len(left) != 0 {
+		t.Errorf("%d temporary folders left after failed extractions", len(left))
+	}
+}
+
+func TestExtract7z(t *testing.T) {
+	defer func(exec func(string, ...string) (string, error)) { Exec = exec }(Exec)
+	var args []string
+	Exec = func(name string, arg ...string) (string, error) {
+		args = append([]string{name}, arg...)
+		out := strings.TrimPrefix(arg[3], "-o")
+		return "", os.WriteFile(filepath.Join(out, "01.mp3"), []byte("one"), 0644)
+	}
+	e, err := Extract("/inbox/-book.7z")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+	if got := files(t, e.Dir); !reflect.DeepEqual(got, map[string]string{"01.mp3": "one"}) {
+		t.Errorf("extracted %v", got)
+	}
+	if got := strings.Join(args[5:7], " "); got != "-- /inbox/-book.7z" {
+		t.Errorf("7z %v", args[1:])
+	}
+	if got := strings.Join(args, " "); !strings.Contains(got, "*.m4b *.M4B") || !strings.Contains(got, "*.flac *.FLAC") {
+		t.Errorf("7z %v, want audio files of every format", args[1:])
+	}
+}
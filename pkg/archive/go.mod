@@ -0,0 +1,3 @@
+module histrio/rssbook/pkg/archive
+
+go 1.17
@@ -1,38 +1,136 @@
 package audio
 
 import (
-	"bufio"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"math"
 	"os"
+	"path/filepath"
 	"regexp"
 	"sort"
 	"strings"
 	"time"
 
 	"github.com/histrio/rssbook/pkg/loggers"
+	"github.com/histrio/rssbook/pkg/probe"
+	"github.com/histrio/rssbook/pkg/progress"
 	"github.com/histrio/rssbook/pkg/utils"
 )
 
+// Pipeline runs stages converting audio files into episodes. The zero value
+// runs commands on the system without logging and tracking progress.
+type Pipeline struct {
+	// Exec runs ffmpeg and ffprobe, System if nil
+	Exec Executor
+	// Probe reads durations and tags without ffprobe, probe.File if nil.
+	// ffprobe is used when it fails
+	Probe func(name string) (probe.Info, error)
+	// Loudnorm normalizes loudness of episodes, off if nil
+	Loudnorm *Loudnorm
+	// Durations holds already probed durations of source files, the
+	// splitter probes missing ones
+	Durations map[utils.FileName]time.Duration
+	Log       *loggers.Logger
+	Progress  *progress.Tracker
+}
+
+func (p Pipeline) exec(name string, arg ...string) (string, error) {
+	if p.Exec == nil {
+		return System.Exec(name, arg...)
+	}
+	return p.Exec.Exec(name, arg...)
+}
+
+// probe reads the file natively, ok is false if ffprobe is needed
+func (p Pipeline) probe(filename utils.FileName) (info probe.Info, ok bool) {
+	read := p.Probe
+	if read == nil {
+		read = probe.File
+	}
+	info, err := read(string(filename))
+	if err != nil {
+		p.Log.Debug("Falling back to ffprobe", "err", err)
+		return info, false
+	}
+	return info, true
+}
+
 // GetDuration Calculate duration of audio file
-func GetDuration(filename utils.FileName) time.Duration {
-	durationRaw, err := utils.SimpleExec("ffprobe", "-i", string(filename), "-show_entries", "format=duration", "-v", "quiet", "-of", "csv")
-	utils.Check(err)
-	durationString := strings.TrimSuffix(strings.Split(durationRaw, ",")[1], "\n") + "s"
-	duration, err := time.ParseDuration(durationString)
-	utils.Check(err)
-	return duration
+func (p Pipeline) GetDuration(filename utils.FileName) (time.Duration, error) {
+	if info, ok := p.probe(filename); ok && info.Duration > 0 {
+		return info.Duration, nil
+	}
+	durationRaw, err := p.exec("ffprobe", "-i", fileArg(string(filename)), "-show_entries", "format=duration", "-v", "quiet", "-of", "csv")
+	if err != nil {
+		return 0, fmt.Errorf("ffprobe: %w", err)
+	}
+	fields := strings.Split(strings.TrimSpace(durationRaw), ",")
+	if len(fields) < 2 {
+		return 0, fmt.Errorf("no duration in ffprobe output %q", durationRaw)
+	}
+	duration, err := time.ParseDuration(fields[1] + "s")
+	if err != nil {
+		return 0, fmt.Errorf("ffprobe output: %w", err)
+	}
+	return duration, nil
+}
+
+// GetTags returns format tags of audio file, tag names are lower cased
+func (p Pipeline) GetTags(filename utils.FileName) (map[string]string, error) {
+	if info, ok := p.probe(filename); ok {
+		if info.Tags == nil {
+			return map[string]string{}, nil
+		}
+		return info.Tags, nil
+	}
+	result, err := p.exec("ffprobe", "-loglevel", "error", "-print_format", "json", "-show_entries", "format_tags:stream_tags", fileArg(string(filename)))
+	if err != nil {
+		return nil, fmt.Errorf("ffprobe: %w", err)
+	}
+	return parseTags(result)
+}
+
+// parseTags returns tags of ffprobe JSON output. Format tags take precedence
+// over stream ones, e.g. Ogg files keep tags in the stream.
+func parseTags(output string) (map[string]string, error) {
+	var probed struct {
+		Streams []struct {
+			Tags map[string]string `json:"tags"`
+		} `json:"streams"`
+		Format struct {
+			Tags map[string]string `json:"tags"`
+		} `json:"format"`
+	}
+	if err := json.Unmarshal([]byte(output), &probed); err != nil {
+		return nil, fmt.Errorf("ffprobe output: %w", err)
+	}
+	tags := map[string]string{}
+	add := func(from map[string]string) {
+		for name, value := range from {
+			name = strings.ToLower(name)
+			if _, ok := tags[name]; !ok {
+				tags[name] = value
+			}
+		}
+	}
+	add(probed.Format.Tags)
+	for _, stream := range probed.Streams {
+		add(stream.Tags)
+	}
+	return tags, nil
 }
 
 // GetSilences returns silences in file
-func GetSilences(filename utils.FileName) []utils.Silence {
+func (p Pipeline) GetSilences(filename utils.FileName) ([]utils.Silence, error) {
 	rStart := regexp.MustCompile(`silence_start: (\d+(\.\d+)?)`)
 	rEndDuration := regexp.MustCompile(`silence_end: (\d+(\.\d+)?) \| silence_duration: (\d+(\.\d+)?)`)
 
 	var result []utils.Silence
-	res, err := utils.SimpleExec("ffmpeg", "-i", string(filename), "-af", "silencedetect=noise=-40dB:d=0.4", "-f", "null", "-")
-	utils.Check(err)
+	res, err := p.exec("ffmpeg", "-i", fileArg(string(filename)), "-af", "silencedetect=noise=-40dB:d=0.4", "-f", "null", "-")
+	if err != nil {
+		return nil, fmt.Errorf("silence detection: %w", err)
+	}
 	var silence utils.Silence
 	silence = utils.Silence{}
 	for _, s := range strings.Split(res, "\n") {
@@ -50,10 +148,10 @@ func GetSilences(filename utils.FileName) []utils.Silence {
 			}
 		}
 	}
-	return result
+	return result, nil
 }
 
-func alignSilence(silences []utils.Silence, t time.Duration) time.Duration {
+func alignSilence(log *loggers.Logger, silences []utils.Silence, t time.Duration) time.Duration {
 
 	type Distance struct {
 		t time.Duration
@@ -76,20 +174,53 @@ func alignSilence(silences []utils.Silence, t time.Duration) time.Duration {
 	if len(distances) > 0 {
 		return distances[0].t
 	}
-	loggers.Warning.Printf("No silence was aligned.")
+	log.Warning("No silence was aligned", "at", t)
 	return t
 }
 
+// Plan is a split plan of an episode or the error that stopped splitting
+type Plan struct {
+	Splits utils.SplitPlan
+	Err    error
+}
+
+// Episode is an episode file or the error that stopped a stage. Nothing
+// follows an error.
+type Episode struct {
+	File utils.FileName
+	Err  error
+}
+
 // GetSplittedEpisodes returns split plan
-func GetSplittedEpisodes(in <-chan utils.FileName, limitMin int) chan utils.SplitPlan {
+func (p Pipeline) GetSplittedEpisodes(in <-chan utils.FileName, limitMin int) chan Plan {
 	episodeLimit := time.Duration(limitMin) * time.Minute
-	plan := make(chan utils.SplitPlan)
+	plan := make(chan Plan)
 	go func() {
+		defer close(plan)
 		splits := []utils.FileSplit{}
 		debt := time.Duration(0)
+		var err error
 		for f := range in {
-			silences := GetSilences(f)
-			duration := GetDuration(f)
+			// The rest of files is drained so the sender isn't blocked
+			if err != nil {
+				continue
+			}
+			log := p.Log.With("file", string(f))
+			log.Info("Processing")
+			var silences []utils.Silence
+			var duration time.Duration
+			silences, err = p.GetSilences(f)
+			if d, ok := p.Durations[f]; ok {
+				duration = d
+			} else if err == nil {
+				duration, err = p.GetDuration(f)
+			}
+			if err != nil {
+				err = fmt.Errorf("%s: %w", f, err)
+				plan <- Plan{Err: err}
+				continue
+			}
+			p.Progress.Step(progress.Silences, string(f), 0)
 			t0 := time.Duration(0)
 
 			// If debt exists
@@ -97,16 +228,16 @@ func GetSplittedEpisodes(in <-chan utils.FileName, limitMin int) chan utils.Spli
 				// And if debt less then duration we will make a split,
 				// fill the debt and start a new split
 				if debt <= duration {
-					to := alignSilence(silences, t0+debt)
+					to := alignSilence(log, silences, t0+debt)
 					splits = append(splits, utils.FileSplit{
 						InputFile: f,
 						From:      t0,
 						To:        to})
-					loggers.Debug.Printf("%+v fills debt (part file) [%+v - %+v] and episode fulfilled", f, t0, to)
+					log.Debug("Fills debt (part file) and episode fulfilled", "from", t0, "to", to)
 
-					plan <- splits
+					plan <- Plan{Splits: splits}
 					splits = []utils.FileSplit{}
-					t0 = alignSilence(silences, debt)
+					t0 = alignSilence(log, silences, debt)
 					debt = time.Duration(0)
 				}
 				// And if debt more then file duration we will take all file and decrease
@@ -116,22 +247,22 @@ func GetSplittedEpisodes(in <-chan utils.FileName, limitMin int) chan utils.Spli
 						InputFile: f,
 						From:      t0,
 						To:        duration})
-					loggers.Debug.Printf("%+v fills debt (full file) [%+v - %+v]", f, t0, duration)
+					log.Debug("Fills debt (full file)", "from", t0, "to", duration)
 					debt = debt - duration
 					continue
 				}
 			}
 			// If episode length fits in current file
 			for (t0 + episodeLimit) < duration {
-				to := alignSilence(silences, t0+episodeLimit)
+				to := alignSilence(log, silences, t0+episodeLimit)
 				splits = append(splits, utils.FileSplit{
 					InputFile: f,
 					From:      t0,
 					To:        to})
-				loggers.Debug.Printf("%+v bigger than need [%+v - %+v] and episode fulfilled", f, t0, to)
-				plan <- splits
+				log.Debug("Bigger than need and episode fulfilled", "from", t0, "to", to)
+				plan <- Plan{Splits: splits}
 				splits = []utils.FileSplit{}
-				t0 = alignSilence(silences, t0+episodeLimit)
+				t0 = alignSilence(log, silences, t0+episodeLimit)
 			}
 			// Take all the rest as a split
 			splits = append(splits, utils.FileSplit{
@@ -139,94 +270,176 @@ func GetSplittedEpisodes(in <-chan utils.FileName, limitMin int) chan utils.Spli
 				From:      t0,
 				To:        duration})
 			debt = episodeLimit - (duration - t0)
-			loggers.Debug.Printf("%+v takes the rest [%+v - %+v] and leaves the debt %+v", f, t0, duration, debt)
+			log.Debug("Takes the rest and leaves the debt", "from", t0, "to", duration, "debt", debt)
+		}
+		if err == nil {
+			plan <- Plan{Splits: splits}
 		}
-		plan <- splits
-		close(plan)
 	}()
 
 	return plan
 }
 
-// GetMergedEpisodes merge and return by split plan
-func GetMergedEpisodes(in <-chan utils.SplitPlan) chan utils.FileName {
-	c := make(chan utils.FileName)
-	go func() {
-		for episode := range in {
-			listFile, err := ioutil.TempFile(os.TempDir(), "rssbook_mergelist_")
-			utils.Check(err)
-			temp := []string{}
-			for _, split := range episode {
-				tempFile, err := ioutil.TempFile(os.TempDir(), "rssbook_split_")
-				utils.Check(err)
-				name := tempFile.Name()
-				temp = append(temp, name)
-				utils.SimpleExec("ffmpeg", "-y", "-i", string(split.InputFile), "-acodec", "copy", "-f", "mp3",
-					"-ss", utils.FormatDuration(split.From),
-					"-to", utils.FormatDuration(split.To),
-					"-write_xing", "0", name)
-				utils.Check(err)
-				listFile.WriteString(fmt.Sprintf("file '%v'\n", name))
+// fileArg returns the file name as ffmpeg should get it. A relative name
+// with a colon is taken for a protocol otherwise, e.g. "Part 1: Intro.mp3"
+func fileArg(name string) string {
+	if strings.Contains(name, ":") && !filepath.IsAbs(name) {
+		return "." + string(filepath.Separator) + name
+	}
+	return name
+}
+
+// concatFile returns a concat list line of the file. Nothing is escaped
+// between single quotes, so a quote closes the string, goes escaped and opens
+// it again. The list is read by lines, a name can't have a line break.
+func concatFile(name string) string {
+	return "file '" + strings.ReplaceAll(name, "'", `'\''`) + "'\n"
+}
+
+// copied tells whether the splits are cut without decoding. Only mp3 sources
+// left as they are can be copied, other parts are decoded to be joined.
+func (p Pipeline) copied(splits utils.SplitPlan) bool {
+	if p.Loudnorm != nil {
+		return false
+	}
+	for _, split := range splits {
+		if strings.ToLower(filepath.Ext(string(split.InputFile))) != ".mp3" {
+			return false
+		}
+	}
+	return true
+}
+
+// merge cuts the splits and joins them into a temporary file
+func (p Pipeline) merge(splits utils.SplitPlan) (utils.FileName, error) {
+	copied := p.copied(splits)
+	listFile, err := ioutil.TempFile(os.TempDir(), "rssbook_mergelist_")
+	if err != nil {
+		return "", err
+	}
+	temp := []string{listFile.Name()}
+	defer func() {
+		go func() {
+			for _, item := range temp {
+				os.Remove(item)
 			}
+		}()
+	}()
+	for _, split := range splits {
+		tempFile, err := ioutil.TempFile(os.TempDir(), "rssbook_split_")
+		if err != nil {
 			listFile.Close()
-			ep, err := ioutil.TempFile(os.TempDir(), "rssbook_concat_")
-			utils.Check(err)
-			utils.SimpleExec("ffmpeg", "-y", "-f", "concat", "-safe", "0", "-i", listFile.Name(), "-f", "mp3", "-c", "copy", ep.Name())
-			utils.Check(err)
-
-			go func() {
-				os.Remove(listFile.Name())
-				for _, item := range temp {
-					os.Remove(item)
-				}
-			}()
+			return "", err
+		}
+		tempFile.Close()
+		name := tempFile.Name()
+		temp = append(temp, name)
+		args := append([]string{"-y", "-i", fileArg(string(split.InputFile))}, p.Loudnorm.cutArgs(split.InputFile, copied)...)
+		args = append(args, "-ss", utils.FormatDuration(split.From), "-to", utils.FormatDuration(split.To))
+		if copied {
+			args = append(args, "-write_xing", "0")
+		}
+		if _, err := p.exec("ffmpeg", append(args, fileArg(name))...); err != nil {
+			listFile.Close()
+			return "", fmt.Errorf("cut of %s: %w", split.InputFile, err)
+		}
+		// Parts are next to the list, so the temporary directory
+		// path doesn't get into it
+		listFile.WriteString(concatFile(filepath.Base(name)))
+	}
+	if err := listFile.Close(); err != nil {
+		return "", err
+	}
+	ep, err := ioutil.TempFile(os.TempDir(), "rssbook_concat_")
+	if err != nil {
+		return "", err
+	}
+	ep.Close()
+	// Decoded parts are joined as they are, the episode is encoded once
+	format := "mp3"
+	if !copied {
+		format = "wav"
+	}
+	if _, err := p.exec("ffmpeg", "-y", "-f", "concat", "-safe", "0", "-i", fileArg(listFile.Name()), "-f", format, "-c", "copy", fileArg(ep.Name())); err != nil {
+		os.Remove(ep.Name())
+		return "", fmt.Errorf("merge: %w", err)
+	}
+	return utils.FileName(ep.Name()), nil
+}
 
-			c <- utils.FileName(ep.Name())
+// GetMergedEpisodes merge and return by split plan
+func (p Pipeline) GetMergedEpisodes(in <-chan Plan) chan Episode {
+	c := make(chan Episode)
+	go func() {
+		defer close(c)
+		pos := 0
+		failed := false
+		for plan := range in {
+			if failed {
+				continue
+			}
+			if plan.Err != nil {
+				failed = true
+				c <- Episode{Err: plan.Err}
+				continue
+			}
+			pos++
+			log := p.Log.With("episode", pos)
+			ep, err := p.merge(plan.Splits)
+			if err != nil {
+				failed = true
+				c <- Episode{Err: fmt.Errorf("episode %d: %w", pos, err)}
+				continue
+			}
+			log.Debug("Merged", "parts", len(plan.Splits))
+			p.Progress.Step(progress.Merge, string(ep), 0)
+			c <- Episode{File: ep}
 		}
-		close(c)
 	}()
 	return c
 }
 
+// compress encodes the episode into a temporary mp3 file
+func (p Pipeline) compress(ep utils.FileName) (utils.FileName, error) {
+	out, err := ioutil.TempFile(os.TempDir(), "rssbook_compress_")
+	if err != nil {
+		return "", err
+	}
+	out.Close()
+	if _, err := p.exec("ffmpeg", "-y", "-i", fileArg(string(ep)), "-codec:a", "libmp3lame", "-qscale:a", "8", "-f", "mp3", fileArg(out.Name())); err != nil {
+		os.Remove(out.Name())
+		return "", fmt.Errorf("encoding: %w", err)
+	}
+	return utils.FileName(out.Name()), nil
+}
+
 // GetCompressedEpisodes compress audio files
-func GetCompressedEpisodes(in <-chan utils.FileName) chan utils.FileName {
-	c := make(chan utils.FileName)
+func (p Pipeline) GetCompressedEpisodes(in <-chan Episode) chan Episode {
+	c := make(chan Episode)
 	go func() {
+		defer close(c)
+		pos := 0
+		failed := false
 		for ep := range in {
-			listFile, err := ioutil.TempFile(os.TempDir(), "rssbook_compress_")
-			utils.Check(err)
-			utils.SimpleExec("ffmpeg", "-y", "-i", string(ep), "-codec:a", "libmp3lame", "-qscale:a", "8", "-f", "mp3", listFile.Name())
-			utils.Check(err)
-			go os.Remove(string(ep))
-			c <- utils.FileName(listFile.Name())
+			if failed {
+				continue
+			}
+			if ep.Err != nil {
+				failed = true
+				c <- ep
+				continue
+			}
+			pos++
+			compressed, err := p.compress(ep.File)
+			go os.Remove(string(ep.File))
+			if err != nil {
+				failed = true
+				c <- Episode{Err: fmt.Errorf("episode %d: %w", pos, err)}
+				continue
+			}
+			p.Progress.Step(progress.Encode, string(compressed), 0)
+			c <- Episode{File: compressed}
 		}
-		close(c)
 	}()
 	return c
 }
-
-func getAudioMeta(file utils.FileName) utils.AudioMeta {
-	metaFile, err := ioutil.TempFile(os.TempDir(), "rssbook_meta_")
-	defer metaFile.Close()
-	defer os.Remove(metaFile.Name())
-	utils.Check(err)
-	utils.SimpleExec("ffmpeg", "-y", "-i", string(file), "-f", "ffmetadata", metaFile.Name())
-	utils.Check(err)
-	f, err := os.Open(metaFile.Name())
-	utils.Check(err)
-	scanner := bufio.NewScanner(f)
-	result := utils.AudioMeta{}
-	for scanner.Scan() {
-		line := strings.SplitN(scanner.Text(), "=", 2)
-		if len(line) == 2 {
-			attr, value := line[0], line[1]
-			switch attr {
-			case "artist":
-				result.Author = value
-			case "album":
-				result.Title = value
-			}
-		}
-	}
-	return result
-}
@@ -1 +1,115 @@
 package audio
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/histrio/rssbook/pkg/utils"
+)
+
+func TestParseTags(t *testing.T) {
+	tags, err := parseTags(`{
+	"programs": [],
+	"streams": [{"tags": {"TITLE": "Stream title", "language": "eng"}}],
+	"format": {"tags": {"title": "Smith, John: Book", "ARTIST": "Smith, John", "series-part": "2"}}
+}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"title": "Smith, John: Book", "artist": "Smith, John", "series-part": "2", "language": "eng"}
+	if !reflect.DeepEqual(tags, want) {
+		t.Errorf("parseTags() = %v, want %v", tags, want)
+	}
+	if _, err := parseTags("TAG:title=Book"); err == nil {
+		t.Error("parseTags() of plain output succeeded")
+	}
+}
+
+func TestMergeMetadata(t *testing.T) {
+	files := []Metadata{
+		MetadataFromTags(map[string]string{"album": "Book", "title": "Chapter 1", "artist": "Smith, John", "language": "eng"}),
+		MetadataFromTags(map[string]string{"album": "Book", "title": "Chapter 2", "artist": "Narrator", "composer": "Narrator"}),
+		MetadataFromTags(map[string]string{"album": "Book (bonus)", "title": "Chapter 3", "artist": "Smith, John", "comment": "A book"}),
+	}
+	got := MergeMetadata(files)
+	want := Metadata{
+		Album:    "Book",
+		Title:    "Chapter 1",
+		Artist:   "Smith, John",
+		Narrator: "Narrator",
+		Comment:  "A book",
+		Language: "en",
+		Tags: map[string]string{
+			"album": "Book", "title": "Chapter 1", "artist": "Smith, John",
+			"language": "eng", "composer": "Narrator", "comment": "A book",
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("MergeMetadata() = %+v\nwant %+v", got, want)
+	}
+	if got := MergeMetadata(nil); !reflect.DeepEqual(got, Metadata{Tags: map[string]string{}}) {
+		t.Errorf("MergeMetadata(nil) = %+v", got)
+	}
+}
+
+func TestLanguage(t *testing.T) {
+	for value, want := range map[string]string{"eng": "en", " RUS ": "ru", "de": "de", "pt-BR": "pt-br", "English": "", "xyz": "", "": ""} {
+		if got := language(value); got != want {
+			t.Errorf("language(%q) = %q, want %q", value, got, want)
+		}
+	}
+}
+
+func TestFileArg(t *testing.T) {
+	for name, want := range map[string]string{
+		"a.mp3":             "a.mp3",
+		"Part 1: Intro.mp3": "./Part 1: Intro.mp3",
+		"book/1: a.mp3":     "./book/1: a.mp3",
+		"/tmp/1: a.mp3":     "/tmp/1: a.mp3",
+		"-dash.mp3":         "-dash.mp3",
+	} {
+		if got := fileArg(name); got != want {
+			t.Errorf("fileArg(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestConcatFile(t *testing.T) {
+	for name, want := range map[string]string{
+		"rssbook_split_1": "file 'rssbook_split_1'\n",
+		"it's.mp3":        `file 'it'\''s.mp3'` + "\n",
+		"''":              `file ''\'''\'''` + "\n",
+		`a \ "b".mp3`:     `file 'a \ "b".mp3'` + "\n",
+	} {
+		if got := concatFile(name); got != want {
+			t.Errorf("concatFile(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestAlignSilence(t *testing.T) {
+	silences := []utils.Silence{
+		{Start: 100 * time.Second, End: 102 * time.Second, Duration: 2 * time.Second},
+		{Start: 250 * time.Second, End: 254 * time.Second, Duration: 4 * time.Second},
+	}
+	tests := []struct {
+		name     string
+		silences []utils.Silence
+		t        time.Duration
+		want     time.Duration
+	}{
+		{"middle of the nearest silence", silences, 101 * time.Second, 101 * time.Second},
+		{"silence after the point", silences, 240 * time.Second, 252 * time.Second},
+		{"silences too far", silences, 400 * time.Second, 400 * time.Second},
+		{"silence right at the point is skipped", silences, 100*time.Second + 50*time.Millisecond, 100*time.Second + 50*time.Millisecond},
+		{"no silences", nil, 60 * time.Second, 60 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := alignSilence(nil, tt.silences, tt.t); got != tt.want {
+				t.Errorf("alignSilence() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
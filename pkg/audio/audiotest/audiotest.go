@@ -0,0 +1,182 @@
+// Package audiotest records commands run by the audio pipeline and replays
+// their output, so stages can be tested without ffmpeg
+package audiotest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/histrio/rssbook/pkg/audio"
+)
+
+// Any matches any argument of a replayed call
+const Any = "*"
+
+// Call is a command with its output
+type Call struct {
+	Name   string   `json:"name"`
+	Args   []string `json:"args"`
+	Output string   `json:"output"`
+	Error  string   `json:"error,omitempty"`
+}
+
+func (c Call) matches(name string, args []string) bool {
+	if c.Name != name || len(c.Args) != len(args) {
+		return false
+	}
+	for i, arg := range c.Args {
+		if arg != Any && arg != args[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Recorder runs commands with the executor and keeps them with their output
+type Recorder struct {
+	// Executor runs commands, audio.System if nil
+	Executor audio.Executor
+
+	mu    sync.Mutex
+	calls []Call
+}
+
+// tempArg tells whether the argument is a temporary file of the pipeline,
+// its name changes from run to run
+func tempArg(arg string) bool {
+	return strings.HasPrefix(arg, filepath.Join(os.TempDir(), "rssbook_"))
+}
+
+// Exec runs the command and records it. Temporary files are recorded as Any.
+func (r *Recorder) Exec(name string, arg ...string) (string, error) {
+	executor := r.Executor
+	if executor == nil {
+		executor = audio.System
+	}
+	output, err := executor.Exec(name, arg...)
+	call := Call{Name: name, Output: output}
+	for _, a := range arg {
+		if tempArg(a) {
+			a = Any
+		}
+		call.Args = append(call.Args, a)
+	}
+	if err != nil {
+		call.Error = err.Error()
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = append(r.calls, call)
+	return output, err
+}
+
+// Calls returns recorded calls in order they were run
+func (r *Recorder) Calls() []Call {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Call{}, r.calls...)
+}
+
+// Save writes recorded calls as JSON, Load replays them
+func (r *Recorder) Save(path string) error {
+	content, err := json.MarshalIndent(r.Calls(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(content, '\n'), 0644)
+}
+
+// Replayer returns output of recorded calls instead of running commands. Each
+// call is replayed once, the earliest matching one goes first.
+type Replayer struct {
+	mu    sync.Mutex
+	calls []Call
+	used  []bool
+}
+
+// NewReplayer replays the calls
+func NewReplayer(calls ...Call) *Replayer {
+	return &Replayer{calls: calls, used: make([]bool, len(calls))}
+}
+
+// Load replays calls saved by a recorder
+func Load(path string) (*Replayer, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var calls []Call
+	if err := json.Unmarshal(content, &calls); err != nil {
+		return nil, fmt.Errorf("%s: %s", path, err)
+	}
+	return NewReplayer(calls...), nil
+}
+
+// Exec returns output of a matching recorded call, it fails on unknown
+// commands
+func (r *Replayer) Exec(name string, arg ...string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, call := range r.calls {
+		if r.used[i] || !call.matches(name, arg) {
+			continue
+		}
+		r.used[i] = true
+		if call.Error != "" {
+			return call.Output, errors.New(call.Error)
+		}
+		return call.Output, nil
+	}
+	return "", fmt.Errorf("audiotest: unexpected call %s %s", name, strings.Join(arg, " "))
+}
+
+// Unused returns calls which were not replayed
+func (r *Replayer) Unused() []Call {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	unused := []Call{}
+	for i, call := range r.calls {
+		if !r.used[i] {
+			unused = append(unused, call)
+		}
+	}
+	return unused
+}
+
+// Duration returns a call of ffprobe reporting the duration of the file in
+// seconds
+func Duration(file string, seconds float64) Call {
+	return Call{
+		Name:   "ffprobe",
+		Args:   []string{"-i", file, "-show_entries", "format=duration", "-v", "quiet", "-of", "csv"},
+		Output: fmt.Sprintf("format,%f\n", seconds),
+	}
+}
+
+// Silence is a silent interval in seconds
+type Silence struct {
+	Start float64
+	End   float64
+}
+
+// Silences returns a call of ffmpeg detecting the silences in the file, the
+// output is surrounded by usual ffmpeg noise
+func Silences(file string, silences ...Silence) Call {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Input #0, mp3, from '%s':\n  Duration: N/A, start: 0.025057, bitrate: 64 kb/s\n", file)
+	for _, s := range silences {
+		fmt.Fprintf(&b, "[silencedetect @ 0x55d0c4a4e1c0] silence_start: %.3f\n", s.Start)
+		fmt.Fprintf(&b, "[silencedetect @ 0x55d0c4a4e1c0] silence_end: %.3f | silence_duration: %.3f\n", s.End, s.End-s.Start)
+	}
+	b.WriteString("size=N/A time=00:10:00.00 bitrate=N/A speed= 512x\n")
+	return Call{
+		Name:   "ffmpeg",
+		Args:   []string{"-i", file, "-af", "silencedetect=noise=-40dB:d=0.4", "-f", "null", "-"},
+		Output: b.String(),
+	}
+}
@@ -0,0 +1,183 @@
+package audiotest
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Segment is a sine tone or a silence when Tone is zero
+type Segment struct {
+	Tone     float64
+	Duration time.Duration
+}
+
+// Tones returns segments of the total duration: tones of the length
+// separated by silences of the gap, like speech with pauses
+func Tones(total, length, gap time.Duration) []Segment {
+	segments := []Segment{}
+	frequencies := []float64{440, 523.25, 659.25}
+	for d, i := time.Duration(0), 0; d < total; i++ {
+		tone := length
+		if d+tone > total {
+			tone = total - d
+		}
+		segments = append(segments, Segment{Tone: frequencies[i%len(frequencies)], Duration: tone})
+		d += tone
+		if d+gap >= total {
+			continue
+		}
+		segments = append(segments, Segment{Duration: gap})
+		d += gap
+	}
+	return segments
+}
+
+// Chapter is a named part of a fixture
+type Chapter struct {
+	Title string
+	Start time.Duration
+	End   time.Duration
+}
+
+// Fixture is an audio file synthesized by ffmpeg
+type Fixture struct {
+	// Name is a file name, its extension selects the format: .mp3, .flac,
+	// .m4a or .m4b
+	Name     string
+	Segments []Segment
+	Tags     map[string]string
+	Chapters []Chapter
+	// Cover embeds generated cover art
+	Cover bool
+}
+
+// Duration returns the length of the fixture
+func (f Fixture) Duration() time.Duration {
+	d := time.Duration(0)
+	for _, s := range f.Segments {
+		d += s.Duration
+	}
+	return d
+}
+
+// codecs are ffmpeg arguments encoding audio by extensions
+var codecs = map[string][]string{
+	".mp3":  {"-c:a", "libmp3lame", "-b:a", "64k", "-id3v2_version", "3", "-f", "mp3"},
+	".flac": {"-c:a", "flac", "-f", "flac"},
+	".m4a":  {"-c:a", "aac", "-b:a", "64k", "-f", "ipod"},
+	".m4b":  {"-c:a", "aac", "-b:a", "64k", "-f", "ipod"},
+}
+
+// Available tells whether ffmpeg and ffprobe are installed, fixtures can not
+// be written otherwise
+func Available() bool {
+	for _, name := range []string{"ffmpeg", "ffprobe"} {
+		if _, err := exec.LookPath(name); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+func seconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+// metadata returns the fixture's tags and chapters in the ffmetadata format
+func (f Fixture) metadata() string {
+	var b strings.Builder
+	b.WriteString(";FFMETADATA1\n")
+	keys := []string{}
+	for k := range f.Tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	escape := strings.NewReplacer(`\`, `\\`, "=", `\=`, ";", `\;`, "#", `\#`, "\n", "\\\n")
+	for _, k := range keys {
+		fmt.Fprintf(&b, "%s=%s\n", escape.Replace(k), escape.Replace(f.Tags[k]))
+	}
+	for _, c := range f.Chapters {
+		fmt.Fprintf(&b, "[CHAPTER]\nTIMEBASE=1/1000\nSTART=%d\nEND=%d\ntitle=%s\n",
+			c.Start.Milliseconds(), c.End.Milliseconds(), escape.Replace(c.Title))
+	}
+	return b.String()
+}
+
+// args returns ffmpeg arguments synthesizing the fixture into the file with
+// metadata read from the ffmetadata file
+func (f Fixture) args(file string, metadata string) []string {
+	args := []string{"-y", "-loglevel", "error"}
+	inputs := []string{}
+	for i, s := range f.Segments {
+		source := "anullsrc=r=44100:cl=mono"
+		if s.Tone > 0 {
+			source = fmt.Sprintf("sine=frequency=%g:sample_rate=44100", s.Tone)
+		}
+		args = append(args, "-f", "lavfi", "-t", seconds(s.Duration), "-i", source)
+		inputs = append(inputs, fmt.Sprintf("[%d:a]", i))
+	}
+	n := len(f.Segments)
+	args = append(args, "-i", metadata)
+	if f.Cover {
+		args = append(args, "-f", "lavfi", "-i", "color=c=steelblue:s=300x300:d=1")
+	}
+	args = append(args,
+		"-filter_complex", fmt.Sprintf("%sconcat=n=%d:v=0:a=1[a]", strings.Join(inputs, ""), n),
+		"-map", "[a]",
+		"-map_metadata", fmt.Sprint(n),
+		"-map_chapters", fmt.Sprint(n),
+	)
+	if f.Cover {
+		args = append(args, "-map", fmt.Sprintf("%d:v", n+1), "-frames:v", "1",
+			"-c:v", "mjpeg", "-disposition:v", "attached_pic")
+	}
+	args = append(args, codecs[strings.ToLower(filepath.Ext(f.Name))]...)
+	return append(args, file)
+}
+
+// Write synthesizes the fixture into the directory and returns its path
+func (f Fixture) Write(dir string) (string, error) {
+	if _, ok := codecs[strings.ToLower(filepath.Ext(f.Name))]; !ok {
+		return "", fmt.Errorf("%s: unsupported fixture format", f.Name)
+	}
+	if len(f.Segments) == 0 {
+		return "", fmt.Errorf("%s: no segments", f.Name)
+	}
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return "", err
+	}
+	meta, err := os.CreateTemp("", "audiotest_meta_")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(meta.Name())
+	_, err = meta.WriteString(f.metadata())
+	meta.Close()
+	if err != nil {
+		return "", err
+	}
+	file := filepath.Join(dir, f.Name)
+	output, err := exec.Command("ffmpeg", f.args(file, meta.Name())...).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("%s: %s: %s", f.Name, err, strings.TrimSpace(string(output)))
+	}
+	return file, nil
+}
+
+// Book writes the fixtures into the directory as a source folder of a book
+func Book(dir string, fixtures ...Fixture) ([]string, error) {
+	files := []string{}
+	for _, f := range fixtures {
+		file, err := f.Write(dir)
+		if err != nil {
+			return files, err
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
@@ -0,0 +1,81 @@
+package audiotest
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/histrio/rssbook/pkg/audio"
+	"github.com/histrio/rssbook/pkg/utils"
+)
+
+func TestTones(t *testing.T) {
+	segments := Tones(50*time.Second, 20*time.Second, time.Second)
+	want := []Segment{
+		{Tone: 440, Duration: 20 * time.Second},
+		{Duration: time.Second},
+		{Tone: 523.25, Duration: 20 * time.Second},
+		{Duration: time.Second},
+		{Tone: 659.25, Duration: 8 * time.Second},
+	}
+	if len(segments) != len(want) {
+		t.Fatalf("Tones() = %+v", segments)
+	}
+	for i := range want {
+		if segments[i] != want[i] {
+			t.Errorf("segment %d = %+v, want %+v", i, segments[i], want[i])
+		}
+	}
+	if d := (Fixture{Segments: segments}).Duration(); d != 50*time.Second {
+		t.Errorf("Duration() = %v", d)
+	}
+}
+
+func TestMetadata(t *testing.T) {
+	f := Fixture{
+		Tags:     map[string]string{"title": "Book = 1; #2", "artist": "Author"},
+		Chapters: []Chapter{{Title: "One", Start: 0, End: 1500 * time.Millisecond}},
+	}
+	want := ";FFMETADATA1\nartist=Author\ntitle=Book \\= 1\\; \\#2\n" +
+		"[CHAPTER]\nTIMEBASE=1/1000\nSTART=0\nEND=1500\ntitle=One\n"
+	if got := f.metadata(); got != want {
+		t.Errorf("metadata() = %q, want %q", got, want)
+	}
+	args := strings.Join(Fixture{Name: "a.flac", Segments: Tones(time.Second, time.Second, 0), Cover: true}.args("a.flac", "meta"), " ")
+	for _, part := range []string{"-t 1.000 -i sine=frequency=440", "[0:a]concat=n=1", "-map_chapters 1", "-map 2:v", "-c:a flac"} {
+		if !strings.Contains(args, part) {
+			t.Errorf("args %q miss %q", args, part)
+		}
+	}
+}
+
+func TestFixtureFormats(t *testing.T) {
+	if testing.Short() || !Available() {
+		t.Skip("ffmpeg is not available")
+	}
+	dir := t.TempDir()
+	p := audio.Pipeline{}
+	for _, name := range []string{"book.mp3", "book.flac", "book.m4b"} {
+		f := Fixture{
+			Name:     name,
+			Segments: Tones(10*time.Second, 3*time.Second, time.Second),
+			Tags:     map[string]string{"title": "Fixture", "artist": "Tester"},
+			Chapters: []Chapter{{Title: "One", End: 5 * time.Second}, {Title: "Two", Start: 5 * time.Second, End: 10 * time.Second}},
+			Cover:    true,
+		}
+		file, err := f.Write(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d, err := p.GetDuration(utils.FileName(file)); err != nil || math.Abs((d-f.Duration()).Seconds()) > 0.2 {
+			t.Errorf("%s: duration = %v, %v, want %v", name, d, err, f.Duration())
+		}
+		if tags, err := p.GetTags(utils.FileName(file)); err != nil || tags["title"] != "Fixture" || tags["artist"] != "Tester" {
+			t.Errorf("%s: tags = %v, %v", name, tags, err)
+		}
+		if silences, err := p.GetSilences(utils.FileName(file)); err != nil || len(silences) != 2 {
+			t.Errorf("%s: silences = %+v, %v", name, silences, err)
+		}
+	}
+}
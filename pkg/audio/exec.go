@@ -0,0 +1,19 @@
+package audio
+
+import "github.com/histrio/rssbook/pkg/utils"
+
+// Executor runs an external command and returns its combined output
+type Executor interface {
+	Exec(name string, arg ...string) (string, error)
+}
+
+// ExecFunc is a function used as an Executor
+type ExecFunc func(name string, arg ...string) (string, error)
+
+// Exec runs the command
+func (f ExecFunc) Exec(name string, arg ...string) (string, error) {
+	return f(name, arg...)
+}
+
+// System runs commands found on the system
+var System Executor = ExecFunc(utils.SimpleExec)
@@ -0,0 +1,185 @@
+package audio
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/histrio/rssbook/pkg/utils"
+)
+
+// Loudness normalization modes
+const (
+	// LoudnormFile measures every source file and normalizes it on its own
+	LoudnormFile = "file"
+	// LoudnormBook measures the whole book and normalizes it as one
+	LoudnormBook = "book"
+)
+
+// LoudnormModes returns known loudness normalization modes
+func LoudnormModes() []string {
+	return []string{LoudnormFile, LoudnormBook}
+}
+
+// normalizedRate is the sample rate of decoded audio. loudnorm resamples to
+// 192 kHz and sources differ, parts are brought to one rate so they can be
+// joined.
+const normalizedRate = "44100"
+
+// Target is the loudness audio is normalized to
+type Target struct {
+	// Integrated loudness in LUFS
+	Integrated float64
+	// TruePeak is the maximum true peak in dBTP
+	TruePeak float64
+	// Range is the loudness range in LU
+	Range float64
+}
+
+// DefaultTarget is the loudness usual for spoken podcasts
+var DefaultTarget = Target{Integrated: -16, TruePeak: -1.5, Range: 11}
+
+// OrDefault returns the target with zero fields taken from DefaultTarget
+func (t Target) OrDefault() Target {
+	if t.Integrated == 0 {
+		t.Integrated = DefaultTarget.Integrated
+	}
+	if t.TruePeak == 0 {
+		t.TruePeak = DefaultTarget.TruePeak
+	}
+	if t.Range == 0 {
+		t.Range = DefaultTarget.Range
+	}
+	return t
+}
+
+// Check returns an error if loudnorm doesn't accept the target
+func (t Target) Check() error {
+	switch {
+	case t.Integrated < -70 || t.Integrated > -5:
+		return fmt.Errorf("integrated loudness %g LUFS is out of range -70..-5", t.Integrated)
+	case t.TruePeak < -9 || t.TruePeak > 0:
+		return fmt.Errorf("true peak %g dBTP is out of range -9..0", t.TruePeak)
+	case t.Range < 1 || t.Range > 20:
+		return fmt.Errorf("loudness range %g LU is out of range 1..20", t.Range)
+	}
+	return nil
+}
+
+// filter returns the second pass of loudnorm normalizing the measured audio.
+// Known loudness lets it apply a constant gain unless the true peak doesn't
+// allow it.
+func (t Target) filter(m utils.Loudness) string {
+	return fmt.Sprintf("loudnorm=I=%g:TP=%g:LRA=%g:measured_I=%g:measured_TP=%g:measured_LRA=%g:measured_thresh=%g:linear=true",
+		t.Integrated, t.TruePeak, t.Range, m.Integrated, m.TruePeak, m.Range, m.Threshold)
+}
+
+// Loudnorm normalizes source files as they are cut into episodes
+type Loudnorm struct {
+	Target Target
+	// Measured holds loudness of source files, files without it are only
+	// decoded
+	Measured map[utils.FileName]utils.Loudness
+}
+
+// cutArgs returns ffmpeg output arguments of a cut of the file. Copied cuts
+// keep the mp3 audio as it is, others are decoded and normalized if the
+// loudness of the file is measured.
+func (l *Loudnorm) cutArgs(file utils.FileName, copied bool) []string {
+	if copied {
+		return []string{"-acodec", "copy", "-f", "mp3"}
+	}
+	args := []string{}
+	if m, ok := l.measured(file); ok {
+		args = append(args, "-af", l.Target.filter(m))
+	}
+	return append(args, "-ar", normalizedRate, "-f", "wav")
+}
+
+// measured returns the loudness of the file, a nil Loudnorm has none
+func (l *Loudnorm) measured(file utils.FileName) (utils.Loudness, bool) {
+	if l == nil {
+		return utils.Loudness{}, false
+	}
+	m, ok := l.Measured[file]
+	return m, ok
+}
+
+// MeasureLoudness runs the first loudnorm pass over the files played one
+// after another. Measurements don't depend on the target.
+func (p Pipeline) MeasureLoudness(files ...utils.FileName) (utils.Loudness, error) {
+	args := []string{"-hide_banner", "-nostats"}
+	if len(files) == 1 {
+		args = append(args, "-i", fileArg(string(files[0])))
+	} else {
+		list, err := ioutil.TempFile(os.TempDir(), "rssbook_loudness_")
+		if err != nil {
+			return utils.Loudness{}, err
+		}
+		defer os.Remove(list.Name())
+		for _, f := range files {
+			name, err := filepath.Abs(string(f))
+			if err != nil {
+				list.Close()
+				return utils.Loudness{}, err
+			}
+			list.WriteString(concatFile(name))
+		}
+		if err := list.Close(); err != nil {
+			return utils.Loudness{}, err
+		}
+		args = append(args, "-f", "concat", "-safe", "0", "-i", fileArg(list.Name()))
+	}
+	t := DefaultTarget
+	args = append(args, "-af", fmt.Sprintf("loudnorm=I=%g:TP=%g:LRA=%g:print_format=json", t.Integrated, t.TruePeak, t.Range), "-f", "null", "-")
+	output, err := p.exec("ffmpeg", args...)
+	if err != nil {
+		return utils.Loudness{}, err
+	}
+	return parseLoudness(output)
+}
+
+// parseLoudness returns the measurement loudnorm prints as the last JSON
+// object of ffmpeg output
+func parseLoudness(output string) (utils.Loudness, error) {
+	var m utils.Loudness
+	start := strings.LastIndex(output, "{")
+	end := strings.LastIndex(output, "}")
+	if start < 0 || end < start {
+		return m, fmt.Errorf("no loudness measured")
+	}
+	var printed struct {
+		I      string `json:"input_i"`
+		TP     string `json:"input_tp"`
+		LRA    string `json:"input_lra"`
+		Thresh string `json:"input_thresh"`
+	}
+	if err := json.Unmarshal([]byte(output[start:end+1]), &printed); err != nil {
+		return m, fmt.Errorf("loudnorm output: %w", err)
+	}
+	for _, v := range []struct {
+		to    *float64
+		value string
+	}{
+		{&m.Integrated, printed.I},
+		{&m.TruePeak, printed.TP},
+		{&m.Range, printed.LRA},
+		{&m.Threshold, printed.Thresh},
+	} {
+		f, err := strconv.ParseFloat(v.value, 64)
+		if err != nil {
+			return m, fmt.Errorf("loudnorm output: %w", err)
+		}
+		// Silence measures as -inf
+		if math.IsInf(f, 0) || math.IsNaN(f) {
+			return m, fmt.Errorf("no loudness measured, the audio is silent")
+		}
+		*v.to = f
+	}
+	return m, nil
+}
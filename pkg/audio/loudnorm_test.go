@@ -0,0 +1,60 @@
+package audio
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/histrio/rssbook/pkg/utils"
+)
+
+// loudnormOutput is the tail of ffmpeg output of the first loudnorm pass
+const loudnormOutput = `size=N/A time=00:05:00.00 bitrate=N/A speed= 412x
+[Parsed_loudnorm_0 @ 0x5581c1d1a8c0]
+{
+	"input_i" : "-27.61",
+	"input_tp" : "-4.47",
+	"input_lra" : "18.06",
+	"input_thresh" : "-39.20",
+	"output_i" : "-16.58",
+	"output_tp" : "-1.50",
+	"output_lra" : "14.78",
+	"output_thresh" : "-27.71",
+	"normalization_type" : "dynamic",
+	"target_offset" : "0.58"
+}
+`
+
+func TestParseLoudness(t *testing.T) {
+	m, err := parseLoudness(loudnormOutput)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (utils.Loudness{Integrated: -27.61, TruePeak: -4.47, Range: 18.06, Threshold: -39.2}); m != want {
+		t.Errorf("parseLoudness() = %+v, want %+v", m, want)
+	}
+	silent := strings.NewReplacer(`"-27.61"`, `"-inf"`).Replace(loudnormOutput)
+	for _, output := range []string{silent, "", "{broken}"} {
+		if _, err := parseLoudness(output); err == nil {
+			t.Errorf("parseLoudness(%q) succeeded", output)
+		}
+	}
+}
+
+func TestTarget(t *testing.T) {
+	if got := (Target{Integrated: -19}).OrDefault(); got != (Target{Integrated: -19, TruePeak: -1.5, Range: 11}) {
+		t.Errorf("OrDefault() = %+v", got)
+	}
+	if err := DefaultTarget.Check(); err != nil {
+		t.Error(err)
+	}
+	for _, target := range []Target{{-80, -1, 11}, {-16, 1, 11}, {-16, -1, 30}} {
+		if err := target.Check(); err == nil {
+			t.Errorf("Check() of %+v succeeded", target)
+		}
+	}
+	got := DefaultTarget.filter(utils.Loudness{Integrated: -27.61, TruePeak: -4.47, Range: 18.06, Threshold: -39.2})
+	want := "loudnorm=I=-16:TP=-1.5:LRA=11:measured_I=-27.61:measured_TP=-4.47:measured_LRA=18.06:measured_thresh=-39.2:linear=true"
+	if got != want {
+		t.Errorf("filter() = %s, want %s", got, want)
+	}
+}
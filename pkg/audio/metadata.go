@@ -0,0 +1,104 @@
+package audio
+
+import "strings"
+
+// Metadata is a book description found in audio tags
+type Metadata struct {
+	Album       string
+	Title       string
+	Artist      string
+	AlbumArtist string
+	// Narrator is taken from the composer tag as audiobook taggers do
+	Narrator string
+	Genre    string
+	Date     string
+	Comment  string
+	// Language is an RFC 5646 code when the tag holds a known one
+	Language string
+	// Tags are all the tags, lower cased
+	Tags map[string]string
+}
+
+// languages maps ISO 639-2 codes used in ID3 tags to ISO 639-1 ones
+var languages = map[string]string{
+	"chi": "zh", "zho": "zh", "deu": "de", "ger": "de", "eng": "en", "fra": "fr",
+	"fre": "fr", "ita": "it", "jpn": "ja", "pol": "pl", "por": "pt", "rus": "ru",
+	"spa": "es", "ukr": "uk",
+}
+
+// language returns a language code of the tag value
+func language(value string) string {
+	code := strings.ToLower(strings.TrimSpace(value))
+	if iso, ok := languages[code]; ok {
+		return iso
+	}
+	if len(code) == 2 || len(code) > 3 && code[2] == '-' {
+		return code
+	}
+	return ""
+}
+
+// MetadataFromTags returns metadata of lower cased tags
+func MetadataFromTags(tags map[string]string) Metadata {
+	tag := func(names ...string) string {
+		for _, name := range names {
+			if value := strings.TrimSpace(tags[name]); value != "" {
+				return value
+			}
+		}
+		return ""
+	}
+	return Metadata{
+		Album:       tag("album"),
+		Title:       tag("title"),
+		Artist:      tag("artist"),
+		AlbumArtist: tag("album_artist", "albumartist"),
+		Narrator:    tag("composer"),
+		Genre:       tag("genre"),
+		Date:        tag("date", "year"),
+		Comment:     tag("comment", "description"),
+		Language:    language(tag("language")),
+		Tags:        tags,
+	}
+}
+
+// MergeMetadata returns metadata of a book made of files. Each field and tag
+// takes the value most of the files agree on, a tie goes to the earlier file.
+// Files lacking a value don't vote.
+func MergeMetadata(files []Metadata) Metadata {
+	merge := func(value func(Metadata) string) string {
+		votes := map[string]int{}
+		best := ""
+		for _, m := range files {
+			v := value(m)
+			if v == "" {
+				continue
+			}
+			votes[v]++
+			if votes[v] > votes[best] {
+				best = v
+			}
+		}
+		return best
+	}
+	tags := map[string]string{}
+	for _, m := range files {
+		for name := range m.Tags {
+			if _, ok := tags[name]; !ok {
+				tags[name] = merge(func(m Metadata) string { return m.Tags[name] })
+			}
+		}
+	}
+	return Metadata{
+		Album:       merge(func(m Metadata) string { return m.Album }),
+		Title:       merge(func(m Metadata) string { return m.Title }),
+		Artist:      merge(func(m Metadata) string { return m.Artist }),
+		AlbumArtist: merge(func(m Metadata) string { return m.AlbumArtist }),
+		Narrator:    merge(func(m Metadata) string { return m.Narrator }),
+		Genre:       merge(func(m Metadata) string { return m.Genre }),
+		Date:        merge(func(m Metadata) string { return m.Date }),
+		Comment:     merge(func(m Metadata) string { return m.Comment }),
+		Language:    merge(func(m Metadata) string { return m.Language }),
+		Tags:        tags,
+	}
+}
@@ -0,0 +1,362 @@
+package audio_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/histrio/rssbook/pkg/audio"
+	"github.com/histrio/rssbook/pkg/audio/audiotest"
+	"github.com/histrio/rssbook/pkg/probe"
+	"github.com/histrio/rssbook/pkg/utils"
+)
+
+func TestGetSilences(t *testing.T) {
+	replayer := audiotest.NewReplayer(audiotest.Silences("a.mp3",
+		audiotest.Silence{Start: 12.5, End: 13.25},
+		audiotest.Silence{Start: 300, End: 302.125},
+	))
+	got, err := audio.Pipeline{Exec: replayer}.GetSilences("a.mp3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []utils.Silence{
+		{Start: 12500 * time.Millisecond, End: 13250 * time.Millisecond, Duration: 750 * time.Millisecond},
+		{Start: 300 * time.Second, End: 302125 * time.Millisecond, Duration: 2125 * time.Millisecond},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetSilences() = %+v, want %+v", got, want)
+	}
+}
+
+func TestProbeFallback(t *testing.T) {
+	calls := 0
+	exec := audio.ExecFunc(func(name string, arg ...string) (string, error) {
+		calls++
+		if arg[len(arg)-1] == "a.mp3" {
+			return `{"format": {"tags": {"title": "From ffprobe"}}}`, nil
+		}
+		return "format,1.500000\n", nil
+	})
+	native := audio.Pipeline{Exec: exec, Probe: func(name string) (probe.Info, error) {
+		return probe.Info{Duration: 2 * time.Second, Tags: map[string]string{"title": "Native"}}, nil
+	}}
+	d, _ := native.GetDuration("a.mp3")
+	tags, _ := native.GetTags("a.mp3")
+	if d != 2*time.Second || tags["title"] != "Native" || calls != 0 {
+		t.Errorf("native GetDuration() = %v, GetTags() = %v, %d calls", d, tags, calls)
+	}
+
+	failing := audio.Pipeline{Exec: exec, Probe: func(name string) (probe.Info, error) {
+		return probe.Info{}, probe.ErrFormat
+	}}
+	d, _ = failing.GetDuration("a.mp3")
+	tags, _ = failing.GetTags("a.mp3")
+	if d != 1500*time.Millisecond || tags["title"] != "From ffprobe" || calls != 2 {
+		t.Errorf("fallback GetDuration() = %v, GetTags() = %v, %d calls", d, tags, calls)
+	}
+}
+
+// split returns a split of the file between seconds
+func split(file string, from, to int) utils.FileSplit {
+	return utils.FileSplit{
+		InputFile: utils.FileName(file),
+		From:      time.Duration(from) * time.Second,
+		To:        time.Duration(to) * time.Second,
+	}
+}
+
+func TestGetSplittedEpisodes(t *testing.T) {
+	tests := []struct {
+		name  string
+		calls []audiotest.Call
+		want  []utils.SplitPlan
+	}{
+		{
+			name: "debt filled by a part of the next file",
+			calls: []audiotest.Call{
+				audiotest.Silences("a.mp3"), audiotest.Duration("a.mp3", 300),
+				audiotest.Silences("b.mp3"), audiotest.Duration("b.mp3", 720),
+			},
+			want: []utils.SplitPlan{
+				{split("a.mp3", 0, 300), split("b.mp3", 0, 180)},
+				{split("b.mp3", 180, 660)},
+				{split("b.mp3", 660, 720)},
+			},
+		},
+		{
+			name: "debt bigger than the next file",
+			calls: []audiotest.Call{
+				audiotest.Silences("a.mp3"), audiotest.Duration("a.mp3", 300),
+				audiotest.Silences("b.mp3"), audiotest.Duration("b.mp3", 120),
+				audiotest.Silences("c.mp3", audiotest.Silence{Start: 50, End: 52}), audiotest.Duration("c.mp3", 720),
+			},
+			want: []utils.SplitPlan{
+				{split("a.mp3", 0, 300), split("b.mp3", 0, 120), split("c.mp3", 0, 51)},
+				{split("c.mp3", 51, 531)},
+				{split("c.mp3", 531, 720)},
+			},
+		},
+		{
+			name: "short book",
+			calls: []audiotest.Call{
+				audiotest.Silences("a.mp3"), audiotest.Duration("a.mp3", 60),
+			},
+			want: []utils.SplitPlan{
+				{split("a.mp3", 0, 60)},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			replayer := audiotest.NewReplayer(tt.calls...)
+			files := make(chan utils.FileName)
+			go func() {
+				for _, call := range tt.calls {
+					if call.Name == "ffprobe" {
+						files <- utils.FileName(call.Args[1])
+					}
+				}
+				close(files)
+			}()
+			got := []utils.SplitPlan{}
+			for plan := range (audio.Pipeline{Exec: replayer}).GetSplittedEpisodes(files, 8) {
+				if plan.Err != nil {
+					t.Fatal(plan.Err)
+				}
+				got = append(got, plan.Splits)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("GetSplittedEpisodes() = %+v, want %+v", got, tt.want)
+			}
+			if unused := replayer.Unused(); len(unused) > 0 {
+				t.Errorf("calls not made: %+v", unused)
+			}
+		})
+	}
+}
+
+func TestGetSplittedEpisodesKnownDurations(t *testing.T) {
+	// Only silences are detected, durations are not probed again
+	replayer := audiotest.NewReplayer(audiotest.Silences("a.mp3"), audiotest.Silences("b.mp3"))
+	p := audio.Pipeline{Exec: replayer, Durations: map[utils.FileName]time.Duration{
+		"a.mp3": 300 * time.Second,
+		"b.mp3": 720 * time.Second,
+	}}
+	files := make(chan utils.FileName, 2)
+	files <- "a.mp3"
+	files <- "b.mp3"
+	close(files)
+	got := []utils.SplitPlan{}
+	for plan := range p.GetSplittedEpisodes(files, 8) {
+		if plan.Err != nil {
+			t.Fatal(plan.Err)
+		}
+		got = append(got, plan.Splits)
+	}
+	want := []utils.SplitPlan{
+		{split("a.mp3", 0, 300), split("b.mp3", 0, 180)},
+		{split("b.mp3", 180, 660)},
+		{split("b.mp3", 660, 720)},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GetSplittedEpisodes() = %+v, want %+v", got, want)
+	}
+}
+
+func TestPipelineErrors(t *testing.T) {
+	broken := errors.New("exit status 1")
+	exec := audio.ExecFunc(func(name string, arg ...string) (string, error) {
+		switch {
+		case name == "ffprobe":
+			return "format,300.000000\n", nil
+		case arg[1] == "b.mp3":
+			return "", broken
+		}
+		return "", nil
+	})
+	// The error stops the stages, the rest of files is drained
+	files := make(chan utils.FileName)
+	go func() {
+		for _, f := range []utils.FileName{"a.mp3", "b.mp3", "c.mp3"} {
+			files <- f
+		}
+		close(files)
+	}()
+	p := audio.Pipeline{Exec: exec}
+	episodes := []audio.Episode{}
+	for ep := range p.GetCompressedEpisodes(p.GetMergedEpisodes(p.GetSplittedEpisodes(files, 8))) {
+		episodes = append(episodes, ep)
+	}
+	if len(episodes) != 1 || !errors.Is(episodes[0].Err, broken) || episodes[0].File != "" {
+		t.Errorf("episodes = %+v, want the error only", episodes)
+	}
+}
+
+func TestRecorder(t *testing.T) {
+	temp := filepath.Join(os.TempDir(), "rssbook_split_123")
+	recorder := &audiotest.Recorder{Executor: audio.ExecFunc(func(name string, arg ...string) (string, error) {
+		if name == "ffmpeg" {
+			return "broken input", errors.New("exit status 1")
+		}
+		return "format,1.500000\n", nil
+	})}
+	p := audio.Pipeline{Exec: recorder}
+	if d, err := p.GetDuration("a.mp3"); err != nil || d != 1500*time.Millisecond {
+		t.Errorf("GetDuration() = %v, %v", d, err)
+	}
+	recorder.Exec("ffmpeg", "-i", "a.mp3", temp)
+
+	path := filepath.Join(t.TempDir(), "calls.json")
+	if err := recorder.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	replayer, err := audiotest.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d, err := (audio.Pipeline{Exec: replayer}).GetDuration("a.mp3"); err != nil || d != 1500*time.Millisecond {
+		t.Errorf("replayed GetDuration() = %v, %v", d, err)
+	}
+	// Temporary files differ between runs
+	output, err := replayer.Exec("ffmpeg", "-i", "a.mp3", filepath.Join(os.TempDir(), "rssbook_split_456"))
+	if output != "broken input" || err == nil || err.Error() != "exit status 1" {
+		t.Errorf("replayed ffmpeg = %q, %v", output, err)
+	}
+	if _, err := replayer.Exec("ffprobe", "-i", "b.mp3"); err == nil {
+		t.Error("unexpected call replayed")
+	}
+}
+
+func TestGetMergedEpisodesHostileNames(t *testing.T) {
+	tmp := filepath.Join(t.TempDir(), "it's \"tmp\"\n\\ ёлка")
+	if err := os.Mkdir(tmp, 0777); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TMPDIR", tmp)
+
+	src := t.TempDir()
+	names := []string{"it's.mp3", "Part 1: Intro.mp3", "line\nbreak.mp3", "'; rm -rf ~; '.mp3", `back\slash.mp3`, "Война и мир.mp3"}
+	plan := utils.SplitPlan{}
+	for _, name := range names {
+		file := filepath.Join(src, name)
+		if err := os.WriteFile(file, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		plan = append(plan, split(file, 0, 60))
+	}
+	in := make(chan audio.Plan, 1)
+	in <- audio.Plan{Splits: plan}
+	close(in)
+
+	episodes := []string{}
+	for ep := range (audio.Pipeline{Exec: audiotest.Text}).GetMergedEpisodes(in) {
+		if ep.Err != nil {
+			t.Fatal(ep.Err)
+		}
+		data, err := os.ReadFile(string(ep.File))
+		if err != nil {
+			t.Fatal(err)
+		}
+		episodes = append(episodes, string(data))
+		os.Remove(string(ep.File))
+	}
+	if want := strings.Join(names, "\n") + "\n"; len(episodes) != 1 || episodes[0] != want {
+		t.Errorf("GetMergedEpisodes() = %q, want %q", episodes, want)
+	}
+}
+
+func TestLoudnorm(t *testing.T) {
+	src := t.TempDir()
+	files := []utils.FileName{}
+	for _, name := range []string{"it's.mp3", "02.mp3"} {
+		file := filepath.Join(src, name)
+		if err := os.WriteFile(file, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, utils.FileName(file))
+	}
+	calls := []string{}
+	exec := audio.ExecFunc(func(name string, arg ...string) (string, error) {
+		args := strings.Join(arg, " ")
+		calls = append(calls, args)
+		if !strings.Contains(args, "print_format=json") {
+			return audiotest.Text(name, arg...)
+		}
+		// The whole book is measured as one stream of its files
+		listed, err := audiotest.ReadConcatList(arg[7])
+		if err != nil || !reflect.DeepEqual(listed, []string{string(files[0]), string(files[1])}) {
+			t.Errorf("measured %q, %v", listed, err)
+		}
+		return `{"input_i": "-27.61", "input_tp": "-4.47", "input_lra": "18.06", "input_thresh": "-39.20"}`, nil
+	})
+	p := audio.Pipeline{Exec: exec}
+	measured, err := p.MeasureLoudness(files...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the first file is normalized, both are decoded to be joined
+	p.Loudnorm = &audio.Loudnorm{Target: audio.DefaultTarget, Measured: map[utils.FileName]utils.Loudness{files[0]: measured}}
+	in := make(chan audio.Plan, 1)
+	in <- audio.Plan{Splits: utils.SplitPlan{split(string(files[0]), 0, 60), split(string(files[1]), 0, 60)}}
+	close(in)
+	for ep := range p.GetMergedEpisodes(in) {
+		os.Remove(string(ep.File))
+	}
+	if len(calls) != 4 {
+		t.Fatalf("calls = %q", calls)
+	}
+	if !strings.Contains(calls[1], "-af loudnorm=I=-16:TP=-1.5:LRA=11:measured_I=-27.61:") || !strings.Contains(calls[1], "-f wav") {
+		t.Errorf("normalized cut = %s", calls[1])
+	}
+	if strings.Contains(calls[2], "loudnorm") || !strings.Contains(calls[2], "-ar 44100 -f wav") {
+		t.Errorf("decoded cut = %s", calls[2])
+	}
+	if !strings.Contains(calls[3], "-f concat") || !strings.Contains(calls[3], "-f wav -c copy") {
+		t.Errorf("concat = %s", calls[3])
+	}
+}
+
+func TestGetMergedEpisodesDecoded(t *testing.T) {
+	src := t.TempDir()
+	plan := utils.SplitPlan{}
+	for _, name := range []string{"01.flac", "02.mp3"} {
+		file := filepath.Join(src, name)
+		if err := os.WriteFile(file, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+		plan = append(plan, split(file, 0, 60))
+	}
+	calls := []string{}
+	exec := audio.ExecFunc(func(name string, arg ...string) (string, error) {
+		calls = append(calls, strings.Join(arg, " "))
+		return audiotest.Text(name, arg...)
+	})
+	// Parts of other formats can't be copied into mp3, the whole episode is
+	// decoded
+	in := make(chan audio.Plan, 1)
+	in <- audio.Plan{Splits: plan}
+	close(in)
+	for ep := range (audio.Pipeline{Exec: exec}).GetMergedEpisodes(in) {
+		if ep.Err != nil {
+			t.Fatal(ep.Err)
+		}
+		os.Remove(string(ep.File))
+	}
+	if len(calls) != 3 {
+		t.Fatalf("calls = %q", calls)
+	}
+	for _, cut := range calls[:2] {
+		if strings.Contains(cut, "-acodec copy") || !strings.Contains(cut, "-ar 44100 -f wav") {
+			t.Errorf("decoded cut = %s", cut)
+		}
+	}
+	if !strings.Contains(calls[2], "-f wav -c copy") {
+		t.Errorf("concat = %s", calls[2])
+	}
+}
@@ -0,0 +1,209 @@
+package daemon
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/histrio/rssbook/pkg/archive"
+	"github.com/histrio/rssbook/pkg/manifest"
+	"github.com/histrio/rssbook/pkg/utils"
+)
+
+// followInterval is how often a followed log is checked for new output
+const followInterval = 200 * time.Millisecond
+
+// API serves the daemon over HTTP:
+//
+//	POST /jobs                 submit a Request, returns the job
+//	GET  /jobs?state=running   list jobs
+//	GET  /jobs/<id>            get the job
+//	GET  /jobs/<id>/log        build log, ?follow=1 streams it until the job ends
+//	POST /jobs/<id>/cancel     cancel the job
+//	GET  /jobs/<id>/result     manifest of the built book
+type API struct {
+	Daemon *Daemon
+	// SourceRoot restricts sources to the directory if set
+	SourceRoot string
+}
+
+// jobMethods are methods of job endpoints
+var jobMethods = map[string]string{"": "GET", "/log": "GET", "/cancel": "POST", "/result": "GET"}
+
+type apiError struct {
+	Error string `json:"error"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, apiError{Error: err.Error()})
+}
+
+func (a *API) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if parts[0] != "jobs" || len(parts) > 3 {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no such endpoint"))
+		return
+	}
+	route := r.Method + " /jobs"
+	if len(parts) > 1 {
+		route = r.Method + " " + strings.Join(append([]string{""}, parts[2:]...), "/")
+	}
+	switch route {
+	case "POST /jobs":
+		a.submit(w, r)
+		return
+	case "GET /jobs":
+		writeJSON(w, http.StatusOK, a.Daemon.Store.List(r.URL.Query().Get("state")))
+		return
+	}
+	if len(parts) == 1 {
+		w.Header().Set("Allow", "GET, POST")
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("%s is not allowed", r.Method))
+		return
+	}
+
+	job, err := a.Daemon.Store.Get(parts[1])
+	if err != nil {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	switch route {
+	case "GET ":
+		writeJSON(w, http.StatusOK, job)
+	case "GET /log":
+		a.log(w, r, job)
+	case "POST /cancel":
+		job, err = a.Daemon.Cancel(job.ID)
+		if err == ErrFinished {
+			writeError(w, http.StatusConflict, err)
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusAccepted, job)
+	case "GET /result":
+		if job.State != Done || job.Result == nil {
+			writeError(w, http.StatusConflict, fmt.Errorf("job is %s", job.State))
+			return
+		}
+		m, err := manifest.Read(job.Result.Dir)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, m)
+	default:
+		allow, ok := jobMethods[strings.TrimPrefix(route, r.Method+" ")]
+		if !ok {
+			writeError(w, http.StatusNotFound, fmt.Errorf("no such endpoint"))
+			return
+		}
+		w.Header().Set("Allow", allow)
+		writeError(w, http.StatusMethodNotAllowed, fmt.Errorf("%s is not allowed", r.Method))
+	}
+}
+
+// checkSource tells why the source can not be built
+func (a *API) checkSource(source string) error {
+	if !filepath.IsAbs(source) {
+		return fmt.Errorf("source must be an absolute path")
+	}
+	source = filepath.Clean(source)
+	if a.SourceRoot != "" {
+		rel, err := filepath.Rel(a.SourceRoot, source)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("source must be inside %s", a.SourceRoot)
+		}
+	}
+	fi, err := os.Stat(source)
+	if err != nil {
+		return fmt.Errorf("source is not found")
+	}
+	if !fi.IsDir() && !archive.Supported(source) {
+		return fmt.Errorf("source is neither a directory nor an archive")
+	}
+	return nil
+}
+
+func (a *API) submit(w http.ResponseWriter, r *http.Request) {
+	var req Request
+	dec := json.NewDecoder(io.LimitReader(r.Body, 1<<20))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := a.checkSource(req.Source); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if req.Name != "" {
+		if err := utils.CheckBookID(req.Name); err != nil {
+			writeError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+	req.Source = filepath.Clean(req.Source)
+	job, err := a.Daemon.Submit(req)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Location", "/jobs/"+job.ID)
+	writeJSON(w, http.StatusCreated, job)
+}
+
+// log writes the build log, following it until the job ends if asked
+func (a *API) log(w http.ResponseWriter, r *http.Request, job Job) {
+	follow := r.URL.Query().Get("follow") != ""
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	flusher, _ := w.(http.Flusher)
+	var f *os.File
+	defer func() {
+		if f != nil {
+			f.Close()
+		}
+	}()
+	for {
+		if f == nil {
+			f, _ = os.Open(a.Daemon.Store.LogPath(job.ID))
+		}
+		if f != nil {
+			if _, err := io.Copy(w, f); err != nil {
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		if !follow || job.Done() {
+			return
+		}
+		select {
+		case <-r.Context().Done():
+			return
+		case <-time.After(followInterval):
+		}
+		// The rest of the log is written before the job ends
+		current, err := a.Daemon.Store.Get(job.ID)
+		if err != nil {
+			return
+		}
+		job = current
+	}
+}
@@ -0,0 +1,216 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/histrio/rssbook/pkg/loggers"
+)
+
+// BuildFunc converts the requested source writing progress to the log. It
+// must stop when the context is canceled.
+type BuildFunc func(ctx context.Context, req Request, log io.Writer) (Result, error)
+
+// ErrFinished is returned on canceling a finished job
+var ErrFinished = errors.New("job is finished")
+
+// Daemon runs submitted jobs, at most Concurrency at a time, in order they
+// were submitted
+type Daemon struct {
+	Store       *Store
+	Concurrency int
+	Build       BuildFunc
+	Log         *loggers.Logger
+
+	now func() time.Time
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	pending []string
+	cancels map[string]context.CancelFunc
+	stopped bool
+	wg      sync.WaitGroup
+}
+
+// New returns a daemon for the store, call Start to run jobs
+func New(store *Store, concurrency int, build BuildFunc) *Daemon {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	d := &Daemon{
+		Store:       store,
+		Concurrency: concurrency,
+		Build:       build,
+		cancels:     map[string]context.CancelFunc{},
+	}
+	d.cond = sync.NewCond(&d.mu)
+	return d
+}
+
+func (d *Daemon) clock() time.Time {
+	if d.now != nil {
+		return d.now()
+	}
+	return time.Now()
+}
+
+// Start runs workers, jobs queued before a restart go first
+func (d *Daemon) Start() {
+	d.mu.Lock()
+	for _, job := range d.Store.List(Queued) {
+		d.pending = append(d.pending, job.ID)
+	}
+	d.mu.Unlock()
+	for i := 0; i < d.Concurrency; i++ {
+		d.wg.Add(1)
+		go d.work()
+	}
+}
+
+// Stop cancels running jobs and waits for workers. Canceled jobs stay
+// queued for the next start.
+func (d *Daemon) Stop() {
+	d.mu.Lock()
+	d.stopped = true
+	for _, cancel := range d.cancels {
+		cancel()
+	}
+	d.cond.Broadcast()
+	d.mu.Unlock()
+	d.wg.Wait()
+}
+
+// Submit queues a new job
+func (d *Daemon) Submit(req Request) (Job, error) {
+	job, err := d.Store.Create(req, d.clock())
+	if err != nil {
+		return job, err
+	}
+	d.mu.Lock()
+	d.pending = append(d.pending, job.ID)
+	d.cond.Signal()
+	d.mu.Unlock()
+	return job, nil
+}
+
+// Cancel stops the running job or drops the queued one
+func (d *Daemon) Cancel(id string) (Job, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	job, err := d.Store.Get(id)
+	if err != nil {
+		return job, err
+	}
+	if job.Done() {
+		return job, ErrFinished
+	}
+	if cancel, ok := d.cancels[id]; ok {
+		// The worker records the result
+		cancel()
+		return job, nil
+	}
+	for i, pending := range d.pending {
+		if pending == id {
+			d.pending = append(d.pending[:i], d.pending[i+1:]...)
+			break
+		}
+	}
+	return d.Store.Update(id, func(job *Job) {
+		job.State = Canceled
+		job.Finished = d.clock()
+	})
+}
+
+// next waits for a pending job, it returns false when the daemon stops
+func (d *Daemon) next() (string, context.Context, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for len(d.pending) == 0 && !d.stopped {
+		d.cond.Wait()
+	}
+	if d.stopped {
+		return "", nil, false
+	}
+	id := d.pending[0]
+	d.pending = d.pending[1:]
+	ctx, cancel := context.WithCancel(context.Background())
+	d.cancels[id] = cancel
+	return id, ctx, true
+}
+
+func (d *Daemon) work() {
+	defer d.wg.Done()
+	for {
+		id, ctx, ok := d.next()
+		if !ok {
+			return
+		}
+		d.run(id, ctx)
+	}
+}
+
+func (d *Daemon) run(id string, ctx context.Context) {
+	defer func() {
+		d.mu.Lock()
+		if cancel, ok := d.cancels[id]; ok {
+			cancel()
+			delete(d.cancels, id)
+		}
+		d.mu.Unlock()
+	}()
+	logger := d.Log.With("job", id)
+	job, err := d.Store.Update(id, func(job *Job) {
+		job.State = Running
+		job.Started = d.clock()
+	})
+	if err != nil {
+		logger.Error("Starting failed", "err", err)
+		return
+	}
+	log, createErr := os.Create(d.Store.LogPath(id))
+	if createErr != nil {
+		logger.Error("Starting failed", "err", createErr)
+		_, err = d.Store.Update(id, func(job *Job) {
+			job.State = Failed
+			job.Error = createErr.Error()
+			job.Finished = d.clock()
+		})
+		if err != nil {
+			logger.Error("Saving failed", "err", err)
+		}
+		return
+	}
+	logger.Info("Building", "source", job.Request.Source)
+	result, buildErr := d.Build(ctx, job.Request, log)
+	log.Close()
+
+	d.mu.Lock()
+	stopped := d.stopped
+	d.mu.Unlock()
+	job, err = d.Store.Update(id, func(job *Job) {
+		job.Finished = d.clock()
+		switch {
+		case stopped:
+			job.State = Queued
+			job.Started = time.Time{}
+			job.Finished = time.Time{}
+		case ctx.Err() != nil:
+			job.State = Canceled
+		case buildErr != nil:
+			job.State = Failed
+			job.Error = buildErr.Error()
+		default:
+			job.State = Done
+			job.Result = &result
+		}
+	})
+	if err != nil {
+		logger.Error("Saving failed", "err", err)
+		return
+	}
+	logger.Info("Finished", "state", job.State)
+}
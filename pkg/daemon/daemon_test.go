@@ -0,0 +1,277 @@
+package daemon
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/histrio/rssbook/pkg/manifest"
+	"github.com/histrio/rssbook/pkg/utils"
+)
+
+// fakeBuilds blocks builds until they are released
+type fakeBuilds struct {
+	mu      sync.Mutex
+	running int
+	max     int
+	release chan string
+	dst     string
+}
+
+func (f *fakeBuilds) build(ctx context.Context, req Request, log io.Writer) (Result, error) {
+	f.mu.Lock()
+	f.running++
+	if f.running > f.max {
+		f.max = f.running
+	}
+	f.mu.Unlock()
+	defer func() {
+		f.mu.Lock()
+		f.running--
+		f.mu.Unlock()
+	}()
+	fmt.Fprintf(log, "building %s\n", req.Name)
+	select {
+	case <-ctx.Done():
+		return Result{}, ctx.Err()
+	case outcome := <-f.release:
+		if outcome == "fail" {
+			return Result{}, errors.New("broken")
+		}
+	}
+	dir := filepath.Join(f.dst, req.Name)
+	os.MkdirAll(dir, 0777)
+	book := utils.BookMeta{ID: req.Name, Title: req.Title}
+	if err := (manifest.Manifest{Book: book}).Write(dir); err != nil {
+		return Result{}, err
+	}
+	fmt.Fprintln(log, "done")
+	return Result{BookID: req.Name, Dir: dir}, nil
+}
+
+func waitState(t *testing.T, d *Daemon, id string, state string) Job {
+	for i := 0; i < 500; i++ {
+		job, _ := d.Store.Get(id)
+		if job.State == state {
+			return job
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	job, _ := d.Store.Get(id)
+	t.Fatalf("job %s is %s, want %s", id, job.State, state)
+	return job
+}
+
+func TestDaemon(t *testing.T) {
+	root := t.TempDir()
+	store, err := OpenStore(filepath.Join(root, "jobs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	builds := &fakeBuilds{release: make(chan string), dst: root}
+	d := New(store, 2, builds.build)
+	d.Start()
+	defer d.Stop()
+
+	jobs := []Job{}
+	for i := 0; i < 4; i++ {
+		job, err := d.Submit(Request{Source: root, Name: fmt.Sprintf("book-%d", i)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		jobs = append(jobs, job)
+	}
+	waitState(t, d, jobs[0].ID, Running)
+	waitState(t, d, jobs[1].ID, Running)
+
+	// Queued and running jobs are canceled
+	if job, err := d.Cancel(jobs[3].ID); err != nil || job.State != Canceled {
+		t.Errorf("Cancel() = %+v, %v", job, err)
+	}
+	d.Cancel(jobs[1].ID)
+	waitState(t, d, jobs[1].ID, Canceled)
+
+	builds.release <- "fail"
+	waitState(t, d, jobs[0].ID, Failed)
+	builds.release <- "ok"
+	job := waitState(t, d, jobs[2].ID, Done)
+	if job.Result == nil || job.Result.BookID != "book-2" {
+		t.Errorf("result = %+v", job.Result)
+	}
+	if _, err := d.Cancel(jobs[2].ID); err != ErrFinished {
+		t.Errorf("Cancel() of a finished job = %v", err)
+	}
+	if builds.max != 2 {
+		t.Errorf("%d builds ran at once, want 2", builds.max)
+	}
+	log, _ := os.ReadFile(store.LogPath(jobs[2].ID))
+	if string(log) != "building book-2\ndone\n" {
+		t.Errorf("log = %q", log)
+	}
+}
+
+func TestDaemonLogFailure(t *testing.T) {
+	root := t.TempDir()
+	store, err := OpenStore(filepath.Join(root, "jobs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	builds := &fakeBuilds{release: make(chan string), dst: root}
+	d := New(store, 1, builds.build)
+	job, err := d.Submit(Request{Source: root, Name: "book"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A folder in place of the log can't be created as a file
+	if err := os.Mkdir(store.LogPath(job.ID), 0777); err != nil {
+		t.Fatal(err)
+	}
+	d.Start()
+	defer d.Stop()
+	if job := waitState(t, d, job.ID, Failed); job.Error == "" || job.Finished.IsZero() {
+		t.Errorf("job = %+v", job)
+	}
+}
+
+func TestStoreRestart(t *testing.T) {
+	dir := t.TempDir()
+	store, _ := OpenStore(dir)
+	now := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	first, _ := store.Create(Request{Source: "/a"}, now)
+	second, _ := store.Create(Request{Source: "/b"}, now.Add(time.Second))
+	store.Update(first.ID, func(job *Job) { job.State = Running })
+
+	store, err := OpenStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	queued := store.List(Queued)
+	if len(queued) != 2 || queued[0].ID != first.ID || queued[1].ID != second.ID {
+		t.Errorf("queued = %+v", queued)
+	}
+}
+
+func TestAPI(t *testing.T) {
+	root := t.TempDir()
+	source := filepath.Join(root, "sources", "book")
+	os.MkdirAll(source, 0777)
+	store, _ := OpenStore(filepath.Join(root, "jobs"))
+	builds := &fakeBuilds{release: make(chan string, 1), dst: root}
+	d := New(store, 1, builds.build)
+	d.Start()
+	defer d.Stop()
+	ts := httptest.NewServer(&API{Daemon: d, SourceRoot: filepath.Join(root, "sources")})
+	defer ts.Close()
+
+	post := func(path string, body string) (*http.Response, Job) {
+		resp, err := http.Post(ts.URL+path, "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var job Job
+		json.NewDecoder(resp.Body).Decode(&job)
+		return resp, job
+	}
+
+	for _, body := range []string{
+		`{"source": "` + root + `"}`,
+		`{"source": "relative"}`,
+		`{"source": "` + source + `/missing"}`,
+		`{"source": "` + source + `", "unknown": 1}`,
+		`{"source": "` + source + `", "name": "../../somewhere", "update": true}`,
+		`{"source": "` + source + `", "name": "..", "update": true}`,
+		`{"source": "` + source + `", "name": "-dst"}`,
+	} {
+		if resp, _ := post("/jobs", body); resp.StatusCode != http.StatusBadRequest {
+			t.Errorf("%s: status = %d", body, resp.StatusCode)
+		}
+	}
+
+	resp, job := post("/jobs", `{"source": "`+source+`", "name": "book", "title": "Book"}`)
+	if resp.StatusCode != http.StatusCreated || job.ID == "" || resp.Header.Get("Location") != "/jobs/"+job.ID {
+		t.Fatalf("submit: status = %d, job = %+v", resp.StatusCode, job)
+	}
+	waitState(t, d, job.ID, Running)
+
+	// The log is streamed until the job ends
+	logResp, err := http.Get(ts.URL + "/jobs/" + job.ID + "/log?follow=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	builds.release <- "ok"
+	log, _ := io.ReadAll(logResp.Body)
+	logResp.Body.Close()
+	if string(log) != "building book\ndone\n" {
+		t.Errorf("log = %q", log)
+	}
+
+	resp, err = http.Get(ts.URL + "/jobs/" + job.ID + "/result")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m manifest.Manifest
+	json.NewDecoder(resp.Body).Decode(&m)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || m.Book.Title != "Book" {
+		t.Errorf("result: status = %d, manifest = %+v", resp.StatusCode, m)
+	}
+
+	if resp, _ := post("/jobs/"+job.ID+"/cancel", ""); resp.StatusCode != http.StatusConflict {
+		t.Errorf("cancel of a finished job: status = %d", resp.StatusCode)
+	}
+	resp, _ = http.Get(ts.URL + "/jobs?state=done")
+	var list []Job
+	json.NewDecoder(resp.Body).Decode(&list)
+	resp.Body.Close()
+	if len(list) != 1 || list[0].ID != job.ID {
+		t.Errorf("list = %+v", list)
+	}
+	for _, path := range []string{"/jobs/unknown", "/other"} {
+		resp, _ := http.Get(ts.URL + path)
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("%s: status = %d", path, resp.StatusCode)
+		}
+	}
+	for _, method := range []string{"DELETE", "PUT"} {
+		req, _ := http.NewRequest(method, ts.URL+"/jobs", nil)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusMethodNotAllowed || resp.Header.Get("Allow") != "GET, POST" {
+			t.Errorf("%s /jobs: status = %d", method, resp.StatusCode)
+		}
+	}
+	for path, allow := range map[string]string{"": "GET", "/log": "GET", "/cancel": "POST", "/result": "GET"} {
+		req, _ := http.NewRequest("DELETE", ts.URL+"/jobs/"+job.ID+path, nil)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusMethodNotAllowed || resp.Header.Get("Allow") != allow {
+			t.Errorf("DELETE /jobs/<id>%s: status = %d, Allow = %q", path, resp.StatusCode, resp.Header.Get("Allow"))
+		}
+	}
+	if resp, _ := http.Get(ts.URL + "/jobs/" + job.ID + "/other"); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("unknown job endpoint: status = %d", resp.StatusCode)
+	}
+	var body bytes.Buffer
+	if resp, _ := http.Get(ts.URL + "/jobs/" + job.ID); resp.StatusCode != http.StatusOK {
+		body.ReadFrom(resp.Body)
+		t.Errorf("get: status = %d %s", resp.StatusCode, body.String())
+	}
+}
@@ -0,0 +1,3 @@
+module histrio/rssbook/pkg/daemon
+
+go 1.17
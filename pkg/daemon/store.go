@@ -0,0 +1,191 @@
+package daemon
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Job states
+const (
+	Queued   = "queued"
+	Running  = "running"
+	Done     = "done"
+	Failed   = "failed"
+	Canceled = "canceled"
+)
+
+// Request asks to convert a source folder, empty fields take build defaults
+type Request struct {
+	Source      string  `json:"source"`
+	Name        string  `json:"name,omitempty"`
+	Title       string  `json:"title,omitempty"`
+	Author      string  `json:"author,omitempty"`
+	SeriesIndex int     `json:"seriesIndex,omitempty"`
+	Schedule    string  `json:"schedule,omitempty"`
+	Order       string  `json:"order,omitempty"`
+	Loudnorm    string  `json:"loudnorm,omitempty"`
+	LUFS        float64 `json:"lufs,omitempty"`
+	TruePeak    float64 `json:"truePeak,omitempty"`
+	Update      bool    `json:"update,omitempty"`
+}
+
+// Result describes a built book
+type Result struct {
+	BookID   string `json:"bookId"`
+	Dir      string `json:"dir"`
+	Feed     string `json:"feed"`
+	Episodes int    `json:"episodes"`
+}
+
+// Job is a submitted conversion
+type Job struct {
+	ID       string    `json:"id"`
+	Request  Request   `json:"request"`
+	State    string    `json:"state"`
+	Created  time.Time `json:"created"`
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+	Error    string    `json:"error,omitempty"`
+	Result   *Result   `json:"result,omitempty"`
+}
+
+// Done tells whether the job will not change anymore
+func (j Job) Done() bool {
+	return j.State == Done || j.State == Failed || j.State == Canceled
+}
+
+// ErrNotFound is returned for unknown jobs
+var ErrNotFound = errors.New("job not found")
+
+// Store keeps jobs in a directory, a JSON file and a log per job
+type Store struct {
+	dir  string
+	mu   sync.Mutex
+	jobs map[string]*Job
+}
+
+// OpenStore loads jobs from the directory. Jobs interrupted by a restart are
+// queued again.
+func OpenStore(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return nil, err
+	}
+	s := &Store{dir: dir, jobs: map[string]*Job{}}
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range paths {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		job := &Job{}
+		if err := json.Unmarshal(content, job); err != nil {
+			return nil, errors.New(path + ": " + err.Error())
+		}
+		if job.State == Running {
+			job.State = Queued
+			if err := s.save(job); err != nil {
+				return nil, err
+			}
+		}
+		s.jobs[job.ID] = job
+	}
+	return s, nil
+}
+
+func (s *Store) save(job *Job) error {
+	content, err := json.MarshalIndent(job, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(s.dir, job.ID+".json")
+	if err := os.WriteFile(path+".tmp", append(content, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.Rename(path+".tmp", path)
+}
+
+func newID(now time.Time) (string, error) {
+	b := make([]byte, 4)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return now.UTC().Format("20060102-150405-") + hex.EncodeToString(b), nil
+}
+
+// Create adds a queued job for the request
+func (s *Store) Create(req Request, now time.Time) (Job, error) {
+	id, err := newID(now)
+	if err != nil {
+		return Job{}, err
+	}
+	job := &Job{ID: id, Request: req, State: Queued, Created: now}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.save(job); err != nil {
+		return Job{}, err
+	}
+	s.jobs[id] = job
+	return *job, nil
+}
+
+// Get returns the job by its ID
+func (s *Store) Get(id string) (Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[id]
+	if !ok {
+		return Job{}, ErrNotFound
+	}
+	return *job, nil
+}
+
+// List returns jobs in order they were created, optionally in the state only
+func (s *Store) List(state string) []Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	jobs := []Job{}
+	for _, job := range s.jobs {
+		if state == "" || job.State == state {
+			jobs = append(jobs, *job)
+		}
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		if !jobs[i].Created.Equal(jobs[j].Created) {
+			return jobs[i].Created.Before(jobs[j].Created)
+		}
+		return jobs[i].ID < jobs[j].ID
+	})
+	return jobs
+}
+
+// Update changes the job and saves it
+func (s *Store) Update(id string, change func(job *Job)) (Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	job, ok := s.jobs[id]
+	if !ok {
+		return Job{}, ErrNotFound
+	}
+	updated := *job
+	change(&updated)
+	if err := s.save(&updated); err != nil {
+		return *job, err
+	}
+	*job = updated
+	return updated, nil
+}
+
+// LogPath returns a path of the job's build log
+func (s *Store) LogPath(id string) string {
+	return filepath.Join(s.dir, id+".log")
+}
@@ -0,0 +1,3 @@
+module histrio/rssbook/pkg/internal/golden
+
+go 1.17
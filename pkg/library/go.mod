@@ -0,0 +1,3 @@
+module histrio/rssbook/pkg/library
+
+go 1.17
@@ -0,0 +1,251 @@
+package library
+
+import (
+	"encoding/xml"
+	"fmt"
+	"html/template"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/histrio/rssbook/pkg/manifest"
+	"github.com/histrio/rssbook/pkg/rss"
+	"github.com/histrio/rssbook/pkg/utils"
+)
+
+// Files written into the library root
+const (
+	OPMLFile      = "library.opml"
+	IndexFile     = "index.html"
+	AggregateFile = "library.xml"
+)
+
+// Entry is a built book found in the library
+type Entry struct {
+	Dir string
+	// Path is the slash separated directory of the book relative to the
+	// library root
+	Path string
+	Book utils.BookMeta
+}
+
+// Duration returns the total duration of the book
+func (e Entry) Duration() time.Duration {
+	total := time.Duration(0)
+	for _, ep := range e.Book.Episodes {
+		total += ep.Duration
+	}
+	return total
+}
+
+// Library is a set of built books sharing a public URL
+type Library struct {
+	Title string
+	// BaseURL is a public URL of the library root. Books keep their own
+	// URLs if empty.
+	BaseURL string
+	Entries []Entry
+}
+
+// Scan finds built books by their manifests in the root and its
+// subdirectories
+func Scan(root string) ([]Entry, error) {
+	entries := []Entry{}
+	err := filepath.Walk(root, func(path string, f os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if f.IsDir() || f.Name() != manifest.FileName {
+			return nil
+		}
+		dir := filepath.Dir(path)
+		m, err := manifest.Read(dir)
+		if err != nil {
+			return fmt.Errorf("%s: %s", path, err)
+		}
+		rel, err := filepath.Rel(root, dir)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, Entry{Dir: dir, Path: filepath.ToSlash(rel), Book: m.Book})
+		return nil
+	})
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Book.Title != entries[j].Book.Title {
+			return entries[i].Book.Title < entries[j].Book.Title
+		}
+		return entries[i].Book.ID < entries[j].Book.ID
+	})
+	return entries, err
+}
+
+// url returns a public URL of the file in the library
+func (l Library) url(name string) string {
+	if l.BaseURL == "" {
+		return utils.S3Url + name
+	}
+	return strings.TrimSuffix(l.BaseURL, "/") + "/" + name
+}
+
+// bookURL returns a public URL of the book's file. Under the base URL books
+// are found by their directories in the library.
+func (l Library) bookURL(e Entry, name string) string {
+	if l.BaseURL == "" {
+		return l.url(e.Book.ID + "/" + name)
+	}
+	dir := e.Path
+	if dir == "" {
+		// Entries not found by Scan are kept by their IDs
+		dir = e.Book.ID
+	}
+	segments := []string{}
+	if dir != "." {
+		for _, segment := range strings.Split(dir, "/") {
+			segments = append(segments, url.PathEscape(segment))
+		}
+	}
+	return l.url(strings.Join(append(segments, url.PathEscape(name)), "/"))
+}
+
+// FeedURL returns a public URL of the book's feed
+func (l Library) FeedURL(e Entry) string {
+	return l.bookURL(e, e.Book.ID+".xml")
+}
+
+type opmlOutline struct {
+	Type   string `xml:"type,attr"`
+	Text   string `xml:"text,attr"`
+	Title  string `xml:"title,attr"`
+	XMLURL string `xml:"xmlUrl,attr"`
+}
+
+type opmlDocument struct {
+	XMLName     xml.Name       `xml:"opml"`
+	Version     string         `xml:"version,attr"`
+	Title       string         `xml:"head>title"`
+	DateCreated rss.RFC822Time `xml:"head>dateCreated"`
+	Outlines    []opmlOutline  `xml:"body>outline"`
+}
+
+// WriteOPML writes an OPML subscription list of all books
+func (l Library) WriteOPML(w io.Writer, now time.Time) error {
+	doc := opmlDocument{
+		Version:     "2.0",
+		Title:       l.Title,
+		DateCreated: rss.RFC822Time{Time: now.UTC()},
+		Outlines:    []opmlOutline{},
+	}
+	for _, e := range l.Entries {
+		doc.Outlines = append(doc.Outlines, opmlOutline{
+			Type:   "rss",
+			Text:   e.Book.Title,
+			Title:  e.Book.Title,
+			XMLURL: l.FeedURL(e),
+		})
+	}
+	out, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, xml.Header+string(out)+"\n")
+	return err
+}
+
+var indexTemplate = template.Must(template.New("index").Funcs(template.FuncMap{
+	"duration": func(d time.Duration) string {
+		return d.Round(time.Minute).String()
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+{{if .Aggregate}}<link rel="alternate" type="application/rss+xml" title="{{.Title}}" href="{{.Aggregate}}">
+{{end}}</head>
+<body>
+<h1>{{.Title}}</h1>
+<table>
+<tr><th>Title</th><th>Author</th><th>Episodes</th><th>Duration</th><th>Feed</th></tr>
+{{range .Books}}<tr><td>{{.Title}}</td><td>{{.Author}}</td><td>{{.Episodes}}</td><td>{{duration .Duration}}</td><td><a href="{{.FeedURL}}">RSS</a></td></tr>
+{{end}}</table>
+<p><a href="{{.OPML}}">OPML</a>{{if .Aggregate}} | <a href="{{.Aggregate}}">New in library</a>{{end}}</p>
+</body>
+</html>
+`))
+
+// WriteHTML writes an index page of all books. It links to the aggregate
+// feed if there is one.
+func (l Library) WriteHTML(w io.Writer, aggregate bool) error {
+	type bookRow struct {
+		Title    string
+		Author   string
+		Episodes int
+		Duration time.Duration
+		FeedURL  string
+	}
+	data := struct {
+		Title     string
+		OPML      string
+		Aggregate string
+		Books     []bookRow
+	}{Title: l.Title, OPML: OPMLFile}
+	if aggregate {
+		data.Aggregate = AggregateFile
+	}
+	for _, e := range l.Entries {
+		data.Books = append(data.Books, bookRow{
+			Title:    e.Book.Title,
+			Author:   e.Book.Author,
+			Episodes: len(e.Book.Episodes),
+			Duration: e.Duration(),
+			FeedURL:  l.FeedURL(e),
+		})
+	}
+	return indexTemplate.Execute(w, data)
+}
+
+// Aggregate builds a "new in library" feed of the latest released episodes
+// across all books
+func (l Library) Aggregate(limit int, now time.Time) rss.RssBody {
+	clock := rss.Clock(func() time.Time { return now })
+	items := []rss.RssBody{}
+	for _, e := range l.Entries {
+		book := e.Book.ReleasedBy(now)
+		book.Episodes = append(book.Episodes[:0:0], book.Episodes...)
+		for i := range book.Episodes {
+			ep := &book.Episodes[i]
+			if ep.PubDate.IsZero() && !book.Created.IsZero() {
+				// Keep dates of unscheduled episodes stable between runs
+				ep.PubDate = book.Created.Add(time.Duration(ep.Pos) * time.Second)
+			}
+			ep.Name = book.Title + ": " + ep.Name
+			if l.BaseURL != "" {
+				ep.Href = l.bookURL(e, ep.File)
+			}
+		}
+		items = append(items, rss.Generate(book, clock))
+	}
+
+	library := utils.BookMeta{ID: "library", Title: l.Title}
+	feed := rss.Generate(library, clock)
+	feed.Channel.Description = "New in " + l.Title
+	for _, body := range items {
+		feed.Channel.Entries = append(feed.Channel.Entries, body.Channel.Entries...)
+	}
+	entries := feed.Channel.Entries
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].PubDate.After(entries[j].PubDate.Time)
+	})
+	if limit > 0 && len(entries) > limit {
+		feed.Channel.Entries = entries[:limit]
+	}
+	self := l.url(AggregateFile)
+	feed.Channel.Link = self
+	feed.Channel.AtomLink.Href = self
+	feed.Channel.Image.Link = self
+	return feed
+}
@@ -0,0 +1,112 @@
+package library
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/histrio/rssbook/pkg/manifest"
+	"github.com/histrio/rssbook/pkg/utils"
+)
+
+var created = time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+
+func writeBook(t *testing.T, dir string, book utils.BookMeta) {
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := (manifest.Manifest{Book: book}).Write(dir); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func testLibrary(t *testing.T) (string, Library) {
+	root := t.TempDir()
+	first := utils.BookMeta{ID: "first", Title: "First & Best", Author: "A", Created: created}
+	for pos := 1; pos <= 2; pos++ {
+		first.Episodes = append(first.Episodes, utils.BookEpisode{
+			Pos: pos, Name: "Episode", File: "episode.mp3", Duration: time.Hour,
+		})
+	}
+	second := utils.BookMeta{ID: "second", Title: "Second", Author: "B", Created: created}
+	second.Episodes = append(second.Episodes,
+		utils.BookEpisode{Pos: 1, Name: "Episode 001", File: "episode-001.mp3", PubDate: created.Add(48 * time.Hour)},
+		utils.BookEpisode{Pos: 2, Name: "Episode 002", File: "episode-002.mp3", PubDate: created.Add(72 * time.Hour)},
+	)
+	writeBook(t, filepath.Join(root, "first"), first)
+	writeBook(t, filepath.Join(root, "my series", "second"), second)
+	os.MkdirAll(filepath.Join(root, "empty"), 0777)
+
+	entries, err := Scan(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return root, Library{Title: "Library", BaseURL: "https://books.example.com/", Entries: entries}
+}
+
+func TestScan(t *testing.T) {
+	root, lib := testLibrary(t)
+	if len(lib.Entries) != 2 {
+		t.Fatalf("Scan() found %d books", len(lib.Entries))
+	}
+	if lib.Entries[0].Book.ID != "first" || lib.Entries[1].Dir != filepath.Join(root, "my series", "second") {
+		t.Errorf("Scan() = %+v", lib.Entries)
+	}
+	if lib.Entries[0].Path != "first" || lib.Entries[1].Path != "my series/second" {
+		t.Errorf("Scan() paths = %q, %q", lib.Entries[0].Path, lib.Entries[1].Path)
+	}
+	if got := lib.Entries[0].Duration(); got != 2*time.Hour {
+		t.Errorf("Duration() = %v", got)
+	}
+}
+
+func TestWriteOPML(t *testing.T) {
+	_, lib := testLibrary(t)
+	var b bytes.Buffer
+	if err := lib.WriteOPML(&b, created); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		`<opml version="2.0">`,
+		`<dateCreated>Thu, 01 Oct 2026 00:00:00 +0000</dateCreated>`,
+		`<outline type="rss" text="First &amp; Best" title="First &amp; Best" xmlUrl="https://books.example.com/first/first.xml"></outline>`,
+		`<outline type="rss" text="Second" title="Second" xmlUrl="https://books.example.com/my%20series/second/second.xml"></outline>`,
+	} {
+		if !strings.Contains(b.String(), want) {
+			t.Errorf("OPML has no %s:\n%s", want, b.String())
+		}
+	}
+}
+
+func TestWriteHTML(t *testing.T) {
+	_, lib := testLibrary(t)
+	var b bytes.Buffer
+	if err := lib.WriteHTML(&b, false); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), `<td>First &amp; Best</td>`) || strings.Contains(b.String(), AggregateFile) {
+		t.Errorf("unexpected index:\n%s", b.String())
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	_, lib := testLibrary(t)
+	feed := lib.Aggregate(2, created.Add(60*time.Hour))
+	entries := feed.Channel.Entries
+	if len(entries) != 2 {
+		t.Fatalf("got %d items, want 2", len(entries))
+	}
+	// Unreleased episode of the second book is skipped
+	if entries[0].Title != "Second: Episode 001" || entries[1].Title != "First & Best: Episode" {
+		t.Errorf("items = %q, %q", entries[0].Title, entries[1].Title)
+	}
+	if entries[0].Enclosure.URL != "https://books.example.com/my%20series/second/episode-001.mp3" {
+		t.Errorf("enclosure = %q", entries[0].Enclosure.URL)
+	}
+	if feed.Channel.AtomLink.Href != "https://books.example.com/library.xml" {
+		t.Errorf("self link = %q", feed.Channel.AtomLink.Href)
+	}
+}
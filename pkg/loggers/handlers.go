@@ -0,0 +1,127 @@
+package loggers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Formats of handlers by their names
+var Formats = map[string]func(w io.Writer) Handler{
+	"text": TextHandler,
+	"json": JSONHandler,
+}
+
+// Open returns a logger writing to w in the named format and level
+func Open(w io.Writer, format string, level string) (*Logger, error) {
+	newHandler, ok := Formats[format]
+	if !ok {
+		return nil, fmt.Errorf("unknown log format %q, use text or json", format)
+	}
+	l, err := ParseLevel(level)
+	if err != nil {
+		return nil, err
+	}
+	return New(newHandler(w), l), nil
+}
+
+// value returns a printable form of the field value
+func value(v interface{}) interface{} {
+	switch v := v.(type) {
+	case error:
+		return v.Error()
+	case time.Duration:
+		return v.String()
+	case time.Time:
+		return v
+	case fmt.Stringer:
+		return v.String()
+	}
+	return v
+}
+
+type textHandler struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// TextHandler writes a line per record: time, level, message and key=value
+// fields
+func TextHandler(w io.Writer) Handler {
+	return &textHandler{w: w}
+}
+
+// quote quotes text unless it is a single plain word
+func quote(s string) string {
+	if s == "" || strings.ContainsAny(s, " \t\r\n\"=") {
+		return strconv.Quote(s)
+	}
+	return s
+}
+
+func (h *textHandler) Handle(r Record) error {
+	var b bytes.Buffer
+	b.WriteString(r.Time.Format("2006/01/02 15:04:05 "))
+	b.WriteString(strings.ToUpper(r.Level.String()))
+	b.WriteString(": ")
+	b.WriteString(r.Message)
+	for _, f := range r.Fields {
+		v := value(f.Value)
+		if t, ok := v.(time.Time); ok {
+			v = t.Format(time.RFC3339)
+		}
+		b.WriteString(" " + f.Key + "=" + quote(fmt.Sprint(v)))
+	}
+	b.WriteByte('\n')
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := h.w.Write(b.Bytes())
+	return err
+}
+
+type jsonHandler struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// JSONHandler writes a JSON object per line with time, level, msg and fields
+// keys
+func JSONHandler(w io.Writer) Handler {
+	return &jsonHandler{w: w}
+}
+
+func (h *jsonHandler) Handle(r Record) error {
+	var b bytes.Buffer
+	b.WriteString(`{"time":`)
+	writeJSON(&b, r.Time)
+	b.WriteString(`,"level":`)
+	writeJSON(&b, r.Level.String())
+	b.WriteString(`,"msg":`)
+	writeJSON(&b, r.Message)
+	for _, f := range r.Fields {
+		b.WriteByte(',')
+		writeJSON(&b, f.Key)
+		b.WriteByte(':')
+		writeJSON(&b, value(f.Value))
+	}
+	b.WriteString("}\n")
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	_, err := h.w.Write(b.Bytes())
+	return err
+}
+
+// writeJSON encodes the value, values JSON can not encode are written as
+// text
+func writeJSON(b *bytes.Buffer, v interface{}) {
+	content, err := json.Marshal(v)
+	if err != nil {
+		content, _ = json.Marshal(fmt.Sprint(v))
+	}
+	b.Write(content)
+}
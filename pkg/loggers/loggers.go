@@ -1,36 +1,146 @@
 package loggers
 
 import (
-	"io"
-	"log"
+	"fmt"
+	"os"
+	"strings"
+	"time"
 )
 
-var (
-	Debug   *log.Logger
-	Info    *log.Logger
-	Warning *log.Logger
-	Error   *log.Logger
+// Level is a severity of a log record
+type Level int
+
+// Levels in order of severity
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarning
+	LevelError
 )
 
-func InitLoggers(
-	debugHandler io.Writer,
-	infoHandle io.Writer,
-	warningHandle io.Writer,
-	errorHandle io.Writer) {
+var levelNames = []string{"debug", "info", "warning", "error"}
+
+func (l Level) String() string {
+	if l < LevelDebug || l > LevelError {
+		return fmt.Sprintf("level(%d)", int(l))
+	}
+	return levelNames[l]
+}
+
+// ParseLevel returns a level by its name
+func ParseLevel(name string) (Level, error) {
+	name = strings.ToLower(name)
+	if name == "warn" {
+		return LevelWarning, nil
+	}
+	for i, levelName := range levelNames {
+		if name == levelName {
+			return Level(i), nil
+		}
+	}
+	return LevelInfo, fmt.Errorf("unknown log level %q, use one of %s", name, strings.Join(levelNames, ", "))
+}
+
+// Field is a named value attached to a record
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// Record is a logged message with its fields
+type Record struct {
+	Time    time.Time
+	Level   Level
+	Message string
+	Fields  []Field
+}
+
+// Handler writes records
+type Handler interface {
+	Handle(r Record) error
+}
+
+// Logger writes records of its level and above to the handler. A nil logger
+// discards everything.
+type Logger struct {
+	handler Handler
+	level   Level
+	fields  []Field
+	now     func() time.Time
+}
+
+// New returns a logger writing records of the level and above
+func New(h Handler, level Level) *Logger {
+	return &Logger{handler: h, level: level, now: time.Now}
+}
+
+// fields turns key-value pairs into fields, an odd value is kept under the
+// "extra" key
+func fields(keyvals []interface{}) []Field {
+	result := make([]Field, 0, (len(keyvals)+1)/2)
+	for i := 0; i < len(keyvals); i += 2 {
+		if i+1 == len(keyvals) {
+			result = append(result, Field{Key: "extra", Value: keyvals[i]})
+			break
+		}
+		result = append(result, Field{Key: fmt.Sprint(keyvals[i]), Value: keyvals[i+1]})
+	}
+	return result
+}
+
+// With returns a logger adding the key-value pairs to every record
+func (l *Logger) With(keyvals ...interface{}) *Logger {
+	if l == nil {
+		return nil
+	}
+	child := *l
+	child.fields = append(append([]Field{}, l.fields...), fields(keyvals)...)
+	return &child
+}
+
+// Enabled tells whether records of the level are written
+func (l *Logger) Enabled(level Level) bool {
+	return l != nil && level >= l.level
+}
 
-	Debug = log.New(debugHandler,
-		"DEBUG: ",
-		log.Ldate|log.Ltime|log.Lshortfile)
+// Log writes the message with key-value pairs
+func (l *Logger) Log(level Level, msg string, keyvals ...interface{}) {
+	if !l.Enabled(level) {
+		return
+	}
+	r := Record{
+		Time:    l.now(),
+		Level:   level,
+		Message: msg,
+		Fields:  append(append([]Field{}, l.fields...), fields(keyvals)...),
+	}
+	if err := l.handler.Handle(r); err != nil {
+		fmt.Fprintf(os.Stderr, "logging failed: %s\n", err)
+	}
+}
+
+// Debug logs the message with key-value pairs at the debug level
+func (l *Logger) Debug(msg string, keyvals ...interface{}) {
+	l.Log(LevelDebug, msg, keyvals...)
+}
 
-	Info = log.New(infoHandle,
-		"INFO: ",
-		log.Ldate|log.Ltime|log.Lshortfile)
+// Info logs the message with key-value pairs at the info level
+func (l *Logger) Info(msg string, keyvals ...interface{}) {
+	l.Log(LevelInfo, msg, keyvals...)
+}
 
-	Warning = log.New(warningHandle,
-		"WARNING: ",
-		log.Ldate|log.Ltime|log.Lshortfile)
+// Warning logs the message with key-value pairs at the warning level
+func (l *Logger) Warning(msg string, keyvals ...interface{}) {
+	l.Log(LevelWarning, msg, keyvals...)
+}
+
+// Error logs the message with key-value pairs at the error level
+func (l *Logger) Error(msg string, keyvals ...interface{}) {
+	l.Log(LevelError, msg, keyvals...)
+}
 
-	Error = log.New(errorHandle,
-		"ERROR: ",
-		log.Ldate|log.Ltime|log.Lshortfile)
+// Fatal logs the message at the error level and exits
+func (l *Logger) Fatal(msg string, keyvals ...interface{}) {
+	l.Log(LevelError, msg, keyvals...)
+	os.Exit(1)
 }
@@ -0,0 +1,78 @@
+package loggers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func fixedClock() time.Time {
+	return time.Date(2026, 10, 1, 7, 30, 0, 0, time.UTC)
+}
+
+func TestTextHandler(t *testing.T) {
+	var out bytes.Buffer
+	l := New(TextHandler(&out), LevelInfo)
+	l.now = fixedClock
+	book := l.With("book", "saga")
+	book.Debug("hidden")
+	book.Info("Issued", "episode", "episode-001.mp3", "duration", 90*time.Second)
+	book.Warning("No author specified")
+	book.Error("Failed", "err", errors.New("exit status 1"), "odd")
+
+	want := `2026/10/01 07:30:00 INFO: Issued book=saga episode=episode-001.mp3 duration=1m30s
+2026/10/01 07:30:00 WARNING: No author specified book=saga
+2026/10/01 07:30:00 ERROR: Failed book=saga err="exit status 1" extra=odd
+`
+	if out.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", out.String(), want)
+	}
+}
+
+func TestJSONHandler(t *testing.T) {
+	var out bytes.Buffer
+	l, err := Open(&out, "json", "debug")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.now = fixedClock
+	l.With("book", "saga").Debug("Split", "from", time.Second, "pos", 3)
+
+	var record map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &record); err != nil {
+		t.Fatalf("%q: %v", out.String(), err)
+	}
+	want := map[string]interface{}{
+		"time":  "2026-10-01T07:30:00Z",
+		"level": "debug",
+		"msg":   "Split",
+		"book":  "saga",
+		"from":  "1s",
+		"pos":   float64(3),
+	}
+	for k, v := range want {
+		if record[k] != v {
+			t.Errorf("%s = %v, want %v", k, record[k], v)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	if l, err := ParseLevel("WARN"); err != nil || l != LevelWarning {
+		t.Errorf("ParseLevel() = %v, %v", l, err)
+	}
+	if _, err := ParseLevel("loud"); err == nil {
+		t.Error("ParseLevel() accepted an unknown level")
+	}
+	if _, err := Open(&bytes.Buffer{}, "xml", "info"); err == nil {
+		t.Error("Open() accepted an unknown format")
+	}
+
+	var none *Logger
+	none.With("book", "saga").Info("dropped")
+	if none.Enabled(LevelError) {
+		t.Error("nil logger is enabled")
+	}
+}
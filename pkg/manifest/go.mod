@@ -0,0 +1,3 @@
+module histrio/rssbook/pkg/manifest
+
+go 1.17
@@ -0,0 +1,48 @@
+package manifest
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+
+	"github.com/histrio/rssbook/pkg/utils"
+)
+
+// FileName is a name of the manifest file in a built book directory
+const FileName = "rssbook.json"
+
+// Manifest describes a built book, so feeds can be regenerated without
+// processing the audio again
+type Manifest struct {
+	Book     utils.BookMeta `json:"book"`
+	Schedule string         `json:"schedule,omitempty"`
+	// Volumes are directories of books combined into a series, relative to
+	// the series directory
+	Volumes []string `json:"volumes,omitempty"`
+	// Files are MD5 checksums of episode files by their names, publishing
+	// compares them with the remote ones
+	Files map[string]string `json:"files,omitempty"`
+	// Loudness caches measurements of source files by MD5 checksums of
+	// their content, so updates don't measure them again
+	Loudness map[string]utils.Loudness `json:"loudness,omitempty"`
+}
+
+// Read loads a manifest from the book directory
+func Read(dir string) (Manifest, error) {
+	var m Manifest
+	data, err := os.ReadFile(filepath.Join(dir, FileName))
+	if err != nil {
+		return m, err
+	}
+	err = json.Unmarshal(data, &m)
+	return m, err
+}
+
+// Write saves the manifest into the book directory
+func (m Manifest) Write(dir string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, FileName), append(data, '\n'), 0644)
+}
@@ -0,0 +1,3 @@
+module histrio/rssbook/pkg/order
+
+go 1.17
@@ -0,0 +1,236 @@
+// Package order sorts source files of a book: naturally by names, by track
+// tags or as an order file lists them
+package order
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Orders of source files
+const (
+	// Name orders files naturally by their paths
+	Name = "name"
+	// Tags orders files by disc and track tags
+	Tags = "tags"
+)
+
+// Names returns known orders
+func Names() []string {
+	return []string{Name, Tags}
+}
+
+// chunk returns the leading run of digits or of other characters
+func chunk(s string) string {
+	digits := s[0] >= '0' && s[0] <= '9'
+	i := 1
+	for i < len(s) && (s[i] >= '0' && s[i] <= '9') == digits {
+		i++
+	}
+	return s[:i]
+}
+
+func compareChunks(a, b string) int {
+	if a[0] >= '0' && a[0] <= '9' && b[0] >= '0' && b[0] <= '9' {
+		na, nb := strings.TrimLeft(a, "0"), strings.TrimLeft(b, "0")
+		if len(na) != len(nb) {
+			return len(na) - len(nb)
+		}
+		return strings.Compare(na, nb)
+	}
+	return strings.Compare(strings.ToLower(a), strings.ToLower(b))
+}
+
+func natural(x, y string) int {
+	for x != "" && y != "" {
+		cx, cy := chunk(x), chunk(y)
+		if c := compareChunks(cx, cy); c != 0 {
+			return c
+		}
+		x, y = x[len(cx):], y[len(cy):]
+	}
+	return len(x) - len(y)
+}
+
+// compare compares names naturally, numbers by their value and letters
+// ignoring case. Extensions are compared last, so "Chapter.mp3" goes before
+// "Chapter 1.mp3". Names equal this way are compared as strings.
+func compare(a, b string) int {
+	extA, extB := filepath.Ext(a), filepath.Ext(b)
+	if c := natural(strings.TrimSuffix(a, extA), strings.TrimSuffix(b, extB)); c != 0 {
+		return c
+	}
+	if c := natural(extA, extB); c != 0 {
+		return c
+	}
+	return strings.Compare(a, b)
+}
+
+// Less tells whether the name goes before the other one in natural order,
+// e.g. "Chapter 2" goes before "Chapter 10"
+func Less(a, b string) bool {
+	return compare(a, b) < 0
+}
+
+// Sort orders paths naturally folder by folder, so "Disc 2/01.mp3" goes
+// before "Disc 10/01.mp3"
+func Sort(paths []string) {
+	sort.SliceStable(paths, func(i, j int) bool {
+		a := strings.Split(filepath.ToSlash(paths[i]), "/")
+		b := strings.Split(filepath.ToSlash(paths[j]), "/")
+		for k := 0; k < len(a) && k < len(b); k++ {
+			if c := compare(a[k], b[k]); c != 0 {
+				return c < 0
+			}
+		}
+		return len(a) < len(b)
+	})
+}
+
+// Track is a position of a file in a book
+type Track struct {
+	Disc   int
+	Number int
+}
+
+// number returns the leading number of a tag, which may come as "2/5"
+func number(value string) int {
+	value = strings.TrimSpace(value)
+	if i := strings.Index(value, "/"); i >= 0 {
+		value = value[:i]
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil || n < 0 {
+		return 0
+	}
+	return n
+}
+
+// TrackFromTags returns the position of a file in its lower cased tags, ok
+// is false without a track number
+func TrackFromTags(tags map[string]string) (t Track, ok bool) {
+	for _, name := range []string{"track", "tracknumber"} {
+		if t.Number = number(tags[name]); t.Number > 0 {
+			break
+		}
+	}
+	for _, name := range []string{"disc", "discnumber"} {
+		if t.Disc = number(tags[name]); t.Disc > 0 {
+			break
+		}
+	}
+	return t, t.Number > 0
+}
+
+// ByTracks returns files ordered by their tracks. Files without a track go
+// last, the given order is kept for them and for equal tracks.
+func ByTracks(files []string, tracks map[string]Track) []string {
+	ordered := append([]string{}, files...)
+	sort.SliceStable(ordered, func(i, j int) bool {
+		a, okA := tracks[ordered[i]]
+		b, okB := tracks[ordered[j]]
+		if !okA || !okB {
+			return okA && !okB
+		}
+		if a.Disc != b.Disc {
+			return a.Disc < b.Disc
+		}
+		return a.Number < b.Number
+	})
+	return ordered
+}
+
+// FindList returns the order file of the folder: order.txt or a playlist,
+// "" if there is none
+func FindList(dir string) (string, error) {
+	list := filepath.Join(dir, "order.txt")
+	if _, err := os.Stat(list); err == nil {
+		return list, nil
+	} else if !os.IsNotExist(err) {
+		return "", err
+	}
+	playlists := []string{}
+	for _, pattern := range []string{"*.m3u8", "*.m3u"} {
+		found, err := filepath.Glob(filepath.Join(dir, pattern))
+		if err != nil {
+			return "", err
+		}
+		playlists = append(playlists, found...)
+	}
+	if len(playlists) == 0 {
+		return "", nil
+	}
+	Sort(playlists)
+	return playlists[0], nil
+}
+
+// ReadList returns paths listed in an order file, an M3U playlist or a text
+// file of names one per line. Relative paths are resolved against the folder
+// of the list.
+func ReadList(path string) ([]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	listed := []string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimPrefix(scanner.Text(), "\ufeff")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		name := filepath.FromSlash(line)
+		if !filepath.IsAbs(name) {
+			name = filepath.Join(filepath.Dir(path), name)
+		}
+		listed = append(listed, filepath.Clean(name))
+	}
+	return listed, scanner.Err()
+}
+
+// Apply returns files in the listed order. Listed paths which are not among
+// the files are returned as missing, files not listed go last in the given
+// order and are returned as unlisted.
+func Apply(files []string, listed []string) (ordered []string, missing []string, unlisted []string) {
+	known := map[string]string{}
+	for _, f := range files {
+		known[filepath.Clean(f)] = f
+	}
+	used := map[string]bool{}
+	for _, name := range listed {
+		f, ok := known[filepath.Clean(name)]
+		switch {
+		case !ok:
+			missing = append(missing, name)
+		case !used[f]:
+			used[f] = true
+			ordered = append(ordered, f)
+		}
+	}
+	for _, f := range files {
+		if !used[f] {
+			unlisted = append(unlisted, f)
+			ordered = append(ordered, f)
+		}
+	}
+	return ordered, missing, unlisted
+}
+
+// Mismatch returns the first position where orders of the same files differ,
+// -1 if they agree
+func Mismatch(a []string, b []string) int {
+	for i := range a {
+		if i >= len(b) || a[i] != b[i] {
+			return i
+		}
+	}
+	if len(b) > len(a) {
+		return len(a)
+	}
+	return -1
+}
@@ -0,0 +1,143 @@
+package order
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSort(t *testing.T) {
+	paths := []string{
+		"book/Chapter 10.mp3",
+		"book/chapter 1.mp3",
+		"book/Chapter 2.mp3",
+		"book/Disc 10/01.mp3",
+		"book/Disc 2/10.mp3",
+		"book/Disc 2/9.mp3",
+		"book/Chapter 02.mp3",
+		"book/Chapter 2a.mp3",
+		"book/Chapter.mp3",
+		"book/Disc 2.mp3",
+	}
+	Sort(paths)
+	want := []string{
+		"book/Chapter.mp3",
+		"book/chapter 1.mp3",
+		"book/Chapter 02.mp3",
+		"book/Chapter 2.mp3",
+		"book/Chapter 2a.mp3",
+		"book/Chapter 10.mp3",
+		"book/Disc 2/9.mp3",
+		"book/Disc 2/10.mp3",
+		"book/Disc 2.mp3",
+		"book/Disc 10/01.mp3",
+	}
+	if !reflect.DeepEqual(paths, want) {
+		t.Errorf("Sort() = %q\nwant %q", paths, want)
+	}
+}
+
+func TestLess(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"2", "10", true},
+		{"10", "2", false},
+		{"a", "B", true},
+		{"99999999999999999999", "100000000000000000000", true},
+		{"x", "x", false},
+		{"x", "x1", true},
+		{"1 - a", "1-a", true},
+	}
+	for _, tt := range tests {
+		if got := Less(tt.a, tt.b); got != tt.want {
+			t.Errorf("Less(%q, %q) = %v", tt.a, tt.b, got)
+		}
+	}
+}
+
+func TestTrackFromTags(t *testing.T) {
+	tests := []struct {
+		tags map[string]string
+		want Track
+		ok   bool
+	}{
+		{map[string]string{"track": "3/12", "disc": "2/2"}, Track{Disc: 2, Number: 3}, true},
+		{map[string]string{"tracknumber": " 7 ", "discnumber": "1"}, Track{Disc: 1, Number: 7}, true},
+		{map[string]string{"disc": "1"}, Track{Disc: 1}, false},
+		{map[string]string{"track": "A1"}, Track{}, false},
+	}
+	for _, tt := range tests {
+		if got, ok := TrackFromTags(tt.tags); got != tt.want || ok != tt.ok {
+			t.Errorf("TrackFromTags(%v) = %+v, %v", tt.tags, got, ok)
+		}
+	}
+}
+
+func TestByTracks(t *testing.T) {
+	files := []string{"a", "b", "c", "d", "e"}
+	tracks := map[string]Track{
+		"a": {Disc: 2, Number: 1},
+		"b": {Disc: 1, Number: 2},
+		"d": {Disc: 1, Number: 1},
+		"e": {Disc: 1, Number: 1},
+	}
+	want := []string{"d", "e", "b", "a", "c"}
+	if got := ByTracks(files, tracks); !reflect.DeepEqual(got, want) {
+		t.Errorf("ByTracks() = %q, want %q", got, want)
+	}
+	if files[0] != "a" {
+		t.Error("files are reordered in place")
+	}
+	if i := Mismatch(files, want); i != 0 {
+		t.Errorf("Mismatch() = %d", i)
+	}
+	if i := Mismatch(files, files); i != -1 {
+		t.Errorf("Mismatch() of the same order = %d", i)
+	}
+}
+
+func TestList(t *testing.T) {
+	dir := t.TempDir()
+	if list, err := FindList(dir); list != "" || err != nil {
+		t.Fatalf("FindList() of an empty folder = %q, %v", list, err)
+	}
+	files := []string{}
+	for _, name := range []string{"01.mp3", "02.mp3", "03.mp3", "04.mp3"} {
+		files = append(files, filepath.Join(dir, name))
+	}
+	playlist := strings.Join([]string{"\ufeff#EXTM3U", "#EXTINF:10,Three", "03.mp3", "", "01.mp3", "gone.mp3", "03.mp3", filepath.Join(dir, "02.mp3")}, "\r\n")
+	if err := os.WriteFile(filepath.Join(dir, "book.m3u"), []byte(playlist), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := FindList(dir)
+	if err != nil || list != filepath.Join(dir, "book.m3u") {
+		t.Fatalf("FindList() = %q, %v", list, err)
+	}
+	listed, err := ReadList(list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ordered, missing, unlisted := Apply(files, listed)
+	if want := []string{files[2], files[0], files[1], files[3]}; !reflect.DeepEqual(ordered, want) {
+		t.Errorf("ordered = %q, want %q", ordered, want)
+	}
+	if want := []string{filepath.Join(dir, "gone.mp3")}; !reflect.DeepEqual(missing, want) {
+		t.Errorf("missing = %q, want %q", missing, want)
+	}
+	if want := []string{files[3]}; !reflect.DeepEqual(unlisted, want) {
+		t.Errorf("unlisted = %q, want %q", unlisted, want)
+	}
+
+	// A text list goes before playlists
+	if err := os.WriteFile(filepath.Join(dir, "order.txt"), []byte("04.mp3\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if list, err := FindList(dir); list != filepath.Join(dir, "order.txt") || err != nil {
+		t.Errorf("FindList() = %q, %v", list, err)
+	}
+}
@@ -0,0 +1,3 @@
+module histrio/rssbook/pkg/playlist
+
+go 1.17
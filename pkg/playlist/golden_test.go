@@ -0,0 +1,48 @@
+package playlist
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/histrio/rssbook/pkg/internal/golden"
+	"github.com/histrio/rssbook/pkg/utils"
+)
+
+func goldenBook() utils.BookMeta {
+	book := utils.BookMeta{ID: "war-and-peace", Title: "Война & мир", Author: "Лев Толстой"}
+	episodes := []struct {
+		name, file string
+		duration   time.Duration
+	}{
+		{"Episode 001", "episode-001.mp3", 8 * time.Minute},
+		{"Episode 002", "episode-002.mp3", 7*time.Minute + 59500*time.Millisecond},
+		{"Episode <003> & epilogue", "episode <003>.mp3", 42 * time.Second},
+	}
+	for i, ep := range episodes {
+		book.Episodes = append(book.Episodes, utils.BookEpisode{
+			Pos: i + 1, Name: ep.name, File: ep.file, Duration: ep.duration,
+			Href: utils.S3Url + book.ID + "/" + ep.file,
+		})
+	}
+	return book
+}
+
+func TestGoldenPlaylists(t *testing.T) {
+	for _, absolute := range []bool{false, true} {
+		p := FromBook(goldenBook(), absolute)
+		suffix := "relative"
+		if absolute {
+			suffix = "absolute"
+		}
+		for _, name := range FormatNames() {
+			t.Run(name+"/"+suffix, func(t *testing.T) {
+				var b bytes.Buffer
+				if err := Formats[name](&b, p); err != nil {
+					t.Fatal(err)
+				}
+				golden.Check(t, suffix+"."+name, b.Bytes())
+			})
+		}
+	}
+}
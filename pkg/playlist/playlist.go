@@ -0,0 +1,172 @@
+package playlist
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/histrio/rssbook/pkg/utils"
+)
+
+// Entry is a single track of a playlist
+type Entry struct {
+	Title    string
+	Duration time.Duration
+	// Location is either a path relative to the playlist or an absolute URL
+	Location string
+}
+
+// Playlist is a format independent list of book episodes
+type Playlist struct {
+	Title   string
+	Artist  string
+	Image   string
+	Entries []Entry
+}
+
+// FromBook makes a playlist of the book's episodes. Entries point to episode
+// files next to the playlist, or to their public URLs if absolute is set.
+func FromBook(book utils.BookMeta, absolute bool) Playlist {
+	p := Playlist{
+		Title:  book.Title,
+		Artist: book.Author,
+		Image:  book.ImageURL(),
+	}
+	for _, ep := range book.Episodes {
+		location := ep.File
+		if absolute {
+			location = ep.Href
+		}
+		p.Entries = append(p.Entries, Entry{
+			Title:    ep.Name,
+			Duration: ep.Duration,
+			Location: location,
+		})
+	}
+	return p
+}
+
+// seconds rounds up the duration to whole seconds as players expect
+func seconds(d time.Duration) int {
+	return int((d + time.Second - 1) / time.Second)
+}
+
+// oneLine keeps line based formats intact
+func oneLine(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// WriteM3U writes the playlist as extended M3U
+func WriteM3U(w io.Writer, p Playlist) error {
+	var b strings.Builder
+	b.WriteString("#EXTM3U\n")
+	if p.Title != "" {
+		fmt.Fprintf(&b, "#PLAYLIST:%s\n", oneLine(p.Title))
+	}
+	if p.Artist != "" {
+		fmt.Fprintf(&b, "#EXTART:%s\n", oneLine(p.Artist))
+	}
+	if p.Image != "" {
+		fmt.Fprintf(&b, "#EXTIMG:%s\n", p.Image)
+	}
+	for _, e := range p.Entries {
+		title := oneLine(e.Title)
+		if p.Artist != "" {
+			title = oneLine(p.Artist) + " - " + title
+		}
+		fmt.Fprintf(&b, "\n#EXTINF:%d,%s\n%s\n", seconds(e.Duration), title, e.Location)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WritePLS writes the playlist as PLS version 2
+func WritePLS(w io.Writer, p Playlist) error {
+	var b strings.Builder
+	b.WriteString("[playlist]\n")
+	for i, e := range p.Entries {
+		n := i + 1
+		fmt.Fprintf(&b, "File%d=%s\nTitle%d=%s\nLength%d=%d\n", n, e.Location, n, oneLine(e.Title), n, seconds(e.Duration))
+	}
+	fmt.Fprintf(&b, "NumberOfEntries=%d\nVersion=2\n", len(p.Entries))
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+type xspfTrack struct {
+	Location string `xml:"location"`
+	Title    string `xml:"title,omitempty"`
+	Creator  string `xml:"creator,omitempty"`
+	Album    string `xml:"album,omitempty"`
+	TrackNum int    `xml:"trackNum"`
+	Duration int64  `xml:"duration,omitempty"`
+}
+
+type xspfPlaylist struct {
+	XMLName xml.Name    `xml:"http://xspf.org/ns/0/ playlist"`
+	Version string      `xml:"version,attr"`
+	Title   string      `xml:"title,omitempty"`
+	Creator string      `xml:"creator,omitempty"`
+	Image   string      `xml:"image,omitempty"`
+	Tracks  []xspfTrack `xml:"trackList>track"`
+}
+
+// xspfLocation makes a URI of the entry location as XSPF requires
+func xspfLocation(location string) string {
+	if u, err := url.Parse(location); err == nil && u.Scheme != "" {
+		return location
+	}
+	return (&url.URL{Path: location}).String()
+}
+
+// WriteXSPF writes the playlist as XSPF version 1
+func WriteXSPF(w io.Writer, p Playlist) error {
+	doc := xspfPlaylist{
+		Version: "1",
+		Title:   p.Title,
+		Creator: p.Artist,
+		Image:   p.Image,
+		Tracks:  []xspfTrack{},
+	}
+	for i, e := range p.Entries {
+		doc.Tracks = append(doc.Tracks, xspfTrack{
+			Location: xspfLocation(e.Location),
+			Title:    e.Title,
+			Creator:  p.Artist,
+			Album:    p.Title,
+			TrackNum: i + 1,
+			Duration: e.Duration.Milliseconds(),
+		})
+	}
+	out, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, xml.Header+string(out)+"\n")
+	return err
+}
+
+// Writer writes a playlist in some format
+type Writer func(w io.Writer, p Playlist) error
+
+// Formats maps playlist formats to their writers. Format names are also file
+// extensions.
+var Formats = map[string]Writer{
+	"m3u":  WriteM3U,
+	"pls":  WritePLS,
+	"xspf": WriteXSPF,
+}
+
+// FormatNames returns supported formats sorted by name
+func FormatNames() []string {
+	names := []string{}
+	for name := range Formats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,117 @@
+package playlist
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/histrio/rssbook/pkg/utils"
+)
+
+func testPlaylist() Playlist {
+	return Playlist{
+		Title:  "Book",
+		Artist: "Author",
+		Image:  "http://example.com/cover.jpg",
+		Entries: []Entry{
+			{Title: "Episode 001", Duration: 1500 * time.Millisecond, Location: "episode 001.mp3"},
+			{Title: "Episode\n002", Duration: time.Minute, Location: "http://example.com/book/episode-002.mp3"},
+		},
+	}
+}
+
+func TestFromBook(t *testing.T) {
+	book := utils.BookMeta{ID: "book", Title: "Book", Author: "Author"}
+	book.Episodes = append(book.Episodes, utils.BookEpisode{
+		Name: "Episode 001", File: "episode-001.mp3", Href: "http://example.com/book/episode-001.mp3",
+	})
+	tests := []struct {
+		name     string
+		absolute bool
+		want     string
+	}{
+		{"relative", false, "episode-001.mp3"},
+		{"absolute", true, "http://example.com/book/episode-001.mp3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := FromBook(book, tt.absolute)
+			if got := p.Entries[0].Location; got != tt.want {
+				t.Errorf("Location = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriters(t *testing.T) {
+	tests := []struct {
+		name  string
+		write Writer
+		want  string
+	}{
+		{"m3u", WriteM3U, `#EXTM3U
+#PLAYLIST:Book
+#EXTART:Author
+#EXTIMG:http://example.com/cover.jpg
+
+#EXTINF:2,Author - Episode 001
+episode 001.mp3
+
+#EXTINF:60,Author - Episode 002
+http://example.com/book/episode-002.mp3
+`},
+		{"pls", WritePLS, `[playlist]
+File1=episode 001.mp3
+Title1=Episode 001
+Length1=2
+File2=http://example.com/book/episode-002.mp3
+Title2=Episode 002
+Length2=60
+NumberOfEntries=2
+Version=2
+`},
+		{"xspf", WriteXSPF, `<?xml version="1.0" encoding="UTF-8"?>
+<playlist xmlns="http://xspf.org/ns/0/" version="1">
+  <title>Book</title>
+  <creator>Author</creator>
+  <image>http://example.com/cover.jpg</image>
+  <trackList>
+    <track>
+      <location>episode%20001.mp3</location>
+      <title>Episode 001</title>
+      <creator>Author</creator>
+      <album>Book</album>
+      <trackNum>1</trackNum>
+      <duration>1500</duration>
+    </track>
+    <track>
+      <location>http://example.com/book/episode-002.mp3</location>
+      <title>Episode&#xA;002</title>
+      <creator>Author</creator>
+      <album>Book</album>
+      <trackNum>2</trackNum>
+      <duration>60000</duration>
+    </track>
+  </trackList>
+</playlist>
+`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b bytes.Buffer
+			if err := tt.write(&b, testPlaylist()); err != nil {
+				t.Fatal(err)
+			}
+			if b.String() != tt.want {
+				t.Errorf("got:\n%s\nwant:\n%s", b.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatNames(t *testing.T) {
+	if got := strings.Join(FormatNames(), ","); got != "m3u,pls,xspf" {
+		t.Errorf("FormatNames() = %s", got)
+	}
+}
@@ -0,0 +1,192 @@
+package probe
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// vorbisNames maps Vorbis comment fields to tag names, other fields are
+// named in lower case
+var vorbisNames = map[string]string{
+	"albumartist": "album_artist",
+	"tracknumber": "track",
+	"discnumber":  "disc",
+}
+
+// FLAC metadata block types
+const (
+	flacStreamInfo    = 0
+	flacVorbisComment = 4
+	flacPicture       = 6
+)
+
+// readStreamInfo reads a FLAC STREAMINFO block
+func readStreamInfo(b []byte, info *Info) {
+	if len(b) < 18 {
+		return
+	}
+	info.SampleRate = int(b[10])<<12 | int(b[11])<<4 | int(b[12])>>4
+	info.Channels = int((b[12]>>1)&7) + 1
+	samples := int64(b[13]&0x0f)<<32 | int64(binary.BigEndian.Uint32(b[14:]))
+	info.Duration = seconds(samples, int64(info.SampleRate))
+}
+
+// readPicture reads a FLAC PICTURE block
+func readPicture(b []byte, info *Info) {
+	field := func() []byte {
+		if len(b) < 4 {
+			return nil
+		}
+		n := int64(binary.BigEndian.Uint32(b))
+		if n > int64(len(b)-4) {
+			b = nil
+			return nil
+		}
+		f := b[4 : 4+n]
+		b = b[4+n:]
+		return f
+	}
+	if len(b) < 4 {
+		return
+	}
+	kind := binary.BigEndian.Uint32(b)
+	b = b[4:]
+	mime := field()
+	field()
+	if len(b) < 16 {
+		return
+	}
+	b = b[16:]
+	if data := field(); len(data) > 0 {
+		info.setCover(Picture{MIMEType: string(mime), Data: data}, kind == 3)
+	}
+}
+
+// parseChapterTime parses a HH:MM:SS.sss time of a Vorbis comment chapter
+func parseChapterTime(s string) (time.Duration, bool) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return 0, false
+	}
+	d := time.Duration(0)
+	for i, unit := range []time.Duration{time.Hour, time.Minute} {
+		n, err := strconv.Atoi(parts[i])
+		if err != nil {
+			return 0, false
+		}
+		d += time.Duration(n) * unit
+	}
+	sec, err := strconv.ParseFloat(parts[2], 64)
+	if err != nil {
+		return 0, false
+	}
+	return d + time.Duration(sec*float64(time.Second)), true
+}
+
+// readVorbisComment reads a Vorbis comment: tags, CHAPTERxxx chapters and
+// pictures
+func readVorbisComment(b []byte, info *Info) {
+	next := func() (string, bool) {
+		if len(b) < 4 {
+			return "", false
+		}
+		n := int64(binary.LittleEndian.Uint32(b))
+		if n > int64(len(b)-4) {
+			return "", false
+		}
+		s := string(b[4 : 4+n])
+		b = b[4+n:]
+		return s, true
+	}
+	if _, ok := next(); !ok {
+		return
+	}
+	if len(b) < 4 {
+		return
+	}
+	count := binary.LittleEndian.Uint32(b)
+	b = b[4:]
+	chapters := map[string]*Chapter{}
+	ids := []string{}
+	chapter := func(id string) *Chapter {
+		if c, ok := chapters[id]; ok {
+			return c
+		}
+		chapters[id] = &Chapter{}
+		ids = append(ids, id)
+		return chapters[id]
+	}
+	for i := uint32(0); i < count; i++ {
+		comment, ok := next()
+		if !ok {
+			break
+		}
+		eq := strings.IndexByte(comment, '=')
+		if eq <= 0 {
+			continue
+		}
+		name, value := strings.ToLower(comment[:eq]), comment[eq+1:]
+		switch {
+		case name == "metadata_block_picture":
+			if data, err := base64.StdEncoding.DecodeString(value); err == nil {
+				readPicture(data, info)
+			}
+		case strings.HasPrefix(name, "chapter") && strings.HasSuffix(name, "name"):
+			chapter(strings.TrimSuffix(name, "name")).Title = value
+		case strings.HasPrefix(name, "chapter") && len(name) > len("chapter") && strings.Trim(name[len("chapter"):], "0123456789") == "":
+			if start, ok := parseChapterTime(value); ok {
+				chapter(name).Start = start
+			}
+		default:
+			if mapped, ok := vorbisNames[name]; ok {
+				name = mapped
+			}
+			info.setTag(name, value)
+		}
+	}
+	for _, id := range ids {
+		info.Chapters = append(info.Chapters, *chapters[id])
+	}
+}
+
+// readFLAC reads metadata blocks of a native FLAC stream at the offset
+func readFLAC(r io.ReaderAt, off int64, size int64, info *Info) error {
+	info.Format = "flac"
+	info.Codec = "flac"
+	off += 4
+	for {
+		h, err := readAt(r, off, 4)
+		if err != nil {
+			return err
+		}
+		last, kind := h[0]&0x80 != 0, h[0]&0x7f
+		length := int64(h[1])<<16 | int64(h[2])<<8 | int64(h[3])
+		if kind == flacStreamInfo || kind == flacVorbisComment || kind == flacPicture {
+			b, err := readAt(r, off+4, length)
+			if err != nil {
+				return err
+			}
+			switch kind {
+			case flacStreamInfo:
+				readStreamInfo(b, info)
+			case flacVorbisComment:
+				readVorbisComment(b, info)
+			case flacPicture:
+				readPicture(b, info)
+			}
+		}
+		off += 4 + length
+		if last || kind == 0x7f {
+			break
+		}
+	}
+	if info.SampleRate == 0 {
+		return ErrFormat
+	}
+	info.finish(size - off)
+	return nil
+}
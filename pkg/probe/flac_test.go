@@ -0,0 +1,117 @@
+package probe
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func appendLE32(b []byte, v uint32) []byte {
+	return append(b, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+}
+
+func appendBE32(b []byte, v uint32) []byte {
+	return append(b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+// vorbisComment returns a Vorbis comment of the fields
+func vorbisComment(fields ...string) []byte {
+	b := []byte{}
+	add := func(s string) {
+		b = appendLE32(b, uint32(len(s)))
+		b = append(b, s...)
+	}
+	add("test vendor")
+	b = appendLE32(b, uint32(len(fields)))
+	for _, f := range fields {
+		add(f)
+	}
+	return b
+}
+
+// flacBlock returns a FLAC metadata block
+func flacBlock(kind byte, last bool, data []byte) []byte {
+	if last {
+		kind |= 0x80
+	}
+	n := len(data)
+	return append([]byte{kind, byte(n >> 16), byte(n >> 8), byte(n)}, data...)
+}
+
+// streamInfo returns a STREAMINFO block body of 16 bit audio
+func streamInfo(rate int, channels int, samples int64) []byte {
+	b := make([]byte, 34)
+	b[10] = byte(rate >> 12)
+	b[11] = byte(rate >> 4)
+	b[12] = byte(rate<<4) | byte(channels-1)<<1
+	b[13] = 15<<4 | byte(samples>>32&0x0f)
+	binary.BigEndian.PutUint32(b[14:], uint32(samples))
+	return b
+}
+
+// flacPictureBlock returns a PICTURE block body
+func flacPictureBlock(kind uint32, mime string, data []byte) []byte {
+	b := appendBE32(nil, kind)
+	b = appendBE32(b, uint32(len(mime)))
+	b = append(b, mime...)
+	b = appendBE32(b, 0)
+	b = append(b, make([]byte, 16)...)
+	b = appendBE32(b, uint32(len(data)))
+	return append(b, data...)
+}
+
+func TestReadFLAC(t *testing.T) {
+	cover := []byte("\x89PNG")
+	file := bytes.Join([][]byte{
+		[]byte("fLaC"),
+		flacBlock(flacStreamInfo, false, streamInfo(44100, 2, 441000)),
+		flacBlock(flacVorbisComment, false, vorbisComment(
+			"TITLE=Book", "Artist=Author", "TRACKNUMBER=3", "ALBUMARTIST=Reader",
+			"CHAPTER001=00:00:00.000", "CHAPTER001NAME=Intro",
+			"CHAPTER002=00:00:05.500", "CHAPTER002NAME=Two",
+			"GENRE=Audiobook", "GENRE=Classic",
+		)),
+		flacBlock(1, false, make([]byte, 100)),
+		flacBlock(flacPicture, true, flacPictureBlock(3, "image/png", cover)),
+		make([]byte, 1000),
+	}, nil)
+	info, err := Read(bytes.NewReader(file), int64(len(file)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Info{
+		Format:     "flac",
+		Codec:      "flac",
+		Duration:   10 * time.Second,
+		Bitrate:    800,
+		SampleRate: 44100,
+		Channels:   2,
+		Tags: map[string]string{
+			"title":        "Book",
+			"artist":       "Author",
+			"track":        "3",
+			"album_artist": "Reader",
+			"genre":        "Audiobook;Classic",
+		},
+		Chapters: []Chapter{
+			{Title: "Intro", Start: 0, End: 5500 * time.Millisecond},
+			{Title: "Two", Start: 5500 * time.Millisecond, End: 10 * time.Second},
+		},
+		Cover: &Picture{MIMEType: "image/png", Data: cover},
+	}
+	if !reflect.DeepEqual(info, want) {
+		t.Errorf("Read() = %+v\nwant %+v", info, want)
+	}
+}
+
+func TestReadVorbisCommentPicture(t *testing.T) {
+	picture := base64.StdEncoding.EncodeToString(flacPictureBlock(3, "image/jpeg", []byte{1, 2, 3}))
+	info := Info{}
+	readVorbisComment(vorbisComment("METADATA_BLOCK_PICTURE="+picture, "broken", "=empty"), &info)
+	if info.Cover == nil || info.Cover.MIMEType != "image/jpeg" || len(info.Tags) != 0 {
+		t.Errorf("readVorbisComment() = %+v", info)
+	}
+}
@@ -0,0 +1,3 @@
+module histrio/rssbook/pkg/probe
+
+go 1.17
@@ -0,0 +1,307 @@
+package probe
+
+import (
+	"encoding/binary"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// id3Names maps ID3v2.3 frames to tag names, ID3v2.2 frames are converted
+// to ID3v2.3 ones first. Other text frames are named by their lower cased
+// ids.
+var id3Names = map[string]string{
+	"TALB": "album",
+	"TCOM": "composer",
+	"TCON": "genre",
+	"TCOP": "copyright",
+	"TDRC": "date",
+	"TDRL": "date",
+	"TENC": "encoded_by",
+	"TIT1": "grouping",
+	"TIT2": "title",
+	"TIT3": "subtitle",
+	"TLAN": "language",
+	"TPE1": "artist",
+	"TPE2": "album_artist",
+	"TPE3": "performer",
+	"TPOS": "disc",
+	"TPUB": "publisher",
+	"TRCK": "track",
+	"TSOA": "album-sort",
+	"TSOP": "artist-sort",
+	"TSOT": "title-sort",
+	"TSSE": "encoder",
+	"TYER": "date",
+}
+
+// id3v22 maps ID3v2.2 frames to ID3v2.3 ones
+var id3v22 = map[string]string{
+	"COM": "COMM", "PIC": "APIC", "TAL": "TALB", "TCM": "TCOM", "TCO": "TCON",
+	"TCR": "TCOP", "TEN": "TENC", "TLA": "TLAN", "TP1": "TPE1", "TP2": "TPE2",
+	"TP3": "TPE3", "TPA": "TPOS", "TPB": "TPUB", "TRK": "TRCK", "TSS": "TSSE",
+	"TT1": "TIT1", "TT2": "TIT2", "TT3": "TIT3", "TXX": "TXXX", "TYE": "TYER",
+}
+
+func syncsafe(b []byte) int64 {
+	return int64(b[0]&0x7f)<<21 | int64(b[1]&0x7f)<<14 | int64(b[2]&0x7f)<<7 | int64(b[3]&0x7f)
+}
+
+// unsync removes zero bytes inserted after 0xFF by unsynchronisation
+func unsync(b []byte) []byte {
+	out := make([]byte, 0, len(b))
+	for i := 0; i < len(b); i++ {
+		out = append(out, b[i])
+		if b[i] == 0xff && i+1 < len(b) && b[i+1] == 0 {
+			i++
+		}
+	}
+	return out
+}
+
+// latin1 decodes ISO-8859-1 text
+func latin1(b []byte) string {
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+	return string(runes)
+}
+
+// decodeText decodes text of the ID3v2 encoding: ISO-8859-1, UTF-16 with a
+// BOM, UTF-16BE or UTF-8
+func decodeText(encoding byte, b []byte) string {
+	switch encoding {
+	case 1, 2:
+		order := binary.ByteOrder(binary.BigEndian)
+		if len(b) >= 2 && encoding == 1 {
+			switch {
+			case b[0] == 0xff && b[1] == 0xfe:
+				order, b = binary.LittleEndian, b[2:]
+			case b[0] == 0xfe && b[1] == 0xff:
+				b = b[2:]
+			}
+		}
+		units := make([]uint16, len(b)/2)
+		for i := range units {
+			units[i] = order.Uint16(b[2*i:])
+		}
+		return string(utf16.Decode(units))
+	case 3:
+		return string(b)
+	}
+	return latin1(b)
+}
+
+// splitText returns the first string of the encoding and the rest after its
+// terminator
+func splitText(encoding byte, b []byte) (string, []byte) {
+	if encoding == 1 || encoding == 2 {
+		for i := 0; i+1 < len(b); i += 2 {
+			if b[i] == 0 && b[i+1] == 0 {
+				return decodeText(encoding, b[:i]), b[i+2:]
+			}
+		}
+		return decodeText(encoding, b), nil
+	}
+	for i, c := range b {
+		if c == 0 {
+			return decodeText(encoding, b[:i]), b[i+1:]
+		}
+	}
+	return decodeText(encoding, b), nil
+}
+
+// readID3v2 reads an ID3v2 tag at the start of the file and returns its
+// size, zero without a tag. An ID3v1 tag at the end fills tags missing.
+func readID3v2(r io.ReaderAt, size int64, info *Info) (int64, error) {
+	defer readID3v1(r, size, info)
+	h, err := readAt(r, 0, 10)
+	if err != nil || string(h[:3]) != "ID3" {
+		return 0, nil
+	}
+	version, flags := h[3], h[5]
+	length := syncsafe(h[6:10])
+	total := 10 + length
+	if flags&0x10 != 0 {
+		total += 10
+	}
+	if version < 2 || version > 4 || total > size {
+		return total, nil
+	}
+	body, err := readAt(r, 10, length)
+	if err != nil {
+		return 0, err
+	}
+	if flags&0x80 != 0 && version < 4 {
+		body = unsync(body)
+	}
+	if flags&0x40 != 0 && len(body) >= 4 {
+		skip := int64(binary.BigEndian.Uint32(body)) + 4
+		if version == 4 {
+			skip = syncsafe(body)
+		}
+		if skip > int64(len(body)) {
+			return total, nil
+		}
+		body = body[skip:]
+	}
+	readID3Frames(body, version, info)
+	return total, nil
+}
+
+// readID3Frames reads frames of an ID3v2 tag of the version
+func readID3Frames(b []byte, version byte, info *Info) {
+	idSize, headerSize := 4, 10
+	if version == 2 {
+		idSize, headerSize = 3, 6
+	}
+	for len(b) >= headerSize && b[0] != 0 {
+		id := string(b[:idSize])
+		var size int64
+		var flags uint16
+		switch version {
+		case 2:
+			size = int64(b[3])<<16 | int64(b[4])<<8 | int64(b[5])
+			id = id3v22[id]
+		case 3:
+			size = int64(binary.BigEndian.Uint32(b[4:]))
+			flags = binary.BigEndian.Uint16(b[8:])
+		default:
+			size = syncsafe(b[4:8])
+			flags = binary.BigEndian.Uint16(b[8:])
+		}
+		if size > int64(len(b)-headerSize) {
+			return
+		}
+		data := b[headerSize : int64(headerSize)+size]
+		b = b[int64(headerSize)+size:]
+		switch version {
+		case 3:
+			// Compressed and encrypted frames are skipped
+			if flags&0xc0 != 0 {
+				continue
+			}
+			if flags&0x20 != 0 && len(data) > 0 {
+				data = data[1:]
+			}
+		case 4:
+			if flags&0x0c != 0 {
+				continue
+			}
+			if flags&0x40 != 0 && len(data) > 0 {
+				data = data[1:]
+			}
+			if flags&0x02 != 0 {
+				data = unsync(data)
+			}
+			if flags&0x01 != 0 && len(data) >= 4 {
+				data = data[4:]
+			}
+		}
+		readID3Frame(id, data, version, info)
+	}
+}
+
+func readID3Frame(id string, data []byte, version byte, info *Info) {
+	if id == "" || len(data) == 0 {
+		return
+	}
+	encoding := data[0]
+	switch {
+	case id == "TXXX":
+		name, rest := splitText(encoding, data[1:])
+		value, _ := splitText(encoding, rest)
+		info.setTag(strings.ToLower(name), value)
+	case id == "COMM" && len(data) >= 4:
+		_, rest := splitText(encoding, data[4:])
+		value, _ := splitText(encoding, rest)
+		info.setTag("comment", value)
+	case id[0] == 'T':
+		value, _ := splitText(encoding, data[1:])
+		name, ok := id3Names[id]
+		if !ok {
+			name = strings.ToLower(id)
+		}
+		info.setTag(name, value)
+	case id == "APIC":
+		readID3Picture(data, version, info)
+	case id == "CHAP":
+		element, rest := splitText(0, data)
+		if len(rest) < 16 {
+			return
+		}
+		start := binary.BigEndian.Uint32(rest)
+		end := binary.BigEndian.Uint32(rest[4:])
+		sub := Info{}
+		readID3Frames(rest[16:], version, &sub)
+		title := sub.Tags["title"]
+		if title == "" {
+			title = element
+		}
+		info.Chapters = append(info.Chapters, Chapter{
+			Title: title,
+			Start: time.Duration(start) * time.Millisecond,
+			End:   time.Duration(end) * time.Millisecond,
+		})
+	}
+}
+
+// readID3Picture reads an attached picture, ID3v2.2 ones have an image format
+// instead of a MIME type
+func readID3Picture(data []byte, version byte, info *Info) {
+	encoding := data[0]
+	var mime string
+	rest := data[1:]
+	if version == 2 {
+		if len(rest) < 3 {
+			return
+		}
+		mime = "image/" + strings.ToLower(strings.Replace(string(rest[:3]), "JPG", "jpeg", 1))
+		rest = rest[3:]
+	} else {
+		mime, rest = splitText(0, rest)
+	}
+	if len(rest) < 1 {
+		return
+	}
+	kind := rest[0]
+	_, rest = splitText(encoding, rest[1:])
+	if len(rest) == 0 {
+		return
+	}
+	info.setCover(Picture{MIMEType: mime, Data: rest}, kind == 3)
+}
+
+// readID3v1 reads an ID3v1 tag at the end of the file into tags missing
+func readID3v1(r io.ReaderAt, size int64, info *Info) {
+	b, err := readAt(r, size-128, 128)
+	if err != nil || string(b[:3]) != "TAG" {
+		return
+	}
+	field := func(b []byte) string {
+		if i := strings.IndexByte(string(b), 0); i >= 0 {
+			b = b[:i]
+		}
+		return strings.TrimSpace(latin1(b))
+	}
+	values := map[string]string{
+		"title":   field(b[3:33]),
+		"artist":  field(b[33:63]),
+		"album":   field(b[63:93]),
+		"date":    field(b[93:97]),
+		"comment": field(b[97:127]),
+	}
+	// ID3v1.1 keeps a track number in the end of the comment
+	if b[125] == 0 && b[126] != 0 {
+		values["comment"] = field(b[97:125])
+		values["track"] = strconv.Itoa(int(b[126]))
+	}
+	for name, value := range values {
+		if _, ok := info.Tags[name]; !ok {
+			info.setTag(name, value)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package probe
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+)
+
+// mpegBitrates are bitrates in kbit/s by MPEG version 1 or 2, layer and
+// bitrate index. MPEG 2.5 uses ones of MPEG 2.
+var mpegBitrates = [2][3][15]int{
+	{
+		{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448},
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384},
+		{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320},
+	},
+	{
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+	},
+}
+
+// mpegSampleRates are sample rates of MPEG 1, 2 and 2.5 by index
+var mpegSampleRates = [3][3]int{
+	{44100, 48000, 32000},
+	{22050, 24000, 16000},
+	{11025, 12000, 8000},
+}
+
+// frameHeader is a header of an MPEG audio frame
+type frameHeader struct {
+	// version is 0 for MPEG 1, 1 for MPEG 2 and 2 for MPEG 2.5
+	version    int
+	layer      int
+	bitrate    int
+	sampleRate int
+	padding    int
+	mono       bool
+}
+
+// parseFrameHeader parses four bytes of a frame header
+func parseFrameHeader(b []byte) (frameHeader, bool) {
+	if len(b) < 4 || b[0] != 0xff || b[1]&0xe0 != 0xe0 {
+		return frameHeader{}, false
+	}
+	h := frameHeader{}
+	switch (b[1] >> 3) & 3 {
+	case 0:
+		h.version = 2
+	case 2:
+		h.version = 1
+	case 3:
+		h.version = 0
+	default:
+		return h, false
+	}
+	h.layer = 4 - int((b[1]>>1)&3)
+	bitrate, rate := int(b[2]>>4), int((b[2]>>2)&3)
+	if h.layer == 4 || bitrate == 0 || bitrate == 15 || rate == 3 {
+		return h, false
+	}
+	table := 0
+	if h.version > 0 {
+		table = 1
+	}
+	h.bitrate = mpegBitrates[table][h.layer-1][bitrate] * 1000
+	h.sampleRate = mpegSampleRates[h.version][rate]
+	h.padding = int((b[2] >> 1) & 1)
+	h.mono = b[3]>>6 == 3
+	return h, true
+}
+
+// samples returns a number of samples per frame
+func (h frameHeader) samples() int {
+	switch {
+	case h.layer == 1:
+		return 384
+	case h.layer == 3 && h.version > 0:
+		return 576
+	}
+	return 1152
+}
+
+// size returns a length of the frame in bytes
+func (h frameHeader) size() int {
+	if h.layer == 1 {
+		return (12*h.bitrate/h.sampleRate + h.padding) * 4
+	}
+	return h.samples()/8*h.bitrate/h.sampleRate + h.padding
+}
+
+func (h frameHeader) codec() string {
+	return []string{"mp1", "mp2", "mp3"}[h.layer-1]
+}
+
+// sameStream tells whether the frame follows the other one in a stream
+func (h frameHeader) sameStream(other frameHeader) bool {
+	return h.version == other.version && h.layer == other.layer && h.sampleRate == other.sampleRate
+}
+
+// syncWindow limits the search of the first frame
+const syncWindow = 64 * 1024
+
+// findFrame returns the offset of the first frame confirmed by the next one
+func findFrame(r io.ReaderAt, start int64, end int64) (int64, frameHeader, bool) {
+	window, _ := readAt(r, start, min64(syncWindow, end-start))
+	for i := 0; i+4 <= len(window); i++ {
+		h, ok := parseFrameHeader(window[i:])
+		if !ok {
+			continue
+		}
+		off := start + int64(i)
+		next := off + int64(h.size())
+		if next >= end {
+			// A single frame is only trusted right after the tag
+			if i == 0 {
+				return off, h, true
+			}
+			continue
+		}
+		b, _ := readAt(r, next, 4)
+		if nh, ok := parseFrameHeader(b); ok && nh.sameStream(h) {
+			return off, h, true
+		}
+	}
+	return 0, frameHeader{}, false
+}
+
+func min64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// sideInfo returns a length of the side information following the header,
+// a Xing header follows it
+func (h frameHeader) sideInfo() int {
+	if h.version == 0 {
+		if h.mono {
+			return 17
+		}
+		return 32
+	}
+	if h.mono {
+		return 9
+	}
+	return 17
+}
+
+// readVBR reads frames and bytes counts from a Xing, Info or VBRI header of
+// the first frame
+func readVBR(frame []byte, h frameHeader) (frames int64, bytes int64, ok bool) {
+	if off := 4 + h.sideInfo(); len(frame) >= off+16 {
+		tag := string(frame[off : off+4])
+		if tag == "Xing" || tag == "Info" {
+			flags := binary.BigEndian.Uint32(frame[off+4:])
+			pos := off + 8
+			if flags&1 != 0 {
+				frames = int64(binary.BigEndian.Uint32(frame[pos:]))
+				pos += 4
+			}
+			if flags&2 != 0 && len(frame) >= pos+4 {
+				bytes = int64(binary.BigEndian.Uint32(frame[pos:]))
+			}
+			return frames, bytes, frames > 0
+		}
+	}
+	if off := 4 + 32; len(frame) >= off+18 && string(frame[off:off+4]) == "VBRI" {
+		bytes = int64(binary.BigEndian.Uint32(frame[off+10:]))
+		frames = int64(binary.BigEndian.Uint32(frame[off+14:]))
+		return frames, bytes, frames > 0
+	}
+	return 0, 0, false
+}
+
+// scanFrames counts frames between the offsets, frames of other streams and
+// junk between frames are skipped
+func scanFrames(r io.ReaderAt, start int64, end int64, first frameHeader) int64 {
+	br := bufio.NewReaderSize(io.NewSectionReader(r, start, end-start), 64*1024)
+	frames := int64(0)
+	for {
+		b, err := br.Peek(4)
+		if err != nil {
+			return frames
+		}
+		h, ok := parseFrameHeader(b)
+		if !ok || !h.sameStream(first) {
+			if _, err := br.Discard(1); err != nil {
+				return frames
+			}
+			continue
+		}
+		n, err := br.Discard(h.size())
+		if n < h.size() || err != nil {
+			// A truncated last frame is still decoded
+			return frames + 1
+		}
+		frames++
+	}
+}
+
+// readMP3 reads an MPEG audio stream after the ID3v2 tag
+func readMP3(r io.ReaderAt, start int64, size int64, info *Info) error {
+	end := size
+	if tail, err := readAt(r, size-128, 3); err == nil && string(tail) == "TAG" {
+		end -= 128
+	}
+	off, h, ok := findFrame(r, start, end)
+	if !ok {
+		return ErrFormat
+	}
+	info.Format = "mp3"
+	info.Codec = h.codec()
+	info.SampleRate = h.sampleRate
+	info.Channels = 2
+	if h.mono {
+		info.Channels = 1
+	}
+	audio := end - off
+	first, _ := readAt(r, off, int64(h.size()))
+	frames, bytes, ok := readVBR(first, h)
+	if ok {
+		if bytes > 0 {
+			audio = bytes
+		}
+	} else {
+		frames = scanFrames(r, off, end, h)
+	}
+	info.Duration = seconds(frames*int64(h.samples()), int64(h.sampleRate))
+	info.finish(audio)
+	return nil
+}
@@ -0,0 +1,156 @@
+package probe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// id3Frame returns an ID3v2.3 frame
+func id3Frame(id string, data ...[]byte) []byte {
+	body := bytes.Join(data, nil)
+	frame := append([]byte(id), 0, 0, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(frame[4:], uint32(len(body)))
+	return append(frame, body...)
+}
+
+// id3Tag returns an ID3v2.3 tag of the frames
+func id3Tag(frames ...[]byte) []byte {
+	body := bytes.Join(frames, nil)
+	n := len(body)
+	return append([]byte{'I', 'D', '3', 3, 0, 0, byte(n >> 21 & 0x7f), byte(n >> 14 & 0x7f), byte(n >> 7 & 0x7f), byte(n & 0x7f)}, body...)
+}
+
+// utf16Text returns UTF-16 text with a little endian BOM
+func utf16Text(s string) []byte {
+	b := []byte{0xff, 0xfe}
+	for _, r := range s {
+		b = append(b, byte(r), byte(r>>8))
+	}
+	return b
+}
+
+// mp3Frames returns CBR frames of 128 kbit/s at 44.1 kHz, the first one
+// holds the header if any
+func mp3Frames(n int, header []byte) []byte {
+	b := []byte{}
+	for i := 0; i < n; i++ {
+		frame := make([]byte, 417)
+		copy(frame, []byte{0xff, 0xfb, 0x90, 0x44})
+		if i == 0 {
+			copy(frame[4+32:], header)
+		}
+		b = append(b, frame...)
+	}
+	return b
+}
+
+func TestParseFrameHeader(t *testing.T) {
+	tests := []struct {
+		header  []byte
+		want    frameHeader
+		size    int
+		samples int
+	}{
+		{[]byte{0xff, 0xfb, 0x90, 0x44}, frameHeader{version: 0, layer: 3, bitrate: 128000, sampleRate: 44100}, 417, 1152},
+		{[]byte{0xff, 0xfb, 0x92, 0xc4}, frameHeader{version: 0, layer: 3, bitrate: 128000, sampleRate: 44100, padding: 1, mono: true}, 418, 1152},
+		{[]byte{0xff, 0xf3, 0x44, 0xc4}, frameHeader{version: 1, layer: 3, bitrate: 32000, sampleRate: 24000, mono: true}, 96, 576},
+		{[]byte{0xff, 0xfd, 0x84, 0x04}, frameHeader{version: 0, layer: 2, bitrate: 128000, sampleRate: 48000}, 384, 1152},
+	}
+	for _, tt := range tests {
+		h, ok := parseFrameHeader(tt.header)
+		if !ok || h != tt.want || h.size() != tt.size || h.samples() != tt.samples {
+			t.Errorf("parseFrameHeader(% x) = %+v, %v, size %d", tt.header, h, ok, h.size())
+		}
+	}
+	for _, header := range [][]byte{{0xff, 0xfb, 0xf0, 0x44}, {0xff, 0xfb, 0x0c, 0x44}, {0xff, 0xe9, 0x90, 0x44}, {0xfe, 0xfb, 0x90, 0x44}} {
+		if h, ok := parseFrameHeader(header); ok {
+			t.Errorf("parseFrameHeader(% x) = %+v", header, h)
+		}
+	}
+}
+
+func TestReadMP3(t *testing.T) {
+	cover := []byte{0xff, 0xd8, 0xff, 0xe0}
+	tag := id3Tag(
+		id3Frame("TIT2", []byte{0}, []byte("Title, with a comma")),
+		id3Frame("TPE1", []byte{1}, utf16Text("Лев Толстой")),
+		id3Frame("TXXX", []byte{3}, []byte("SERIES\x00War")),
+		id3Frame("TRCK", []byte{0}, []byte("2/5")),
+		id3Frame("COMM", []byte{0}, []byte("eng"), []byte("\x00Note")),
+		id3Frame("APIC", []byte{0}, []byte("image/jpeg\x00"), []byte{3}, []byte("\x00"), cover),
+		id3Frame("CHAP", []byte("ch0\x00"), []byte{0, 0, 0, 0, 0, 0, 0x03, 0xe8, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+			id3Frame("TIT2", []byte{3}, []byte("Intro"))),
+		id3Frame("CHAP", []byte("ch1\x00"), []byte{0, 0, 0x03, 0xe8, 0, 0, 0x0b, 0xb8, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}),
+	)
+	file := append(tag, mp3Frames(100, nil)...)
+	info, err := Read(bytes.NewReader(file), int64(len(file)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Info{
+		Format:     "mp3",
+		Codec:      "mp3",
+		Duration:   2612244897,
+		Bitrate:    127706,
+		SampleRate: 44100,
+		Channels:   2,
+		Tags: map[string]string{
+			"title":   "Title, with a comma",
+			"artist":  "Лев Толстой",
+			"series":  "War",
+			"track":   "2/5",
+			"comment": "Note",
+		},
+		Chapters: []Chapter{
+			{Title: "Intro", Start: 0, End: time.Second},
+			{Title: "ch1", Start: time.Second, End: 3 * time.Second},
+		},
+		Cover: &Picture{MIMEType: "image/jpeg", Data: cover},
+	}
+	if !reflect.DeepEqual(info, want) {
+		t.Errorf("Read() = %+v\nwant %+v", info, want)
+	}
+}
+
+func TestReadMP3VBR(t *testing.T) {
+	xing := []byte("Xing\x00\x00\x00\x03\x00\x00\x03\xe8\x00\x01\x00\x00")
+	vbri := []byte("VBRI\x00\x01\x00\x00\x00\x00\x00\x01\x00\x00\x00\x00\x07\xd0")
+	id3v1 := make([]byte, 128)
+	copy(id3v1, "TAG")
+	copy(id3v1[3:], "Old title")
+	id3v1[126] = 7
+	tests := []struct {
+		name     string
+		file     []byte
+		duration time.Duration
+		tags     map[string]string
+	}{
+		{"xing", mp3Frames(3, xing), 26122448979, nil},
+		{"vbri", mp3Frames(3, vbri), 52244897959, nil},
+		{"id3v1", append(mp3Frames(10, nil), id3v1...), 261224489, map[string]string{"title": "Old title", "track": "7"}},
+		{"junk before frames", append([]byte{0xff, 0xfb, 0, 1, 2, 3}, mp3Frames(10, nil)...), 261224489, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := Read(bytes.NewReader(tt.file), int64(len(tt.file)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Duration != tt.duration || !reflect.DeepEqual(info.Tags, tt.tags) {
+				t.Errorf("Read() = %v, %v", info.Duration, info.Tags)
+			}
+		})
+	}
+}
+
+func TestReadUnknown(t *testing.T) {
+	for _, file := range [][]byte{nil, []byte("01.mp3"), bytes.Repeat([]byte{0xff, 0xfb, 0x90, 0x44, 1}, 1000), []byte("OggS")} {
+		if info, err := Read(bytes.NewReader(file), int64(len(file))); !errors.Is(err, ErrFormat) {
+			t.Errorf("Read(%q) = %+v, %v", file, info, err)
+		}
+	}
+}
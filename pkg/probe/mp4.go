@@ -0,0 +1,460 @@
+package probe
+
+import (
+	"encoding/binary"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// mp4Names maps iTunes metadata items to tag names
+var mp4Names = map[string]string{
+	"\xa9nam": "title",
+	"\xa9ART": "artist",
+	"aART":    "album_artist",
+	"\xa9alb": "album",
+	"\xa9cmt": "comment",
+	"\xa9day": "date",
+	"\xa9gen": "genre",
+	"\xa9grp": "grouping",
+	"\xa9lyr": "lyrics",
+	"\xa9mvi": "movement",
+	"\xa9mvn": "movementname",
+	"\xa9pub": "publisher",
+	"\xa9too": "encoder",
+	"\xa9wrt": "composer",
+	"cprt":    "copyright",
+	"desc":    "description",
+	"disk":    "disc",
+	"ldes":    "synopsis",
+	"soaa":    "sort_album_artist",
+	"soal":    "sort_album",
+	"soar":    "sort_artist",
+	"sonm":    "sort_name",
+	"trkn":    "track",
+	"tvsh":    "show",
+}
+
+// mp4Codecs maps sample entries to codec names
+var mp4Codecs = map[string]string{
+	"mp4a": "aac",
+	"alac": "alac",
+	"fLaC": "flac",
+	"Opus": "opus",
+	"ac-3": "ac3",
+	".mp3": "mp3",
+}
+
+// box is an MP4 box
+type box struct {
+	kind string
+	// data and size are an offset and a length of the box payload
+	data int64
+	size int64
+}
+
+// readBoxes reads boxes between the offsets
+func readBoxes(r io.ReaderAt, off int64, end int64) []box {
+	boxes := []box{}
+	for off+8 <= end {
+		h, err := readAt(r, off, 8)
+		if err != nil {
+			break
+		}
+		size, header := int64(binary.BigEndian.Uint32(h)), int64(8)
+		switch size {
+		case 0:
+			size = end - off
+		case 1:
+			ext, err := readAt(r, off+8, 8)
+			if err != nil {
+				return boxes
+			}
+			size, header = int64(binary.BigEndian.Uint64(ext)), 16
+		}
+		if size < header || off+size > end {
+			break
+		}
+		boxes = append(boxes, box{kind: string(h[4:8]), data: off + header, size: size - header})
+		off += size
+	}
+	return boxes
+}
+
+// findBox returns the first box of the kind
+func findBox(boxes []box, kind string) (box, bool) {
+	for _, b := range boxes {
+		if b.kind == kind {
+			return b, true
+		}
+	}
+	return box{}, false
+}
+
+func (b box) children(r io.ReaderAt) []box {
+	return readBoxes(r, b.data, b.data+b.size)
+}
+
+// path returns a box nested by kinds
+func (b box) path(r io.ReaderAt, kinds ...string) (box, bool) {
+	for _, kind := range kinds {
+		next, ok := findBox(b.children(r), kind)
+		if !ok {
+			return box{}, false
+		}
+		b = next
+	}
+	return b, true
+}
+
+func (b box) read(r io.ReaderAt) []byte {
+	data, _ := readAt(r, b.data, b.size)
+	return data
+}
+
+// readTimes reads a timescale and a duration of an mvhd or mdhd box
+func readTimes(b []byte) (int64, int64) {
+	if len(b) >= 32 && b[0] == 1 {
+		return int64(binary.BigEndian.Uint32(b[20:])), int64(binary.BigEndian.Uint64(b[24:]))
+	}
+	if len(b) >= 20 {
+		return int64(binary.BigEndian.Uint32(b[12:])), int64(binary.BigEndian.Uint32(b[16:]))
+	}
+	return 0, 0
+}
+
+// mp4Track is a track of an MP4 file
+type mp4Track struct {
+	id        uint32
+	handler   string
+	timescale int64
+	duration  int64
+	// chapters are ids of chapter tracks of the track
+	chapters []uint32
+	stbl     box
+}
+
+func readTrack(r io.ReaderAt, trak box) mp4Track {
+	t := mp4Track{}
+	kids := trak.children(r)
+	if tkhd, ok := findBox(kids, "tkhd"); ok {
+		b := tkhd.read(r)
+		if len(b) >= 24 && b[0] == 1 {
+			t.id = binary.BigEndian.Uint32(b[20:])
+		} else if len(b) >= 16 {
+			t.id = binary.BigEndian.Uint32(b[12:])
+		}
+	}
+	if chap, ok := trak.path(r, "tref", "chap"); ok {
+		b := chap.read(r)
+		for i := 0; i+4 <= len(b); i += 4 {
+			t.chapters = append(t.chapters, binary.BigEndian.Uint32(b[i:]))
+		}
+	}
+	if mdhd, ok := trak.path(r, "mdia", "mdhd"); ok {
+		t.timescale, t.duration = readTimes(mdhd.read(r))
+	}
+	if hdlr, ok := trak.path(r, "mdia", "hdlr"); ok {
+		if b := hdlr.read(r); len(b) >= 12 {
+			t.handler = string(b[8:12])
+		}
+	}
+	t.stbl, _ = trak.path(r, "mdia", "minf", "stbl")
+	return t
+}
+
+// readSampleEntry reads the codec, channels and sample rate of an audio track
+func readSampleEntry(r io.ReaderAt, t mp4Track, info *Info) {
+	stsd, ok := t.stbl.path(r, "stsd")
+	if !ok {
+		return
+	}
+	b := stsd.read(r)
+	// Version, flags, a number of entries and the first entry header
+	if len(b) < 8+8+28 {
+		return
+	}
+	kind := string(b[12:16])
+	info.Codec = mp4Codecs[kind]
+	if info.Codec == "" {
+		info.Codec = strings.TrimSpace(kind)
+	}
+	entry := b[16:]
+	info.Channels = int(binary.BigEndian.Uint16(entry[16:]))
+	info.SampleRate = int(binary.BigEndian.Uint32(entry[24:]) >> 16)
+}
+
+// sample is a location of a sample in the file
+type sample struct {
+	off  int64
+	size int64
+}
+
+func uint32s(b []byte, skip int) []uint32 {
+	values := []uint32{}
+	for i := skip; i+4 <= len(b); i += 4 {
+		values = append(values, binary.BigEndian.Uint32(b[i:]))
+	}
+	return values
+}
+
+// maxSamples limits samples of equal size read, chapter tracks have few
+const maxSamples = 1 << 16
+
+// readSamples returns locations and durations of samples of the track
+func readSamples(r io.ReaderAt, stbl box) ([]sample, []int64) {
+	kids := stbl.children(r)
+	chunks := []int64{}
+	if stco, ok := findBox(kids, "stco"); ok {
+		for _, off := range uint32s(stco.read(r), 8) {
+			chunks = append(chunks, int64(off))
+		}
+	} else if co64, ok := findBox(kids, "co64"); ok {
+		b := co64.read(r)
+		for i := 8; i+8 <= len(b); i += 8 {
+			chunks = append(chunks, int64(binary.BigEndian.Uint64(b[i:])))
+		}
+	}
+	sizes := []int64{}
+	if stsz, ok := findBox(kids, "stsz"); ok {
+		b := stsz.read(r)
+		if len(b) >= 12 {
+			size, count := binary.BigEndian.Uint32(b[4:]), binary.BigEndian.Uint32(b[8:])
+			if size != 0 {
+				for i := uint32(0); i < count && i < maxSamples; i++ {
+					sizes = append(sizes, int64(size))
+				}
+			} else {
+				for i, s := range uint32s(b, 12) {
+					if uint32(i) >= count {
+						break
+					}
+					sizes = append(sizes, int64(s))
+				}
+			}
+		}
+	}
+	// Runs of chunks with the same number of samples
+	runs := [][2]uint32{}
+	if stsc, ok := findBox(kids, "stsc"); ok {
+		values := uint32s(stsc.read(r), 8)
+		for i := 0; i+3 <= len(values); i += 3 {
+			runs = append(runs, [2]uint32{values[i], values[i+1]})
+		}
+	}
+	samples := []sample{}
+	for i, off := range chunks {
+		per := uint32(0)
+		for _, run := range runs {
+			if run[0] <= uint32(i+1) {
+				per = run[1]
+			}
+		}
+		for k := uint32(0); k < per && len(samples) < len(sizes); k++ {
+			size := sizes[len(samples)]
+			samples = append(samples, sample{off: off, size: size})
+			off += size
+		}
+	}
+	durations := []int64{}
+	if stts, ok := findBox(kids, "stts"); ok {
+		values := uint32s(stts.read(r), 8)
+		for i := 0; i+2 <= len(values) && len(durations) < len(samples); i += 2 {
+			for k := uint32(0); k < values[i] && len(durations) < len(samples); k++ {
+				durations = append(durations, int64(values[i+1]))
+			}
+		}
+	}
+	return samples, durations
+}
+
+// readChapterTrack reads titles of a QuickTime chapter track
+func readChapterTrack(r io.ReaderAt, t mp4Track, info *Info) {
+	samples, durations := readSamples(r, t.stbl)
+	end := int64(0)
+	for i, s := range samples {
+		if i >= len(durations) {
+			break
+		}
+		start := end
+		end += durations[i]
+		b, err := readAt(r, s.off, s.size)
+		if err != nil || len(b) < 2 {
+			continue
+		}
+		n := int(binary.BigEndian.Uint16(b))
+		if n > len(b)-2 {
+			n = len(b) - 2
+		}
+		title := b[2 : 2+n]
+		c := Chapter{
+			Title: string(title),
+			Start: seconds(start, t.timescale),
+			End:   seconds(end, t.timescale),
+		}
+		if len(title) >= 2 && title[0] == 0xfe && title[1] == 0xff {
+			units := make([]uint16, (len(title)-2)/2)
+			for k := range units {
+				units[k] = binary.BigEndian.Uint16(title[2+2*k:])
+			}
+			c.Title = string(utf16.Decode(units))
+		}
+		info.Chapters = append(info.Chapters, c)
+	}
+}
+
+// readChpl reads Nero chapters
+func readChpl(b []byte, info *Info) {
+	if len(b) < 5 {
+		return
+	}
+	pos := 4
+	if b[0] != 0 {
+		pos += 4
+	}
+	if len(b) <= pos {
+		return
+	}
+	count := int(b[pos])
+	pos++
+	for i := 0; i < count && pos+9 <= len(b); i++ {
+		start := int64(binary.BigEndian.Uint64(b[pos:]))
+		n := int(b[pos+8])
+		pos += 9
+		if pos+n > len(b) {
+			return
+		}
+		info.Chapters = append(info.Chapters, Chapter{
+			Title: string(b[pos : pos+n]),
+			Start: time.Duration(start * 100),
+		})
+		pos += n
+	}
+}
+
+// readIlst reads iTunes metadata items
+func readIlst(r io.ReaderAt, ilst box, info *Info) {
+	for _, item := range ilst.children(r) {
+		kids := item.children(r)
+		name := mp4Names[item.kind]
+		if item.kind == "----" {
+			if b, ok := findBox(kids, "name"); ok {
+				if data := b.read(r); len(data) > 4 {
+					name = strings.ToLower(string(data[4:]))
+				}
+			}
+		}
+		data, ok := findBox(kids, "data")
+		if !ok {
+			continue
+		}
+		b := data.read(r)
+		if len(b) < 8 {
+			continue
+		}
+		kind, value := binary.BigEndian.Uint32(b)&0xffffff, b[8:]
+		switch {
+		case item.kind == "covr":
+			mime := "image/jpeg"
+			if kind == 14 {
+				mime = "image/png"
+			}
+			info.setCover(Picture{MIMEType: mime, Data: value}, false)
+		case item.kind == "trkn" || item.kind == "disk":
+			if len(value) >= 6 {
+				n, total := binary.BigEndian.Uint16(value[2:]), binary.BigEndian.Uint16(value[4:])
+				s := strconv.Itoa(int(n))
+				if total > 0 {
+					s += "/" + strconv.Itoa(int(total))
+				}
+				info.setTag(name, s)
+			}
+		case kind == 1:
+			info.setTag(name, string(value))
+		case kind == 21 && len(value) > 0 && len(value) <= 8:
+			n := int64(0)
+			for _, c := range value {
+				n = n<<8 | int64(c)
+			}
+			info.setTag(name, strconv.FormatInt(n, 10))
+		}
+	}
+}
+
+// readMeta reads a meta box, QuickTime ones lack version and flags
+func readMeta(r io.ReaderAt, meta box, info *Info) {
+	if head, err := readAt(r, meta.data, 8); err == nil && string(head[4:8]) != "hdlr" {
+		meta.data, meta.size = meta.data+4, meta.size-4
+	}
+	if ilst, ok := findBox(meta.children(r), "ilst"); ok {
+		readIlst(r, ilst, info)
+	}
+}
+
+// readMP4 reads an MP4 file
+func readMP4(r io.ReaderAt, size int64, info *Info) error {
+	top := readBoxes(r, 0, size)
+	moov, ok := findBox(top, "moov")
+	if !ok {
+		return ErrFormat
+	}
+	info.Format = "mp4"
+	kids := moov.children(r)
+	if mvhd, ok := findBox(kids, "mvhd"); ok {
+		timescale, duration := readTimes(mvhd.read(r))
+		info.Duration = seconds(duration, timescale)
+	}
+	tracks := map[uint32]mp4Track{}
+	var audio *mp4Track
+	for _, b := range kids {
+		if b.kind != "trak" {
+			continue
+		}
+		t := readTrack(r, b)
+		tracks[t.id] = t
+		if t.handler == "soun" && audio == nil {
+			audio = &t
+		}
+	}
+	if audio == nil {
+		return ErrFormat
+	}
+	readSampleEntry(r, *audio, info)
+	if info.Duration == 0 {
+		info.Duration = seconds(audio.duration, audio.timescale)
+	}
+
+	for _, meta := range []string{"meta", "udta"} {
+		b, ok := findBox(kids, meta)
+		if !ok {
+			continue
+		}
+		if meta == "udta" {
+			if chpl, ok := b.path(r, "chpl"); ok {
+				readChpl(chpl.read(r), info)
+			}
+			if b, ok = b.path(r, "meta"); !ok {
+				continue
+			}
+		}
+		readMeta(r, b, info)
+	}
+	if len(info.Chapters) == 0 {
+		for _, id := range audio.chapters {
+			if t, ok := tracks[id]; ok {
+				readChapterTrack(r, t, info)
+			}
+		}
+	}
+
+	mdat := int64(0)
+	for _, b := range top {
+		if b.kind == "mdat" {
+			mdat += b.size
+		}
+	}
+	info.finish(mdat)
+	return nil
+}
@@ -0,0 +1,132 @@
+package probe
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// mp4Box returns a box of the payload
+func mp4Box(kind string, payload ...[]byte) []byte {
+	body := bytes.Join(payload, nil)
+	return append(appendBE32(nil, uint32(8+len(body))), append([]byte(kind), body...)...)
+}
+
+// fullBox returns a payload of a full box with zero flags
+func fullBox(version byte, payload ...[]byte) []byte {
+	return append([]byte{version, 0, 0, 0}, bytes.Join(payload, nil)...)
+}
+
+// be32s returns big endian numbers
+func be32s(values ...uint32) []byte {
+	b := []byte{}
+	for _, v := range values {
+		b = appendBE32(b, v)
+	}
+	return b
+}
+
+// mp4TrackBox returns a track of the handler type
+func mp4TrackBox(id uint32, handler string, timescale uint32, duration uint32, stbl []byte, tref []byte) []byte {
+	return mp4Box("trak",
+		mp4Box("tkhd", fullBox(0, be32s(0, 0, id, 0, duration))),
+		tref,
+		mp4Box("mdia",
+			mp4Box("mdhd", fullBox(0, be32s(0, 0, timescale, duration))),
+			mp4Box("hdlr", fullBox(0, be32s(0), []byte(handler), make([]byte, 12))),
+			mp4Box("minf", mp4Box("stbl", stbl)),
+		),
+	)
+}
+
+// testMP4 returns an audiobook with a chapter track and udta boxes
+func testMP4(udta ...[]byte) []byte {
+	ftyp := mp4Box("ftyp", []byte("M4B \x00\x00\x02\x00isomiso2"))
+	samples := [][]byte{[]byte("\x00\x05Intro"), []byte("\x00\x08\xfe\xff\x00T\x00w\x00o")}
+	mdat := mp4Box("mdat", samples[0], samples[1], make([]byte, 1000))
+	chunk := uint32(len(ftyp) + 8)
+
+	mp4a := mp4Box("mp4a", make([]byte, 6), []byte{0, 1}, make([]byte, 8), []byte{0, 2, 0, 16}, make([]byte, 4), be32s(44100<<16))
+	audio := mp4TrackBox(1, "soun", 44100, 441000,
+		mp4Box("stsd", fullBox(0, be32s(1), mp4a)),
+		mp4Box("tref", mp4Box("chap", be32s(2))),
+	)
+	text := mp4TrackBox(2, "text", 1000, 10000, bytes.Join([][]byte{
+		mp4Box("stsd", fullBox(0, be32s(0))),
+		mp4Box("stts", fullBox(0, be32s(2, 1, 4000, 1, 6000))),
+		mp4Box("stsc", fullBox(0, be32s(1, 1, 2, 1))),
+		mp4Box("stsz", fullBox(0, be32s(0, 2, uint32(len(samples[0])), uint32(len(samples[1]))))),
+		mp4Box("stco", fullBox(0, be32s(1, chunk))),
+	}, nil), nil)
+
+	moov := mp4Box("moov",
+		mp4Box("mvhd", fullBox(0, be32s(0, 0, 1000, 10000))),
+		audio,
+		text,
+		mp4Box("udta", udta...),
+	)
+	return bytes.Join([][]byte{ftyp, mdat, moov}, nil)
+}
+
+func TestReadMP4(t *testing.T) {
+	data := func(kind uint32, value []byte) []byte {
+		return mp4Box("data", be32s(kind, 0), value)
+	}
+	cover := []byte{0xff, 0xd8, 0xff, 0xe0}
+	meta := mp4Box("meta", fullBox(0,
+		mp4Box("hdlr", fullBox(0, be32s(0), []byte("mdir"), make([]byte, 12))),
+		mp4Box("ilst",
+			mp4Box("\xa9nam", data(1, []byte("Book"))),
+			mp4Box("\xa9ART", data(1, []byte("Author"))),
+			mp4Box("trkn", data(0, []byte{0, 0, 0, 2, 0, 5, 0, 0})),
+			mp4Box("\xa9mvi", data(21, []byte{0, 3})),
+			mp4Box("covr", data(13, cover)),
+			mp4Box("----",
+				mp4Box("mean", fullBox(0, []byte("com.apple.iTunes"))),
+				mp4Box("name", fullBox(0, []byte("SERIES"))),
+				data(1, []byte("War")),
+			),
+			mp4Box("xid ", data(1, []byte("unknown"))),
+		),
+	))
+	chpl := mp4Box("chpl", fullBox(1, be32s(0), []byte{2}, be32s(0, 0), []byte("\x01A"), be32s(0, 50000000), []byte("\x01B")))
+
+	tags := map[string]string{"title": "Book", "artist": "Author", "track": "2/5", "movement": "3", "series": "War"}
+	tests := []struct {
+		name     string
+		file     []byte
+		chapters []Chapter
+	}{
+		{"chapter track", testMP4(meta), []Chapter{
+			{Title: "Intro", Start: 0, End: 4 * time.Second},
+			{Title: "Two", Start: 4 * time.Second, End: 10 * time.Second},
+		}},
+		{"nero chapters", testMP4(meta, chpl), []Chapter{
+			{Title: "A", Start: 0, End: 5 * time.Second},
+			{Title: "B", Start: 5 * time.Second, End: 10 * time.Second},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := Read(bytes.NewReader(tt.file), int64(len(tt.file)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := Info{
+				Format:     "mp4",
+				Codec:      "aac",
+				Duration:   10 * time.Second,
+				Bitrate:    (7 + 10 + 1000) * 8 / 10,
+				SampleRate: 44100,
+				Channels:   2,
+				Tags:       tags,
+				Chapters:   tt.chapters,
+				Cover:      &Picture{MIMEType: "image/jpeg", Data: cover},
+			}
+			if !reflect.DeepEqual(info, want) {
+				t.Errorf("Read() = %+v\nwant %+v", info, want)
+			}
+		})
+	}
+}
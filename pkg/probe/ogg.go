@@ -0,0 +1,143 @@
+package probe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+)
+
+// oggPage is a page of an Ogg stream
+type oggPage struct {
+	granule  int64
+	serial   uint32
+	segments []byte
+	// data is an offset of the page body
+	data int64
+}
+
+// length returns a length of the page body
+func (p oggPage) length() int64 {
+	n := int64(0)
+	for _, s := range p.segments {
+		n += int64(s)
+	}
+	return n
+}
+
+// readOggPage reads a page header at the offset
+func readOggPage(r io.ReaderAt, off int64) (oggPage, error) {
+	h, err := readAt(r, off, 27)
+	if err != nil {
+		return oggPage{}, err
+	}
+	if string(h[:4]) != "OggS" {
+		return oggPage{}, ErrFormat
+	}
+	p := oggPage{
+		granule: int64(binary.LittleEndian.Uint64(h[6:])),
+		serial:  binary.LittleEndian.Uint32(h[14:]),
+	}
+	p.segments, err = readAt(r, off+27, int64(h[26]))
+	p.data = off + 27 + int64(h[26])
+	return p, err
+}
+
+// readOggPackets returns the first packets of the stream starting at the
+// offset, packets of other streams are skipped
+func readOggPackets(r io.ReaderAt, off int64, count int) ([][]byte, uint32, error) {
+	packets := [][]byte{}
+	var packet []byte
+	var serial uint32
+	for first := true; len(packets) < count; first = false {
+		p, err := readOggPage(r, off)
+		if err != nil {
+			return packets, serial, err
+		}
+		off = p.data + p.length()
+		if first {
+			serial = p.serial
+		}
+		if p.serial != serial {
+			continue
+		}
+		body, err := readAt(r, p.data, p.length())
+		if err != nil {
+			return packets, serial, err
+		}
+		for _, s := range p.segments {
+			packet = append(packet, body[:s]...)
+			body = body[s:]
+			// A segment shorter than 255 bytes ends a packet
+			if s < 255 {
+				packets = append(packets, packet)
+				packet = nil
+			}
+		}
+	}
+	return packets[:count], serial, nil
+}
+
+// lastGranule returns the granule position of the last page of the stream
+func lastGranule(r io.ReaderAt, size int64, serial uint32) int64 {
+	for chunk := int64(64 * 1024); ; chunk *= 4 {
+		start := size - chunk
+		if start < 0 {
+			start = 0
+		}
+		b, _ := readAt(r, start, size-start)
+		for i := bytes.LastIndex(b, []byte("OggS")); i >= 0; i = bytes.LastIndex(b[:i], []byte("OggS")) {
+			p, err := readOggPage(r, start+int64(i))
+			if err == nil && p.serial == serial && p.granule >= 0 {
+				return p.granule
+			}
+		}
+		if start == 0 {
+			return 0
+		}
+	}
+}
+
+// readOgg reads an Ogg Vorbis, Opus or FLAC stream
+func readOgg(r io.ReaderAt, off int64, size int64, info *Info) error {
+	packets, serial, err := readOggPackets(r, off, 2)
+	if err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return ErrFormat
+		}
+		return err
+	}
+	id, comment := packets[0], packets[1]
+	info.Format = "ogg"
+	granule := lastGranule(r, size, serial)
+	switch {
+	case len(id) >= 30 && string(id[:7]) == "\x01vorbis":
+		info.Codec = "vorbis"
+		info.Channels = int(id[11])
+		info.SampleRate = int(binary.LittleEndian.Uint32(id[12:]))
+		info.Duration = seconds(granule, int64(info.SampleRate))
+		if len(comment) > 7 && string(comment[:7]) == "\x03vorbis" {
+			readVorbisComment(comment[7:], info)
+		}
+	case len(id) >= 19 && string(id[:8]) == "OpusHead":
+		info.Codec = "opus"
+		info.Channels = int(id[9])
+		// Opus is always decoded at 48 kHz
+		info.SampleRate = 48000
+		preSkip := int64(binary.LittleEndian.Uint16(id[10:]))
+		info.Duration = seconds(granule-preSkip, 48000)
+		if len(comment) > 8 && string(comment[:8]) == "OpusTags" {
+			readVorbisComment(comment[8:], info)
+		}
+	case len(id) >= 17+34 && string(id[:5]) == "\x7fFLAC":
+		info.Codec = "flac"
+		readStreamInfo(id[17:], info)
+		info.Duration = seconds(granule, int64(info.SampleRate))
+		if len(comment) > 4 && comment[0]&0x7f == flacVorbisComment {
+			readVorbisComment(comment[4:], info)
+		}
+	default:
+		return ErrFormat
+	}
+	info.finish(size - off)
+	return nil
+}
@@ -0,0 +1,87 @@
+package probe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// oggPageOf returns a page of the segments
+func oggPageOf(serial uint32, granule int64, segments []byte, body []byte) []byte {
+	h := make([]byte, 27)
+	copy(h, "OggS")
+	binary.LittleEndian.PutUint64(h[6:], uint64(granule))
+	binary.LittleEndian.PutUint32(h[14:], serial)
+	h[26] = byte(len(segments))
+	return append(append(h, segments...), body...)
+}
+
+// oggPackets returns a page of complete packets
+func oggPackets(serial uint32, granule int64, packets ...[]byte) []byte {
+	segments, body := []byte{}, []byte{}
+	for _, p := range packets {
+		n := len(p)
+		for ; n >= 255; n -= 255 {
+			segments = append(segments, 255)
+		}
+		segments = append(segments, byte(n))
+		body = append(body, p...)
+	}
+	return oggPageOf(serial, granule, segments, body)
+}
+
+func vorbisID(channels byte, rate uint32) []byte {
+	b := append([]byte("\x01vorbis"), 0, 0, 0, 0, channels)
+	b = appendLE32(b, rate)
+	return append(b, make([]byte, 14)...)
+}
+
+func TestReadOgg(t *testing.T) {
+	// The comment packet spans two pages
+	comment := append([]byte("\x03vorbis"), vorbisComment("TITLE=Book", "ARTIST=Author", "DESCRIPTION="+string(bytes.Repeat([]byte("x"), 500)))...)
+	vorbis := bytes.Join([][]byte{
+		oggPackets(7, 0, vorbisID(2, 44100)),
+		oggPageOf(7, -1, []byte{255, 255}, comment[:510]),
+		oggPageOf(7, 0, []byte{byte(len(comment) - 510)}, comment[510:]),
+		oggPackets(9, 1<<40, make([]byte, 100)),
+		oggPackets(7, 441000, make([]byte, 100)),
+		oggPackets(9, 1<<41, make([]byte, 100)),
+	}, nil)
+
+	opusHead := append([]byte("OpusHead"), 1, 1, 0x38, 0x01, 0x80, 0xbb, 0, 0, 0, 0, 0)
+	opus := bytes.Join([][]byte{
+		oggPackets(3, 0, opusHead),
+		oggPackets(3, 0, append([]byte("OpusTags"), vorbisComment("title=Opus book")...)),
+		oggPackets(3, 240312, make([]byte, 200)),
+	}, nil)
+
+	tests := []struct {
+		name string
+		file []byte
+		want Info
+	}{
+		{"vorbis", vorbis, Info{
+			Format: "ogg", Codec: "vorbis", Duration: 10 * time.Second,
+			Bitrate: int(len(vorbis) * 8 / 10), SampleRate: 44100, Channels: 2,
+			Tags: map[string]string{"title": "Book", "artist": "Author", "description": string(bytes.Repeat([]byte("x"), 500))},
+		}},
+		{"opus", opus, Info{
+			Format: "ogg", Codec: "opus", Duration: 5 * time.Second,
+			Bitrate: int(len(opus) * 8 / 5), SampleRate: 48000, Channels: 1,
+			Tags: map[string]string{"title": "Opus book"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := Read(bytes.NewReader(tt.file), int64(len(tt.file)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(info, tt.want) {
+				t.Errorf("Read() = %+v\nwant %+v", info, tt.want)
+			}
+		})
+	}
+}
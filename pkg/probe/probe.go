@@ -0,0 +1,151 @@
+// Package probe reads durations, tags, chapters and cover art of MP3, FLAC,
+// Ogg and MP4 files without running ffprobe
+package probe
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrFormat is returned for files the package can not read
+var ErrFormat = errors.New("unknown audio format")
+
+// Chapter is a named part of an audio file
+type Chapter struct {
+	Title string
+	Start time.Duration
+	End   time.Duration
+}
+
+// Picture is cover art embedded into an audio file
+type Picture struct {
+	MIMEType string
+	Data     []byte
+}
+
+// Info describes an audio file
+type Info struct {
+	// Format is a container: mp3, flac, ogg or mp4
+	Format string
+	// Codec is a name of the audio codec as ffprobe names it
+	Codec    string
+	Duration time.Duration
+	// Bitrate is an average in bits per second
+	Bitrate    int
+	SampleRate int
+	Channels   int
+	// Tags are named as ffprobe names format tags, in lower case
+	Tags     map[string]string
+	Chapters []Chapter
+	Cover    *Picture
+}
+
+// setTag sets the tag unless it is empty, repeated tags are joined by ";"
+func (info *Info) setTag(name string, value string) {
+	value = strings.TrimRight(value, "\x00")
+	if name == "" || value == "" {
+		return
+	}
+	if info.Tags == nil {
+		info.Tags = map[string]string{}
+	}
+	if old, ok := info.Tags[name]; ok && old != value {
+		value = old + ";" + value
+	}
+	info.Tags[name] = value
+}
+
+// setCover keeps the front cover or the first picture
+func (info *Info) setCover(p Picture, front bool) {
+	if info.Cover == nil || front {
+		info.Cover = &p
+	}
+}
+
+// finish sorts chapters and ends each one where the next starts
+func (info *Info) finish(audio int64) {
+	sort.SliceStable(info.Chapters, func(i, j int) bool {
+		return info.Chapters[i].Start < info.Chapters[j].Start
+	})
+	for i := range info.Chapters {
+		c := &info.Chapters[i]
+		if c.End > c.Start {
+			continue
+		}
+		c.End = info.Duration
+		if i+1 < len(info.Chapters) {
+			c.End = info.Chapters[i+1].Start
+		}
+	}
+	if info.Bitrate == 0 && info.Duration > 0 && audio > 0 {
+		info.Bitrate = int(float64(audio*8) / info.Duration.Seconds())
+	}
+}
+
+// seconds converts a number of samples of the rate into a duration
+func seconds(samples int64, rate int64) time.Duration {
+	if rate <= 0 {
+		return 0
+	}
+	return time.Duration(float64(samples) / float64(rate) * float64(time.Second))
+}
+
+// readAt reads n bytes at the offset
+func readAt(r io.ReaderAt, off int64, n int64) ([]byte, error) {
+	if n < 0 || off < 0 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	b := make([]byte, n)
+	read, err := r.ReadAt(b, off)
+	if int64(read) == n {
+		return b, nil
+	}
+	if err == nil || err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return b[:read], err
+}
+
+// Read probes an audio file of the size
+func Read(r io.ReaderAt, size int64) (Info, error) {
+	info := Info{}
+	start, err := readID3v2(r, size, &info)
+	if err != nil {
+		return info, err
+	}
+	head, _ := readAt(r, start, 12)
+	switch {
+	case len(head) >= 4 && string(head[:4]) == "fLaC":
+		err = readFLAC(r, start, size, &info)
+	case len(head) >= 4 && string(head[:4]) == "OggS":
+		err = readOgg(r, start, size, &info)
+	case len(head) >= 8 && string(head[4:8]) == "ftyp":
+		err = readMP4(r, size, &info)
+	default:
+		err = readMP3(r, start, size, &info)
+	}
+	return info, err
+}
+
+// File probes the audio file
+func File(name string) (Info, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return Info{}, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return Info{}, err
+	}
+	info, err := Read(f, fi.Size())
+	if err != nil {
+		return info, fmt.Errorf("%s: %w", name, err)
+	}
+	return info, nil
+}
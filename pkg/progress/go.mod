@@ -0,0 +1,3 @@
+module histrio/rssbook/pkg/progress
+
+go 1.17
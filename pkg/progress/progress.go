@@ -0,0 +1,224 @@
+package progress
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Stages of a conversion in order they run
+const (
+	Probe    = "probe"    // source files probed for duration
+	Loudness = "loudness" // loudness of source files measured
+	Silences = "silences" // silences detected in source files
+	Merge    = "merge"    // episodes cut and merged
+	Encode   = "encode"   // episodes encoded
+	Write    = "write"    // episodes written to the book
+	Finished = "finished" // the conversion is over
+)
+
+// Stages are counted towards the overall progress
+var Stages = []string{Probe, Loudness, Silences, Merge, Encode, Write}
+
+// Event tells a stage has processed one more item. Durations are in seconds.
+type Event struct {
+	Time    time.Time `json:"time"`
+	Stage   string    `json:"stage"`
+	Item    string    `json:"item,omitempty"`
+	Done    int       `json:"done"`
+	Total   int       `json:"total"`
+	Bytes   int64     `json:"bytes,omitempty"`
+	Percent float64   `json:"percent"`
+	Elapsed float64   `json:"elapsed"`
+	ETA     float64   `json:"eta,omitempty"`
+}
+
+// Reporter shows progress events
+type Reporter interface {
+	Report(e Event)
+}
+
+// Tracker counts items done by stages and reports each step with overall
+// progress and estimated time left. A nil tracker does nothing.
+type Tracker struct {
+	Reporter Reporter
+
+	now    func() time.Time
+	mu     sync.Mutex
+	start  time.Time
+	done   map[string]int
+	totals map[string]int
+	bytes  int64
+}
+
+// NewTracker starts tracking a conversion
+func NewTracker(r Reporter) *Tracker {
+	return newTracker(r, time.Now)
+}
+
+func newTracker(r Reporter, now func() time.Time) *Tracker {
+	return &Tracker{
+		Reporter: r,
+		now:      now,
+		start:    now(),
+		done:     map[string]int{},
+		totals:   map[string]int{},
+	}
+}
+
+// SetTotal sets how many items the stage is expected to process
+func (t *Tracker) SetTotal(stage string, total int) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.totals[stage] = total
+}
+
+// Step reports an item processed by the stage, bytes are added to bytes
+// written
+func (t *Tracker) Step(stage string, item string, bytes int64) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.done[stage]++
+	// Estimates may fall short
+	if t.done[stage] > t.totals[stage] {
+		t.totals[stage] = t.done[stage]
+	}
+	t.bytes += bytes
+	t.report(stage, item)
+}
+
+// Finish reports the conversion is over
+func (t *Tracker) Finish() {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.report(Finished, "")
+}
+
+// fraction returns the overall progress, stages weigh the same. Stages
+// without a total, e.g. loudness without normalization, are left out.
+func (t *Tracker) fraction() float64 {
+	sum, stages := 0.0, 0
+	for _, stage := range Stages {
+		if t.totals[stage] > 0 {
+			sum += float64(t.done[stage]) / float64(t.totals[stage])
+			stages++
+		}
+	}
+	if stages == 0 {
+		return 0
+	}
+	return sum / float64(stages)
+}
+
+func (t *Tracker) report(stage string, item string) {
+	now := t.now()
+	elapsed := now.Sub(t.start)
+	f := 1.0
+	if stage != Finished {
+		f = t.fraction()
+	}
+	e := Event{
+		Time:    now,
+		Stage:   stage,
+		Item:    item,
+		Done:    t.done[stage],
+		Total:   t.totals[stage],
+		Bytes:   t.bytes,
+		Percent: float64(int(f*1000)) / 10,
+		Elapsed: elapsed.Seconds(),
+	}
+	if f > 0 && f < 1 {
+		e.ETA = math.Round(elapsed.Seconds() * (1 - f) / f)
+	}
+	if stage == Finished {
+		e.Done, e.Total = t.done[Write], t.totals[Write]
+	}
+	if t.Reporter != nil {
+		t.Reporter.Report(e)
+	}
+}
+
+type jsonReporter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// JSON writes events as newline delimited JSON
+func JSON(w io.Writer) Reporter {
+	return &jsonReporter{enc: json.NewEncoder(w)}
+}
+
+func (r *jsonReporter) Report(e Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.enc.Encode(e)
+}
+
+// barWidth is a number of cells in the progress bar
+const barWidth = 30
+
+type barReporter struct {
+	mu   sync.Mutex
+	w    io.Writer
+	line string
+}
+
+// Bar draws a progress bar with estimated time left on a terminal line. The
+// bar is also an io.Writer, lines written to it are kept above the bar.
+func Bar(w io.Writer) Reporter {
+	return &barReporter{w: w}
+}
+
+// FormatBar renders the event as a progress bar line
+func FormatBar(e Event) string {
+	filled := int(e.Percent / 100 * barWidth)
+	bar := strings.Repeat("#", filled) + strings.Repeat(".", barWidth-filled)
+	line := fmt.Sprintf("[%s] %5.1f%% %s %d/%d", bar, e.Percent, e.Stage, e.Done, e.Total)
+	if e.Bytes > 0 {
+		line += fmt.Sprintf(" %.1f MB", float64(e.Bytes)/(1<<20))
+	}
+	if e.Stage == Finished {
+		return line + fmt.Sprintf(" in %s", time.Duration(e.Elapsed)*time.Second)
+	}
+	if e.ETA > 0 {
+		line += fmt.Sprintf(" ETA %s", time.Duration(e.ETA)*time.Second)
+	}
+	return line
+}
+
+func (r *barReporter) Report(e Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.line = FormatBar(e)
+	// Clear the rest of a longer previous line
+	fmt.Fprintf(r.w, "\r%s\x1b[K", r.line)
+	if e.Stage == Finished {
+		fmt.Fprintln(r.w)
+		r.line = ""
+	}
+}
+
+func (r *barReporter) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.line == "" {
+		return r.w.Write(p)
+	}
+	fmt.Fprint(r.w, "\r\x1b[K")
+	n, err := r.w.Write(p)
+	fmt.Fprint(r.w, r.line)
+	return n, err
+}
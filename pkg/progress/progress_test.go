@@ -0,0 +1,111 @@
+package progress
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+type recorder struct {
+	events []Event
+}
+
+func (r *recorder) Report(e Event) {
+	r.events = append(r.events, e)
+}
+
+func TestTracker(t *testing.T) {
+	now := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	r := &recorder{}
+	tracker := newTracker(r, func() time.Time { return now })
+	tracker.SetTotal(Probe, 2)
+	tracker.SetTotal(Silences, 2)
+	tracker.SetTotal(Merge, 1)
+	tracker.SetTotal(Encode, 1)
+	tracker.SetTotal(Write, 1)
+
+	now = now.Add(10 * time.Second)
+	tracker.Step(Probe, "a.mp3", 0)
+	now = now.Add(10 * time.Second)
+	tracker.Step(Probe, "b.mp3", 0)
+	e := r.events[1]
+	if e.Done != 2 || e.Total != 2 || e.Percent != 20 || e.Elapsed != 20 || e.ETA != 80 {
+		t.Errorf("event = %+v", e)
+	}
+
+	// More episodes than estimated
+	tracker.Step(Write, "episode-001.mp3", 1000)
+	tracker.Step(Write, "episode-002.mp3", 500)
+	e = r.events[3]
+	if e.Done != 2 || e.Total != 2 || e.Bytes != 1500 {
+		t.Errorf("event = %+v", e)
+	}
+
+	tracker.Finish()
+	e = r.events[4]
+	if e.Stage != Finished || e.Percent != 100 || e.ETA != 0 {
+		t.Errorf("event = %+v", e)
+	}
+
+	var none *Tracker
+	none.SetTotal(Probe, 1)
+	none.Step(Probe, "a.mp3", 0)
+	none.Finish()
+}
+
+func TestJSON(t *testing.T) {
+	var out bytes.Buffer
+	tracker := NewTracker(JSON(&out))
+	tracker.SetTotal(Encode, 2)
+	tracker.Step(Encode, "episode", 0)
+	tracker.Finish()
+
+	scanner := bufio.NewScanner(&out)
+	stages := []string{}
+	for scanner.Scan() {
+		var e Event
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatalf("%q: %v", scanner.Text(), err)
+		}
+		stages = append(stages, e.Stage)
+	}
+	if strings.Join(stages, ",") != "encode,finished" {
+		t.Errorf("stages = %v", stages)
+	}
+}
+
+func TestFormatBar(t *testing.T) {
+	for _, tt := range []struct {
+		event Event
+		want  string
+	}{
+		{
+			Event{Stage: Encode, Done: 3, Total: 12, Percent: 50, ETA: 90},
+			"[###############...............]  50.0% encode 3/12 ETA 1m30s",
+		},
+		{
+			Event{Stage: Finished, Done: 12, Total: 12, Bytes: 3 << 20, Percent: 100, Elapsed: 125},
+			"[##############################] 100.0% finished 12/12 3.0 MB in 2m5s",
+		},
+	} {
+		if got := FormatBar(tt.event); got != tt.want {
+			t.Errorf("FormatBar() = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestBarKeepsLines(t *testing.T) {
+	var out bytes.Buffer
+	bar := Bar(&out)
+	bar.Report(Event{Stage: Encode, Done: 1, Total: 2, Percent: 50})
+	out.Reset()
+	bar.(io.Writer).Write([]byte("INFO: Issued\n"))
+	want := "\r\x1b[KINFO: Issued\n" + FormatBar(Event{Stage: Encode, Done: 1, Total: 2, Percent: 50})
+	if out.String() != want {
+		t.Errorf("got %q, want %q", out.String(), want)
+	}
+}
@@ -0,0 +1,3 @@
+module histrio/rssbook/pkg/publish
+
+go 1.17
@@ -0,0 +1,121 @@
+package publish
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Publisher uploads files of built books to a storage. Keys are slash
+// separated paths relative to the storage root.
+type Publisher interface {
+	// Put uploads the local file under the key
+	Put(key string, file string, contentType string) error
+	// Delete removes the key, a missing key is not an error
+	Delete(key string) error
+}
+
+// Upload is a local file to put under the key
+type Upload struct {
+	Key         string
+	File        string
+	ContentType string
+}
+
+// Batcher is a publisher uploading many files at once cheaper than one by one
+type Batcher interface {
+	// PutAll uploads the files in order, stopping at the first failure
+	PutAll(uploads []Upload) error
+}
+
+// Lister is a publisher able to list remote files with their checksums
+type Lister interface {
+	// List returns MD5 checksums of files under the prefix by their keys.
+	// Checksums are empty if unknown.
+	List(prefix string) (map[string]string, error)
+}
+
+// Fetcher is a publisher able to download files
+type Fetcher interface {
+	// Get returns the content of the key or ErrNotFound
+	Get(key string) ([]byte, error)
+}
+
+// ErrNotFound is returned for missing remote files
+var ErrNotFound = errors.New("not found")
+
+// Open returns a publisher for the target URL:
+//
+//	/srv/books or file:///srv/books                   a local directory
+//	s3://bucket/prefix?endpoint=...&region=...        S3-compatible storage
+//	dav://host/path, davs://host/path                 WebDAV over HTTP(S)
+//	sftp://user@host:port/path?identity=...           SFTP by the sftp client
+//	sftp://user@host/~/path                           SFTP into the home directory
+//
+// S3 credentials are taken from AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and
+// AWS_SESSION_TOKEN. Public makes uploaded files readable by anyone where
+// the storage supports it.
+func Open(target string, public bool) (Publisher, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "", "file":
+		root := target
+		if u.Scheme == "file" {
+			root = u.Path
+		}
+		if root == "" {
+			return nil, fmt.Errorf("no directory in %q", target)
+		}
+		return &Local{Root: root}, nil
+	case "s3":
+		return openS3(u, public)
+	case "dav", "davs":
+		return openWebDAV(u)
+	case "sftp":
+		return openSFTP(u, public)
+	}
+	return nil, fmt.Errorf("unsupported publish target %q", target)
+}
+
+// BookFiles returns names of files in the built book directory to publish.
+// Feeds go last, so they never refer to episodes not uploaded yet.
+func BookFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	names := []string{}
+	for _, e := range entries {
+		if e.Type().IsRegular() && !strings.HasPrefix(e.Name(), ".") {
+			names = append(names, e.Name())
+		}
+	}
+	sort.SliceStable(names, func(i, j int) bool {
+		return filepath.Ext(names[i]) != ".xml" && filepath.Ext(names[j]) == ".xml"
+	})
+	return names, nil
+}
+
+// Checksum returns an MD5 of the file as S3 reports it in ETags
+func Checksum(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	hash := md5.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
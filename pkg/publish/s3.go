@@ -0,0 +1,353 @@
+package publish
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// emptyPayload is a SHA-256 of an empty request body
+const emptyPayload = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// S3 publishes into an S3-compatible object storage: AWS, MinIO, Ceph and
+// the like. Requests are signed with AWS Signature Version 4.
+type S3 struct {
+	// Endpoint is a URL of the storage, e.g. https://s3.eu-central-1.amazonaws.com
+	Endpoint string
+	Region   string
+	Bucket   string
+	// Prefix is prepended to all keys
+	Prefix string
+	// PathStyle addresses the bucket in the path instead of the host name,
+	// as MinIO expects by default
+	PathStyle    bool
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+	// Public grants everyone read access to uploaded objects
+	Public       bool
+	StorageClass string
+	Client       *http.Client
+
+	// now is a clock for signatures
+	now func() time.Time
+}
+
+func openS3(u *url.URL, public bool) (*S3, error) {
+	if u.Host == "" {
+		return nil, fmt.Errorf("no bucket in %q", u.String())
+	}
+	q := u.Query()
+	s := &S3{
+		Bucket:       u.Host,
+		Prefix:       strings.Trim(u.Path, "/"),
+		Region:       q.Get("region"),
+		Endpoint:     q.Get("endpoint"),
+		PathStyle:    q.Get("path-style") != "",
+		StorageClass: q.Get("storage-class"),
+		AccessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+		Public:       public,
+	}
+	if s.Region == "" {
+		s.Region = os.Getenv("AWS_REGION")
+	}
+	if s.Region == "" {
+		s.Region = "us-east-1"
+	}
+	if s.Endpoint == "" {
+		s.Endpoint = "https://s3." + s.Region + ".amazonaws.com"
+	}
+	if s.AccessKey == "" || s.SecretKey == "" {
+		return nil, fmt.Errorf("no S3 credentials, set AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+	return s, nil
+}
+
+func (s *S3) client() *http.Client {
+	if s.Client != nil {
+		return s.Client
+	}
+	return http.DefaultClient
+}
+
+// objectURL returns a URL of the key, or of the bucket if the key is empty
+func (s *S3) objectURL(key string) (*url.URL, error) {
+	u, err := url.Parse(strings.TrimSuffix(s.Endpoint, "/"))
+	if err != nil {
+		return nil, err
+	}
+	key = strings.Trim(path.Join(s.Prefix, key), "/")
+	if s.PathStyle {
+		u.Path += "/" + s.Bucket + "/" + key
+	} else {
+		u.Host = s.Bucket + "." + u.Host
+		u.Path += "/" + key
+	}
+	u.RawPath = uriEncode(u.Path, false)
+	return u, nil
+}
+
+// bucketURL returns a URL of the bucket for listing requests
+func (s *S3) bucketURL() (*url.URL, error) {
+	u, err := url.Parse(strings.TrimSuffix(s.Endpoint, "/"))
+	if err != nil {
+		return nil, err
+	}
+	if s.PathStyle {
+		u.Path += "/" + s.Bucket
+	} else {
+		u.Host = s.Bucket + "." + u.Host
+		u.Path += "/"
+	}
+	return u, nil
+}
+
+// uriEncode escapes everything but unreserved characters as SigV4 requires
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// sign adds the Authorization header to the request. All headers set on the
+// request and the host are signed.
+func (s *S3) sign(r *http.Request, payloadHash string, t time.Time) {
+	t = t.UTC()
+	amzDate := t.Format("20060102T150405Z")
+	day := t.Format("20060102")
+	r.Header.Set("X-Amz-Date", amzDate)
+	r.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if s.SessionToken != "" {
+		r.Header.Set("X-Amz-Security-Token", s.SessionToken)
+	}
+
+	headers := map[string]string{"host": r.URL.Host}
+	for name, values := range r.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := []string{}
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	query := r.URL.Query()
+	keys := []string{}
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	params := []string{}
+	for _, k := range keys {
+		for _, v := range query[k] {
+			params = append(params, uriEncode(k, true)+"="+uriEncode(v, true))
+		}
+	}
+
+	canonicalRequest := strings.Join([]string{
+		r.Method,
+		uriEncode(r.URL.Path, false),
+		strings.Join(params, "&"),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	scope := day + "/" + s.Region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.SecretKey), day)
+	key = hmacSHA256(key, s.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	r.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.AccessKey, scope, signedHeaders, signature,
+	))
+}
+
+func (s *S3) clock() time.Time {
+	if s.now != nil {
+		return s.now()
+	}
+	return time.Now()
+}
+
+// s3Error is an error response of the storage
+type s3Error struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+func (s *S3) do(r *http.Request, payloadHash string) (*http.Response, error) {
+	s.sign(r, payloadHash, s.clock())
+	resp, err := s.client().Do(r)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 == 2 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	var e s3Error
+	if xml.Unmarshal(body, &e) == nil && e.Code != "" {
+		return resp, fmt.Errorf("%s %s: %s: %s", r.Method, r.URL.Path, e.Code, e.Message)
+	}
+	return resp, fmt.Errorf("%s %s: %s", r.Method, r.URL.Path, resp.Status)
+}
+
+// Put uploads the file as an object
+func (s *S3) Put(key string, file string, contentType string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	u, err := s.objectURL(key)
+	if err != nil {
+		return err
+	}
+	r, err := http.NewRequest("PUT", u.String(), f)
+	if err != nil {
+		return err
+	}
+	r.ContentLength = fi.Size()
+	r.Header.Set("Content-Type", contentType)
+	if s.Public {
+		r.Header.Set("X-Amz-Acl", "public-read")
+	}
+	if s.StorageClass != "" {
+		r.Header.Set("X-Amz-Storage-Class", s.StorageClass)
+	}
+	resp, err := s.do(r, hex.EncodeToString(hash.Sum(nil)))
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// Delete removes the object
+func (s *S3) Delete(key string) error {
+	u, err := s.objectURL(key)
+	if err != nil {
+		return err
+	}
+	r, err := http.NewRequest("DELETE", u.String(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := s.do(r, emptyPayload)
+	if resp != nil && resp.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+type s3ListResult struct {
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+	Contents              []struct {
+		Key  string `xml:"Key"`
+		ETag string `xml:"ETag"`
+	} `xml:"Contents"`
+}
+
+// List returns ETags of objects under the prefix. ETags of multipart uploads
+// are not checksums and are returned empty.
+func (s *S3) List(prefix string) (map[string]string, error) {
+	root := ""
+	if s.Prefix != "" {
+		root = strings.Trim(s.Prefix, "/") + "/"
+	}
+	result := map[string]string{}
+	token := ""
+	for {
+		u, err := s.bucketURL()
+		if err != nil {
+			return nil, err
+		}
+		q := url.Values{}
+		q.Set("list-type", "2")
+		q.Set("prefix", root+strings.Trim(prefix, "/")+"/")
+		if token != "" {
+			q.Set("continuation-token", token)
+		}
+		u.RawQuery = strings.Replace(q.Encode(), "+", "%20", -1)
+		r, err := http.NewRequest("GET", u.String(), nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := s.do(r, emptyPayload)
+		if err != nil {
+			return nil, err
+		}
+		var list s3ListResult
+		err = xml.NewDecoder(resp.Body).Decode(&list)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range list.Contents {
+			etag := strings.Trim(c.ETag, `"`)
+			if strings.Contains(etag, "-") {
+				etag = ""
+			}
+			result[strings.TrimPrefix(c.Key, root)] = etag
+		}
+		if !list.IsTruncated || list.NextContinuationToken == "" {
+			return result, nil
+		}
+		token = list.NextContinuationToken
+	}
+}
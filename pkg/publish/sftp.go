@@ -0,0 +1,141 @@
+package publish
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+)
+
+// SFTP publishes over SSH by the sftp client in batch mode, so keys and
+// known hosts are handled by the usual SSH configuration
+type SFTP struct {
+	// Host is a destination as sftp takes it, e.g. user@example.com
+	Host string
+	Port string
+	// Root is a remote directory to publish into, relative to the home
+	// directory unless it starts with a slash
+	Root string
+	// Identity is a private key file
+	Identity string
+	// Public makes uploaded files world readable
+	Public bool
+	// Command is the sftp client, "sftp" if empty
+	Command string
+}
+
+// openSFTP takes paths of the URL as absolute ones, paths starting with
+// "/~" are relative to the home directory
+func openSFTP(u *url.URL, public bool) (*SFTP, error) {
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("no host in %q", u.String())
+	}
+	root := u.Path
+	if root == "/~" || strings.HasPrefix(root, "/~/") {
+		root = strings.Trim(root[len("/~"):], "/")
+	}
+	s := &SFTP{
+		Host:     u.Hostname(),
+		Port:     u.Port(),
+		Root:     root,
+		Identity: u.Query().Get("identity"),
+		Public:   public,
+	}
+	if u.User != nil {
+		s.Host = u.User.Username() + "@" + s.Host
+	}
+	return s, nil
+}
+
+// quote makes an argument of a batch command
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+func (s *SFTP) remote(key string) string {
+	if s.Root == "" {
+		return strings.Trim(key, "/")
+	}
+	return path.Join(s.Root, key)
+}
+
+// putScript returns batch commands uploading the files, each directory is
+// made once. Commands prefixed with "-" may fail, e.g. mkdir of an existing
+// directory, others stop the batch.
+func (s *SFTP) putScript(uploads []Upload) string {
+	var b strings.Builder
+	made := map[string]bool{}
+	for _, u := range uploads {
+		remote := s.remote(u.Key)
+		dirs := []string{}
+		for dir := path.Dir(remote); dir != "." && dir != "/" && !made[dir]; dir = path.Dir(dir) {
+			dirs = append([]string{dir}, dirs...)
+			made[dir] = true
+		}
+		for _, dir := range dirs {
+			fmt.Fprintf(&b, "-mkdir %s\n", quote(dir))
+		}
+		fmt.Fprintf(&b, "put %s %s\n", quote(u.File), quote(remote))
+		if s.Public {
+			fmt.Fprintf(&b, "chmod 644 %s\n", quote(remote))
+		}
+	}
+	return b.String()
+}
+
+func (s *SFTP) run(script string) error {
+	command := s.Command
+	if command == "" {
+		command = "sftp"
+	}
+	args := []string{"-b", "-"}
+	if s.Port != "" {
+		args = append(args, "-P", s.Port)
+	}
+	if s.Identity != "" {
+		args = append(args, "-i", s.Identity)
+	}
+	args = append(args, s.Host)
+	cmd := exec.Command(command, args...)
+	cmd.Stdin = strings.NewReader(script)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s: %s", err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// Put uploads the file
+func (s *SFTP) Put(key string, file string, contentType string) error {
+	return s.PutAll([]Upload{{key, file, contentType}})
+}
+
+// PutAll uploads the files in a single sftp session
+func (s *SFTP) PutAll(uploads []Upload) error {
+	return s.run(s.putScript(uploads))
+}
+
+// Delete removes the file
+func (s *SFTP) Delete(key string) error {
+	return s.run(fmt.Sprintf("-rm %s\n", quote(s.remote(key))))
+}
+
+// Get downloads the file
+func (s *SFTP) Get(key string) ([]byte, error) {
+	tmp, err := os.CreateTemp("", "rssbook-sftp-*")
+	if err != nil {
+		return nil, err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+	err = s.run(fmt.Sprintf("get %s %s\n", quote(s.remote(key)), quote(tmp.Name())))
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") || strings.Contains(err.Error(), "No such file") {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return os.ReadFile(tmp.Name())
+}
@@ -0,0 +1,174 @@
+package publish
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/histrio/rssbook/pkg/utils"
+)
+
+// RemoteManifest keeps checksums of published files on storages unable to
+// report them
+const RemoteManifest = ".rssbook-published.json"
+
+type remoteManifest struct {
+	Files map[string]string `json:"files"`
+}
+
+// SyncOptions control publishing of a book
+type SyncOptions struct {
+	// Checksums are known MD5 checksums of local files by their names, e.g.
+	// from the build manifest. Other files are hashed.
+	Checksums map[string]string
+	// Delete removes remote files missing locally
+	Delete bool
+	// Force uploads all files regardless of the remote state
+	Force bool
+}
+
+// SyncResult lists file names by what was done with them
+type SyncResult struct {
+	Uploaded  []string
+	Unchanged []string
+	Deleted   []string
+}
+
+// remoteState returns checksums of files published in the book directory
+// by their names. Names with empty checksums exist but are of unknown
+// content. The second result tells whether the state is kept in the remote
+// manifest.
+func remoteState(p Publisher, bookKey string) (map[string]string, bool, error) {
+	if l, ok := p.(Lister); ok {
+		listed, err := l.List(bookKey)
+		if err != nil {
+			return nil, false, err
+		}
+		state := map[string]string{}
+		for key, sum := range listed {
+			name := strings.TrimPrefix(key, bookKey+"/")
+			if !strings.Contains(name, "/") {
+				state[name] = sum
+			}
+		}
+		return state, false, nil
+	}
+	if f, ok := p.(Fetcher); ok {
+		content, err := f.Get(path.Join(bookKey, RemoteManifest))
+		if err == ErrNotFound {
+			return map[string]string{}, true, nil
+		}
+		if err != nil {
+			return nil, true, err
+		}
+		var m remoteManifest
+		if err := json.Unmarshal(content, &m); err != nil {
+			return nil, true, err
+		}
+		if m.Files == nil {
+			m.Files = map[string]string{}
+		}
+		return m.Files, true, nil
+	}
+	return map[string]string{}, false, nil
+}
+
+// Sync publishes the built book directory under the prefix and the book ID.
+// Only new and changed files are uploaded. Feeds go last, so listeners never
+// see enclosures not uploaded yet, and orphans are deleted after them.
+func Sync(p Publisher, dir string, prefix string, bookID string, o SyncOptions) (SyncResult, error) {
+	result := SyncResult{}
+	bookKey := path.Join(prefix, bookID)
+	names, err := BookFiles(dir)
+	if err != nil {
+		return result, err
+	}
+	remote, manifested, err := remoteState(p, bookKey)
+	if err != nil {
+		return result, err
+	}
+
+	local := map[string]string{}
+	uploads := []Upload{}
+	for _, name := range names {
+		sum, ok := o.Checksums[name]
+		if !ok {
+			sum, err = Checksum(filepath.Join(dir, name))
+			if err != nil {
+				return result, err
+			}
+		}
+		local[name] = sum
+		if !o.Force && remote[name] != "" && remote[name] == sum {
+			result.Unchanged = append(result.Unchanged, name)
+			continue
+		}
+		uploads = append(uploads, Upload{path.Join(bookKey, name), filepath.Join(dir, name), utils.ContentType(name)})
+	}
+	if b, ok := p.(Batcher); ok && len(uploads) > 0 {
+		if err := b.PutAll(uploads); err != nil {
+			return result, err
+		}
+		for _, u := range uploads {
+			result.Uploaded = append(result.Uploaded, path.Base(u.Key))
+		}
+	} else {
+		for _, u := range uploads {
+			if err := p.Put(u.Key, u.File, u.ContentType); err != nil {
+				return result, err
+			}
+			result.Uploaded = append(result.Uploaded, path.Base(u.Key))
+		}
+	}
+
+	published := map[string]string{}
+	for name, sum := range local {
+		published[name] = sum
+	}
+	orphans := []string{}
+	for name := range remote {
+		orphans = append(orphans, name)
+	}
+	sort.Strings(orphans)
+	for _, name := range orphans {
+		if _, ok := local[name]; ok || name == RemoteManifest {
+			continue
+		}
+		if !o.Delete {
+			published[name] = remote[name]
+			continue
+		}
+		if err := p.Delete(path.Join(bookKey, name)); err != nil {
+			return result, err
+		}
+		result.Deleted = append(result.Deleted, name)
+	}
+
+	if manifested {
+		err = putRemoteManifest(p, bookKey, published)
+	}
+	return result, err
+}
+
+func putRemoteManifest(p Publisher, bookKey string, files map[string]string) error {
+	content, err := json.MarshalIndent(remoteManifest{Files: files}, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp("", "rssbook-published-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(append(content, '\n'))
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	return p.Put(path.Join(bookKey, RemoteManifest), tmp.Name(), "application/json")
+}
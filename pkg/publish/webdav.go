@@ -0,0 +1,170 @@
+package publish
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"sync"
+)
+
+// WebDAV publishes to a WebDAV server, e.g. Nextcloud or nginx with
+// dav_methods. Missing collections are created on the way.
+type WebDAV struct {
+	// URL is a root collection to publish into
+	URL      string
+	Username string
+	Password string
+	Client   *http.Client
+
+	mu          sync.Mutex
+	collections map[string]bool
+}
+
+func openWebDAV(u *url.URL) (*WebDAV, error) {
+	root := *u
+	root.Scheme = "http"
+	if u.Scheme == "davs" {
+		root.Scheme = "https"
+	}
+	root.User = nil
+	d := &WebDAV{URL: root.String()}
+	if u.User != nil {
+		d.Username = u.User.Username()
+		d.Password, _ = u.User.Password()
+	}
+	return d, nil
+}
+
+func (d *WebDAV) client() *http.Client {
+	if d.Client != nil {
+		return d.Client
+	}
+	return http.DefaultClient
+}
+
+func (d *WebDAV) url(key string) string {
+	escaped := (&url.URL{Path: strings.Trim(key, "/")}).EscapedPath()
+	if strings.HasSuffix(key, "/") {
+		// Collections are addressed with a trailing slash
+		escaped += "/"
+	}
+	return strings.TrimSuffix(d.URL, "/") + "/" + escaped
+}
+
+func (d *WebDAV) request(method string, key string, body *os.File, contentType string) (*http.Response, error) {
+	r, err := http.NewRequest(method, d.url(key), nil)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		fi, err := body.Stat()
+		if err != nil {
+			return nil, err
+		}
+		r.Body = body
+		r.ContentLength = fi.Size()
+	}
+	if contentType != "" {
+		r.Header.Set("Content-Type", contentType)
+	}
+	if d.Username != "" {
+		r.SetBasicAuth(d.Username, d.Password)
+	}
+	resp, err := d.client().Do(r)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	return resp, nil
+}
+
+// mkcol creates the collection and its parents unless they were created
+// before
+func (d *WebDAV) mkcol(dir string) error {
+	if dir == "." || dir == "/" || dir == "" {
+		return nil
+	}
+	d.mu.Lock()
+	done := d.collections[dir]
+	d.mu.Unlock()
+	if done {
+		return nil
+	}
+	if err := d.mkcol(path.Dir(dir)); err != nil {
+		return err
+	}
+	resp, err := d.request("MKCOL", dir+"/", nil, "")
+	if err != nil {
+		return err
+	}
+	// 405 means the collection exists already
+	if resp.StatusCode/100 != 2 && resp.StatusCode != http.StatusMethodNotAllowed {
+		return fmt.Errorf("MKCOL %s: %s", dir, resp.Status)
+	}
+	d.mu.Lock()
+	if d.collections == nil {
+		d.collections = map[string]bool{}
+	}
+	d.collections[dir] = true
+	d.mu.Unlock()
+	return nil
+}
+
+// Put uploads the file
+func (d *WebDAV) Put(key string, file string, contentType string) error {
+	if err := d.mkcol(path.Dir(strings.Trim(key, "/"))); err != nil {
+		return err
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	resp, err := d.request("PUT", key, f, contentType)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("PUT %s: %s", key, resp.Status)
+	}
+	return nil
+}
+
+// Delete removes the file
+func (d *WebDAV) Delete(key string) error {
+	resp, err := d.request("DELETE", key, nil, "")
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode/100 != 2 && resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("DELETE %s: %s", key, resp.Status)
+	}
+	return nil
+}
+
+// Get downloads the file
+func (d *WebDAV) Get(key string) ([]byte, error) {
+	r, err := http.NewRequest("GET", d.url(key), nil)
+	if err != nil {
+		return nil, err
+	}
+	if d.Username != "" {
+		r.SetBasicAuth(d.Username, d.Password)
+	}
+	resp, err := d.client().Do(r)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+	if resp.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("GET %s: %s", key, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
@@ -0,0 +1,92 @@
+package rss
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/histrio/rssbook/pkg/internal/golden"
+	"github.com/histrio/rssbook/pkg/utils"
+)
+
+// goldenNow is the clock of golden feeds
+var goldenNow = time.Date(2026, 10, 1, 7, 30, 0, 0, time.UTC)
+
+func goldenBooks() map[string]utils.BookMeta {
+	created := time.Date(2026, 9, 1, 12, 0, 0, 0, time.UTC)
+	scheduled := testBook()
+	scheduled.ID = "scheduled"
+	scheduled.Created = created
+	for i := range scheduled.Episodes {
+		scheduled.Episodes[i].PubDate = time.Date(2026, 11, 2+i, 7, 0, 0, 0, time.UTC)
+	}
+
+	series := utils.BookMeta{
+		ID:      "saga",
+		Title:   "Saga",
+		Author:  "Test Author",
+		Series:  "Saga",
+		Created: created,
+		Episodes: []utils.BookEpisode{
+			{Pos: 1, Name: "Volume 1: Episode 001", File: "../volume-1/episode-001.mp3", FileSize: 5,
+				Href: utils.S3Url + "volume-1/episode-001.mp3", Duration: 8 * time.Minute, Season: 1,
+				GUID: "tag:books.falseprotagonist.me,2026-08-01:volume-11"},
+			{Pos: 2, Name: "Volume 2: Episode 001", File: "../volume-2/episode-001.mp3", FileSize: 7,
+				Href: utils.S3Url + "volume-2/episode-001.mp3", Duration: 7*time.Minute + 30*time.Second, Season: 2},
+		},
+	}
+
+	escaped := utils.BookMeta{
+		ID:      "escaped",
+		Title:   `Война & мир <"1">`,
+		Author:  "Лев Толстой",
+		Created: created,
+		Episodes: []utils.BookEpisode{
+			{Pos: 1, Name: "Episode <001> & more", File: "episode-001.mp3", FileSize: 3,
+				Href: utils.S3Url + "escaped/episode-001.mp3", Duration: 59*time.Second + 600*time.Millisecond},
+		},
+	}
+
+	described := testBook()
+	described.ID = "described"
+	described.Created = created
+	described.Narrator = "Test Narrator"
+	described.Description = "A book read aloud, with tags"
+	described.Language = "en"
+
+	return map[string]utils.BookMeta{
+		"plain":     testBook(),
+		"described": described,
+		"scheduled": scheduled,
+		"series":    series,
+		"escaped":   escaped,
+		"empty":     {ID: "empty", Title: "Empty", Created: created},
+	}
+}
+
+func TestGoldenFeeds(t *testing.T) {
+	clock := Clock(func() time.Time { return goldenNow })
+	for name, book := range goldenBooks() {
+		t.Run(name, func(t *testing.T) {
+			got := generateXML(t, book, clock)
+			golden.Check(t, name+".xml", []byte(got))
+			// The same book renders the same feed
+			if again := generateXML(t, book, clock); again != got {
+				t.Error("output differs between runs")
+			}
+		})
+	}
+}
+
+func TestSourceDateEpoch(t *testing.T) {
+	defer os.Unsetenv("SOURCE_DATE_EPOCH")
+	os.Setenv("SOURCE_DATE_EPOCH", "1790000000")
+	feed, err := ParseXML(bytes.NewReader([]byte(generateXML(t, testBook()))))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := time.Unix(1790000000, 0); !feed.Channel.LastBuildDate.Equal(want) {
+		t.Errorf("lastBuildDate = %v, want %v", feed.Channel.LastBuildDate.Time, want)
+	}
+}
@@ -0,0 +1,79 @@
+package rss
+
+func keep(existing string, generated string) string {
+	if existing != "" {
+		return existing
+	}
+	return generated
+}
+
+// Merge updates an existing feed with a freshly generated one. Channel fields
+// edited by hand survive, empty ones are filled from the generated feed.
+// Episodes are matched by GUID: new ones are added, known ones get fresh
+// enclosures and durations but keep their titles, descriptions, publication
+// dates and elements the feed doesn't model. Episodes missing in the generated feed are kept as is.
+// Dates are moved into the time zone of the generated feed.
+func Merge(existing RssBody, generated RssBody) RssBody {
+	merged := existing
+	merged.Version = keep(existing.Version, generated.Version)
+	merged.Content = keep(existing.Content, generated.Content)
+	merged.Atom = keep(existing.Atom, generated.Atom)
+	merged.Itunes = keep(existing.Itunes, generated.Itunes)
+
+	ch := &merged.Channel
+	gen := generated.Channel
+	ch.Title = keep(ch.Title, gen.Title)
+	ch.Link = keep(ch.Link, gen.Link)
+	ch.Description = keep(ch.Description, gen.Description)
+	ch.Language = keep(ch.Language, gen.Language)
+	ch.Docs = keep(ch.Docs, gen.Docs)
+	ch.ItunesAuthor = keep(ch.ItunesAuthor, gen.ItunesAuthor)
+	ch.ItunesExplicit = keep(ch.ItunesExplicit, gen.ItunesExplicit)
+	ch.ItunesType = keep(ch.ItunesType, gen.ItunesType)
+	if ch.Image.URL == "" {
+		ch.Image = gen.Image
+	}
+	if ch.AtomLink.Href == "" {
+		ch.AtomLink = gen.AtomLink
+	}
+	if ch.ItunesImage == nil {
+		ch.ItunesImage = gen.ItunesImage
+	}
+	if ch.ItunesOwner == nil {
+		ch.ItunesOwner = gen.ItunesOwner
+	}
+	if ch.ItunesCategory == nil {
+		ch.ItunesCategory = gen.ItunesCategory
+	}
+	ch.LastBuildDate = gen.LastBuildDate
+
+	known := map[string]int{}
+	for i, item := range existing.Channel.Entries {
+		if item.GUID.Value != "" {
+			known[item.GUID.Value] = i
+		}
+	}
+	used := map[int]bool{}
+	entries := []rssItem{}
+	for _, item := range gen.Entries {
+		if i, ok := known[item.GUID.Value]; ok && !used[i] {
+			old := existing.Channel.Entries[i]
+			used[i] = true
+			item.Title = keep(old.Title, item.Title)
+			item.Description = keep(old.Description, item.Description)
+			item.Extra = old.Extra
+			if !old.PubDate.IsZero() {
+				item.PubDate = old.PubDate
+			}
+		}
+		entries = append(entries, item)
+	}
+	for i, item := range existing.Channel.Entries {
+		if !used[i] {
+			entries = append(entries, item)
+		}
+	}
+	ch.Entries = entries
+	merged.in(gen.LastBuildDate.Location())
+	return merged
+}
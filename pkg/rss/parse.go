@@ -0,0 +1,103 @@
+package rss
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// prefixedTokenReader keeps namespace prefixes as a part of local names, so
+// elements like <itunes:duration> match the struct tags used for marshalling.
+type prefixedTokenReader struct {
+	d *xml.Decoder
+}
+
+func prefixed(name xml.Name) xml.Name {
+	if name.Space == "" {
+		return name
+	}
+	return xml.Name{Local: name.Space + ":" + name.Local}
+}
+
+func (r prefixedTokenReader) Token() (xml.Token, error) {
+	t, err := r.d.RawToken()
+	if err != nil {
+		return nil, err
+	}
+	switch t := t.(type) {
+	case xml.StartElement:
+		start := xml.StartElement{Name: prefixed(t.Name)}
+		for _, a := range t.Attr {
+			start.Attr = append(start.Attr, xml.Attr{Name: prefixed(a.Name), Value: a.Value})
+		}
+		return start, nil
+	case xml.EndElement:
+		return xml.EndElement{Name: prefixed(t.Name)}, nil
+	}
+	return xml.CopyToken(t), nil
+}
+
+// rawElement is an element of a parsed feed without a field of its own, it
+// is written back as it was read
+type rawElement struct {
+	XMLName  xml.Name
+	Attrs    []xml.Attr   `xml:",any,attr"`
+	Text     string       `xml:",chardata"`
+	Children []rawElement `xml:",any"`
+}
+
+func (e *rawElement) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	type plain rawElement
+	if err := d.DecodeElement((*plain)(e), &start); err != nil {
+		return err
+	}
+	// Indentation between children would pile up with every rendering
+	if len(e.Children) > 0 && strings.TrimSpace(e.Text) == "" {
+		e.Text = ""
+	}
+	return nil
+}
+
+// ParseXML reads a feed previously generated by GenerateXML or any other
+// RSS 2.0 podcast feed
+func ParseXML(r io.Reader) (RssBody, error) {
+	body, err := ParseXMLLenient(r)
+	if err != nil {
+		return body, err
+	}
+	return body, body.checkDates()
+}
+
+// ParseXMLLenient reads a feed like ParseXML but keeps invalid dates as text
+// with a zero time, so Validate can report them along with other issues
+func ParseXMLLenient(r io.Reader) (RssBody, error) {
+	var body RssBody
+	d := xml.NewTokenDecoder(prefixedTokenReader{d: xml.NewDecoder(r)})
+	err := d.Decode(&body)
+	return body, err
+}
+
+// checkDates fails on the first date of the feed that can't be parsed
+func (body *RssBody) checkDates() error {
+	if err := body.Channel.LastBuildDate.Err(); err != nil {
+		return fmt.Errorf("channel/lastBuildDate: %w", err)
+	}
+	for i, item := range body.Channel.Entries {
+		if err := item.PubDate.Err(); err != nil {
+			return fmt.Errorf("channel/item[%d]/pubDate: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+// ParseFile reads a feed from the file
+func ParseFile(filename string) (RssBody, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return RssBody{}, err
+	}
+	defer f.Close()
+	return ParseXML(f)
+}
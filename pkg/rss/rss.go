@@ -3,21 +3,81 @@ package rss
 import (
 	"encoding/xml"
 	"fmt"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/histrio/rssbook/pkg/utils"
 )
 
+// RFC822Time is a date formatted as RFC 1123 with a numeric zone, the form
+// of RFC 822 dates recommended for RSS
 type RFC822Time struct {
 	time.Time
+	// raw is the text the date was read from
+	raw string
+}
+
+// rfc822Zones are zone names allowed by RFC 822 besides numeric offsets
+var rfc822Zones = map[string]string{
+	"UT": "+0000", "GMT": "+0000", "Z": "+0000",
+	"EST": "-0500", "EDT": "-0400",
+	"CST": "-0600", "CDT": "-0500",
+	"MST": "-0700", "MDT": "-0600",
+	"PST": "-0800", "PDT": "-0700",
+}
+
+// rfc822Layouts cover optional seconds and two-digit years, the weekday is
+// stripped before parsing
+var rfc822Layouts = []string{
+	"2 Jan 2006 15:04:05 -0700",
+	"2 Jan 2006 15:04 -0700",
+	"2 Jan 06 15:04:05 -0700",
+	"2 Jan 06 15:04 -0700",
+}
+
+// ParseRFC822 parses RFC 822 and RFC 1123 dates as they appear in feeds
+func ParseRFC822(value string) (time.Time, error) {
+	normalized := strings.Join(strings.Fields(value), " ")
+	if i := strings.Index(normalized, ","); i >= 0 {
+		normalized = strings.TrimSpace(normalized[i+1:])
+	}
+	if i := strings.LastIndex(normalized, " "); i >= 0 {
+		if offset, ok := rfc822Zones[strings.ToUpper(normalized[i+1:])]; ok {
+			normalized = normalized[:i+1] + offset
+		}
+	}
+	for _, layout := range rfc822Layouts {
+		t, err := time.Parse(layout, normalized)
+		if err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid RFC 822 date %q", value)
 }
 
 func (t RFC822Time) MarshalText() ([]byte, error) {
-	text := t.Time.Format("Mon, 02 Jan 2006 03:04:05 -0700")
+	text := t.Time.Format(time.RFC1123Z)
 	return []byte(text), nil
 }
 
+// UnmarshalText keeps the text of a date it can't parse with a zero time,
+// so the rest of the feed is still read. ParseXML reports such dates.
+func (t *RFC822Time) UnmarshalText(text []byte) error {
+	t.raw = string(text)
+	t.Time, _ = ParseRFC822(t.raw)
+	return nil
+}
+
+// Err tells why the date read from the feed is invalid
+func (t RFC822Time) Err() error {
+	if !t.IsZero() || strings.TrimSpace(t.raw) == "" {
+		return nil
+	}
+	_, err := ParseRFC822(t.raw)
+	return err
+}
+
 type Duration struct {
 	time.Duration
 }
@@ -33,6 +93,28 @@ func (d Duration) MarshalText() ([]byte, error) {
 	return []byte(text), nil
 }
 
+func (d *Duration) UnmarshalText(text []byte) error {
+	value := strings.TrimSpace(string(text))
+	if value == "" {
+		d.Duration = 0
+		return nil
+	}
+	parts := strings.Split(value, ":")
+	if len(parts) > 3 {
+		return fmt.Errorf("invalid duration %q", value)
+	}
+	total := 0.0
+	for _, part := range parts {
+		n, err := strconv.ParseFloat(part, 64)
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid duration %q", value)
+		}
+		total = total*60 + n
+	}
+	d.Duration = time.Duration(total * float64(time.Second))
+	return nil
+}
+
 type rssEnclosure struct {
 	URL    string `xml:"url,attr"`
 	Length int64  `xml:"length,attr"`
@@ -58,6 +140,11 @@ type rssItem struct {
 
 	ItunesDuration Duration `xml:"itunes:duration"`
 	ItunesExplicit string   `xml:"itunes:explicit"`
+	ItunesSeason   int      `xml:"itunes:season,omitempty"`
+	ItunesEpisode  int      `xml:"itunes:episode,omitempty"`
+
+	// Extra keeps elements of a parsed feed the item doesn't model
+	Extra []rawElement `xml:",any"`
 }
 
 type RssBody struct {
@@ -67,6 +154,10 @@ type RssBody struct {
 	Atom    string     `xml:"xmlns:atom,attr"`
 	Itunes  string     `xml:"xmlns:itunes,attr"`
 	Channel rssChannel `xml:"channel"`
+
+	// Attrs keeps other attributes of a parsed feed, e.g. namespaces of
+	// the elements kept in Extra
+	Attrs []xml.Attr `xml:",any,attr"`
 }
 
 type rssAtomLink struct {
@@ -90,9 +181,14 @@ type rssCloud struct {
 	Protocol          string   `xml:"protocol,attr"`
 }
 
+type rssItunesImage struct {
+	Href string `xml:"href,attr"`
+}
+
 type rssItunesCategory struct {
-	XMLName xml.Name `xml:"itunes:category"`
-	Text    string   `xml:"text,attr"`
+	XMLName       xml.Name            `xml:"itunes:category"`
+	Text          string              `xml:"text,attr"`
+	Subcategories []rssItunesCategory `xml:"itunes:category,omitempty"`
 }
 
 type rssChannel struct {
@@ -113,10 +209,16 @@ type rssChannel struct {
 	Cloud          *rssCloud  `xml:"cloud,omitempty"`
 	Rating         string     `xml:"rating,omitempty"`
 
-	AtomLink       rssAtomLink `xml:"atom:link,omitempty"`
+	AtomLink       rssAtomLink     `xml:"atom:link,omitempty"`
+	ItunesAuthor   string          `xml:"itunes:author,omitempty"`
+	ItunesImage    *rssItunesImage `xml:"itunes:image,omitempty"`
 	ItunesOwner    *rssItunesOwner
 	ItunesCategory *rssItunesCategory
 	ItunesExplicit string `xml:"itunes:explicit"`
+	ItunesType     string `xml:"itunes:type,omitempty"`
+
+	// Extra keeps elements of a parsed feed the channel doesn't model
+	Extra []rawElement `xml:",any"`
 
 	Entries []rssItem `xml:"item"`
 }
@@ -129,35 +231,123 @@ type rssImage struct {
 	Height int    `xml:"height"`
 }
 
-func GenerateXML(book utils.BookMeta) string {
+// options are settings of a generated feed
+type options struct {
+	now      func() time.Time
+	location *time.Location
+}
+
+// Option adjusts a generated feed
+type Option func(o *options)
+
+// Clock dates the build and episodes without publication dates, utils.Now
+// by default
+func Clock(now func() time.Time) Option {
+	return func(o *options) {
+		o.now = now
+	}
+}
+
+// Location formats dates of the feed in the time zone, UTC by default
+func Location(location *time.Location) Option {
+	return func(o *options) {
+		o.location = location
+	}
+}
+
+// SignEnclosures passes enclosure URLs of the feed through sign
+func (body *RssBody) SignEnclosures(sign func(link string) string) {
+	for i := range body.Channel.Entries {
+		enclosure := &body.Channel.Entries[i].Enclosure
+		enclosure.URL = sign(enclosure.URL)
+	}
+}
+
+// in moves dates of the feed into the time zone
+func (body *RssBody) in(location *time.Location) {
+	ch := &body.Channel
+	ch.LastBuildDate.Time = ch.LastBuildDate.In(location)
+	for i := range ch.Entries {
+		item := &ch.Entries[i]
+		item.PubDate.Time = item.PubDate.In(location)
+	}
+}
+
+// GenerateXML renders a feed for the book
+func GenerateXML(book utils.BookMeta, opts ...Option) (string, error) {
+	return RenderXML(Generate(book, opts...))
+}
+
+// guidDomain is a tagging entity of episode GUIDs
+const guidDomain = "books.falseprotagonist.me"
+
+// EpisodeGUID returns a GUID of the book's episode. Episodes taken from
+// another book keep their original GUID.
+func EpisodeGUID(book utils.BookMeta, ep utils.BookEpisode) string {
+	if ep.GUID != "" {
+		return ep.GUID
+	}
+	guidDate := book.Created
+	if guidDate.IsZero() {
+		guidDate = utils.Now()
+	}
+	return utils.GetID(guidDomain, fmt.Sprintf("%s%d", book.ID, ep.Pos), guidDate)
+}
+
+// Generate builds a feed for the book
+func Generate(book utils.BookMeta, opts ...Option) RssBody {
+	o := options{now: utils.Now, location: time.UTC}
+	for _, opt := range opts {
+		opt(&o)
+	}
 
 	items := []rssItem{}
-	t0 := time.Now()
+	t0 := o.now()
+	if book.Created.IsZero() {
+		book.Created = t0
+	}
+	serial := false
 	for _, ep := range book.Episodes {
+		pubDate := ep.PubDate
+		if pubDate.IsZero() {
+			pubDate = t0.Add(time.Second * time.Duration(ep.Pos))
+		}
 		item := rssItem{
 			Title: ep.Name,
 			Link:  ep.Href,
 			GUID: rssItemGUID{
 				IsPermaLink: false,
-				Value:       utils.GetID("books.falseprotagonist.me", fmt.Sprintf("%s%d", book.ID, ep.Pos), t0),
+				Value:       EpisodeGUID(book, ep),
 			},
 			Enclosure: rssEnclosure{
 				URL:    ep.Href,
 				Type:   "audio/mpeg",
 				Length: ep.FileSize,
 			},
-			PubDate:        RFC822Time{t0.Add(time.Second * time.Duration(ep.Pos))},
-			ItunesExplicit: "no",
+			PubDate:        RFC822Time{Time: pubDate},
+			ItunesExplicit: "false",
 			ItunesDuration: Duration{ep.Duration},
 		}
+		if ep.Season > 0 {
+			item.ItunesSeason = ep.Season
+			item.ItunesEpisode = ep.Pos
+			serial = true
+		}
 		items = append(items, item)
 	}
 
-	selfLink := strings.Join([]string{utils.S3Url, book.ID + "/", book.ID + ".xml"}, "")
-	bookHash := utils.GetMD5Hash(selfLink)
-	imageSize := 1400
-	imageURL := fmt.Sprintf("https://www.gravatar.com/avatar/%s?s=%d&d=retro&r=g", bookHash, imageSize)
-	rss := &RssBody{
+	description, language := book.Description, book.Language
+	if description == "" {
+		description = "Audiobook as a podcast"
+	}
+	if language == "" {
+		language = "ru"
+	}
+
+	selfLink := book.FeedURL()
+	imageSize := utils.ImageSize
+	imageURL := book.ImageURL()
+	body := RssBody{
 		Version: "2.0",
 		Content: "http://purl.org/rss/1.0/modules/content/",
 		Atom:    "http://www.w3.org/2005/Atom",
@@ -165,8 +355,8 @@ func GenerateXML(book utils.BookMeta) string {
 		Channel: rssChannel{
 			Title:       book.Title,
 			Link:        selfLink,
-			Description: "Audiobook as a podcast",
-			Language:    "ru",
+			Description: description,
+			Language:    language,
 			Entries:     items,
 			Docs:        "http://blogs.law.harvard.edu/tech/rss",
 			AtomLink: rssAtomLink{
@@ -174,7 +364,7 @@ func GenerateXML(book utils.BookMeta) string {
 				Rel:  "self",
 				Type: "application/rss+xml",
 			},
-			LastBuildDate: RFC822Time{t0},
+			LastBuildDate: RFC822Time{Time: t0},
 			Image: rssImage{
 				Title:  book.Title,
 				Link:   selfLink,
@@ -182,14 +372,43 @@ func GenerateXML(book utils.BookMeta) string {
 				Width:  imageSize,
 				Height: imageSize,
 			},
-			ItunesExplicit: "no",
+			ItunesImage:    &rssItunesImage{Href: imageURL},
+			ItunesExplicit: "false",
 			ItunesCategory: &rssItunesCategory{
 				Text: "Education",
 			},
 		},
 	}
+	if serial {
+		body.Channel.ItunesType = "serial"
+	}
+	body.in(o.location)
+	return body
+}
+
+// RewriteURLs replaces links, enclosures and images of the feed with the
+// result of rewrite
+func (body *RssBody) RewriteURLs(rewrite func(string) string) {
+	ch := &body.Channel
+	ch.Link = rewrite(ch.Link)
+	ch.AtomLink.Href = rewrite(ch.AtomLink.Href)
+	ch.Image.Link = rewrite(ch.Image.Link)
+	ch.Image.URL = rewrite(ch.Image.URL)
+	if ch.ItunesImage != nil {
+		ch.ItunesImage.Href = rewrite(ch.ItunesImage.Href)
+	}
+	for i := range ch.Entries {
+		item := &ch.Entries[i]
+		item.Link = rewrite(item.Link)
+		item.Enclosure.URL = rewrite(item.Enclosure.URL)
+	}
+}
 
-	out, err := xml.MarshalIndent(rss, "", "  ")
-	utils.Check(err)
-	return xml.Header + string(out)
+// RenderXML renders the feed as an XML document
+func RenderXML(body RssBody) (string, error) {
+	out, err := xml.MarshalIndent(body, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	return xml.Header + string(out), nil
 }
@@ -1 +1,390 @@
 package rss
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	_ "time/tzdata"
+
+	"github.com/histrio/rssbook/pkg/utils"
+)
+
+func testBook() utils.BookMeta {
+	return utils.BookMeta{
+		ID:     "test",
+		Title:  "Test Book",
+		Author: "Test Author",
+		Episodes: []utils.BookEpisode{
+			{Pos: 1, Name: "Episode 001", File: "episode-001.mp3", FileSize: 5,
+				Href: utils.S3Url + "test/episode-001.mp3", Duration: 90 * time.Second},
+			{Pos: 2, Name: "Episode 002", File: "episode-002.mp3", FileSize: 7,
+				Href: utils.S3Url + "test/episode-002.mp3", Duration: time.Hour + time.Second},
+		},
+	}
+}
+
+// generateXML renders a feed for the book or fails the test
+func generateXML(t *testing.T, book utils.BookMeta, opts ...Option) string {
+	t.Helper()
+	feed, err := GenerateXML(book, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return feed
+}
+
+func TestParseXML(t *testing.T) {
+	book := testBook()
+	feed, err := ParseXML(strings.NewReader(generateXML(t, book)))
+	if err != nil {
+		t.Fatalf("ParseXML() error = %v", err)
+	}
+	if feed.Itunes != itunesNamespace {
+		t.Errorf("Itunes = %q, want %q", feed.Itunes, itunesNamespace)
+	}
+	if feed.Channel.Title != book.Title {
+		t.Errorf("Title = %q, want %q", feed.Channel.Title, book.Title)
+	}
+	if feed.Channel.ItunesCategory == nil || feed.Channel.ItunesCategory.Text != "Education" {
+		t.Errorf("ItunesCategory = %+v, want Education", feed.Channel.ItunesCategory)
+	}
+	if len(feed.Channel.Entries) != len(book.Episodes) {
+		t.Fatalf("got %d items, want %d", len(feed.Channel.Entries), len(book.Episodes))
+	}
+	for i, ep := range book.Episodes {
+		item := feed.Channel.Entries[i]
+		if item.Enclosure.URL != ep.Href || item.Enclosure.Length != ep.FileSize {
+			t.Errorf("item[%d] enclosure = %+v", i, item.Enclosure)
+		}
+		if item.ItunesDuration.Duration != ep.Duration {
+			t.Errorf("item[%d] duration = %v, want %v", i, item.ItunesDuration.Duration, ep.Duration)
+		}
+		if item.PubDate.IsZero() {
+			t.Errorf("item[%d] pubDate is not parsed", i)
+		}
+	}
+}
+
+func TestRFC822TimeMarshalText(t *testing.T) {
+	berlin, _ := time.LoadLocation("Europe/Berlin")
+	tests := []struct {
+		name     string
+		location *time.Location
+		t        time.Time
+		want     string
+	}{
+		{"afternoon", time.UTC, time.Date(2021, 3, 4, 15, 4, 5, 0, time.UTC), "Thu, 04 Mar 2021 15:04:05 +0000"},
+		{"midnight", time.UTC, time.Date(2021, 3, 4, 0, 0, 0, 0, time.UTC), "Thu, 04 Mar 2021 00:00:00 +0000"},
+		{"zone winter", berlin, time.Date(2021, 1, 10, 12, 0, 0, 0, time.UTC), "Sun, 10 Jan 2021 13:00:00 +0100"},
+		{"zone summer", berlin, time.Date(2021, 7, 10, 12, 0, 0, 0, time.UTC), "Sat, 10 Jul 2021 14:00:00 +0200"},
+		{"to utc", time.UTC, time.Date(2021, 7, 10, 23, 30, 0, 0, berlin), "Sat, 10 Jul 2021 21:30:00 +0000"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			book := utils.BookMeta{Episodes: []utils.BookEpisode{{Pos: 1, PubDate: tt.t}}}
+			got, err := Generate(book, Location(tt.location)).Channel.Entries[0].PubDate.MarshalText()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("MarshalText() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRFC822TimeRoundTrip(t *testing.T) {
+	zones := []string{"UTC", "Europe/Berlin", "America/New_York", "Asia/Kolkata", "America/St_Johns", "Australia/Lord_Howe"}
+	moments := []time.Time{
+		time.Date(2021, 3, 28, 0, 59, 59, 0, time.UTC),   // before EU DST starts
+		time.Date(2021, 3, 28, 1, 0, 0, 0, time.UTC),     // EU DST starts
+		time.Date(2021, 10, 31, 0, 30, 0, 0, time.UTC),   // ambiguous hour in Berlin
+		time.Date(2021, 11, 7, 6, 30, 0, 0, time.UTC),    // ambiguous hour in New York
+		time.Date(2021, 12, 31, 23, 59, 59, 0, time.UTC), // year boundary
+	}
+	for _, zone := range zones {
+		loc, err := time.LoadLocation(zone)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, moment := range moments {
+			text, err := RFC822Time{Time: moment.In(loc)}.MarshalText()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var parsed RFC822Time
+			if err := parsed.UnmarshalText(text); err != nil {
+				t.Fatalf("%s: UnmarshalText(%q) error = %v", zone, text, err)
+			}
+			if !parsed.Equal(moment) {
+				t.Errorf("%s: %q parsed as %v, want %v", zone, text, parsed.Time, moment)
+			}
+		}
+	}
+}
+
+func TestParseRFC822(t *testing.T) {
+	want := time.Date(2021, 3, 4, 15, 4, 0, 0, time.UTC)
+	tests := []struct {
+		text    string
+		wantErr bool
+	}{
+		{"Thu, 04 Mar 2021 15:04:00 +0000", false},
+		{"Thu, 04 Mar 2021 15:04:00 GMT", false},
+		{"Thu, 04 Mar 2021 10:04:00 EST", false},
+		{"Thu, 04 Mar 2021 17:04:00 +0200", false},
+		{"04 Mar 2021 15:04 UT", false},
+		{"Thu,  4 Mar 21 15:04:00 Z", false},
+		{"  Thu, 04 Mar 2021 15:04:00 +0000\n", false},
+		{"2021-03-04T15:04:00Z", true},
+		{"Donnerstag, 04 Mär 2021 15:04:00 +0000", true},
+		{"", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			got, err := ParseRFC822(tt.text)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseRFC822() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !got.Equal(want) {
+				t.Errorf("ParseRFC822() = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestDurationUnmarshalText(t *testing.T) {
+	tests := []struct {
+		text    string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"01:02:03", time.Hour + 2*time.Minute + 3*time.Second, false},
+		{"02:03", 2*time.Minute + 3*time.Second, false},
+		{"3600", time.Hour, false},
+		{"", 0, false},
+		{"1:2:3:4", 0, true},
+		{"abc", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.text, func(t *testing.T) {
+			var d Duration
+			err := d.UnmarshalText([]byte(tt.text))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("UnmarshalText() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && d.Duration != tt.want {
+				t.Errorf("UnmarshalText() = %v, want %v", d.Duration, tt.want)
+			}
+		})
+	}
+}
+
+func hasIssue(issues []Issue, severity Severity, path string) bool {
+	for _, issue := range issues {
+		if issue.Severity == severity && issue.Path == path {
+			return true
+		}
+	}
+	return false
+}
+
+func TestValidate(t *testing.T) {
+	dir, err := os.MkdirTemp("", "rssbook")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.WriteFile(filepath.Join(dir, "episode-001.mp3"), []byte("12345"), 0644)
+	os.WriteFile(filepath.Join(dir, "episode-002.mp3"), []byte("123"), 0644)
+
+	feed, err := ParseXML(strings.NewReader(generateXML(t, testBook())))
+	if err != nil {
+		t.Fatal(err)
+	}
+	feed.Channel.Entries[1].GUID = feed.Channel.Entries[0].GUID
+	feed.Channel.ItunesImage = nil
+	feed.Channel.ItunesExplicit = "no"
+	issues := Validate(feed, ValidateOptions{Dir: dir, Now: time.Now().Add(time.Hour)})
+
+	tests := []struct {
+		severity Severity
+		path     string
+	}{
+		{SeverityError, "channel/itunes:image"},
+		{SeverityWarning, "channel/image/width"},
+		{SeverityWarning, "channel/itunes:explicit"},
+		{SeverityError, "channel/item[2]/guid"},
+		{SeverityError, "channel/item[2]/enclosure"},
+	}
+	for _, tt := range tests {
+		if !hasIssue(issues, tt.severity, tt.path) {
+			t.Errorf("no %s at %s in %v", tt.severity, tt.path, issues)
+		}
+	}
+	if hasIssue(issues, SeverityError, "channel/item[1]/enclosure") {
+		t.Errorf("enclosure of item[1] matches the file: %v", issues)
+	}
+}
+
+func TestValidateGenerated(t *testing.T) {
+	book := testBook()
+	book.Episodes[0].Season = 1
+	feed, err := ParseXML(strings.NewReader(generateXML(t, book)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, issue := range Validate(feed, ValidateOptions{Now: time.Now().Add(time.Hour)}) {
+		if issue.Severity == SeverityError || strings.HasSuffix(issue.Path, "itunes:explicit") {
+			t.Errorf("generated feed: %s", issue)
+		}
+	}
+}
+
+func TestValidateInvalidDates(t *testing.T) {
+	feed := generateXML(t, testBook())
+	for _, date := range []string{"<lastBuildDate>", "<pubDate>"} {
+		i := strings.Index(feed, date) + len(date)
+		j := i + strings.Index(feed[i:], "<")
+		feed = feed[:i] + "yesterday" + feed[j:]
+	}
+	feed = strings.Replace(feed, `type="audio/mpeg"`, `type="audio/ogg"`, 1)
+
+	if _, err := ParseXML(strings.NewReader(feed)); err == nil {
+		t.Error("ParseXML() accepted invalid dates")
+	}
+	parsed, err := ParseXMLLenient(strings.NewReader(feed))
+	if err != nil {
+		t.Fatalf("ParseXMLLenient() error = %v", err)
+	}
+	issues := Validate(parsed, ValidateOptions{})
+
+	tests := []struct {
+		severity Severity
+		path     string
+	}{
+		{SeverityError, "channel/lastBuildDate"},
+		{SeverityError, "channel/item[1]/pubDate"},
+		{SeverityError, "channel/item[1]/enclosure"},
+	}
+	for _, tt := range tests {
+		if !hasIssue(issues, tt.severity, tt.path) {
+			t.Errorf("no %s at %s in %v", tt.severity, tt.path, issues)
+		}
+	}
+	if hasIssue(issues, SeverityError, "channel/item[2]/pubDate") {
+		t.Errorf("valid pubDate of item[2] reported: %v", issues)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	book := testBook()
+	book.Created = time.Date(2021, 3, 4, 0, 0, 0, 0, time.UTC)
+	existing := Generate(book)
+	existing.Channel.Title = "Edited Title"
+	existing.Channel.Entries = existing.Channel.Entries[:1]
+	existing.Channel.Entries[0].Title = "Prologue"
+	oldDate := time.Date(2021, 3, 4, 7, 0, 0, 0, time.UTC)
+	existing.Channel.Entries[0].PubDate = RFC822Time{Time: oldDate}
+	existing.Channel.Entries = append(existing.Channel.Entries, rssItem{
+		Title: "Bonus",
+		GUID:  rssItemGUID{Value: "bonus"},
+	})
+
+	book.Episodes[0].FileSize = 42
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	merged := Merge(existing, Generate(book, Location(berlin)))
+
+	if merged.Channel.Title != "Edited Title" {
+		t.Errorf("Title = %q, hand-edited value is lost", merged.Channel.Title)
+	}
+	entries := merged.Channel.Entries
+	if len(entries) != 3 {
+		t.Fatalf("got %d items, want 3", len(entries))
+	}
+	if entries[0].Title != "Prologue" || !entries[0].PubDate.Equal(oldDate) {
+		t.Errorf("item[0] = %q %v, want hand-edited title and old date", entries[0].Title, entries[0].PubDate.Time)
+	}
+	if text, _ := entries[0].PubDate.MarshalText(); string(text) != "Thu, 04 Mar 2021 08:00:00 +0100" {
+		t.Errorf("item[0] date = %s, want it in the time zone of the generated feed", text)
+	}
+	if entries[0].Enclosure.Length != 42 {
+		t.Errorf("item[0] enclosure length = %d, want 42", entries[0].Enclosure.Length)
+	}
+	if entries[1].Title != "Episode 002" {
+		t.Errorf("item[1] = %q, want a new episode", entries[1].Title)
+	}
+	if entries[2].GUID.Value != "bonus" {
+		t.Errorf("item[2] = %q, want the hand-added item", entries[2].GUID.Value)
+	}
+}
+
+func TestUnknownElements(t *testing.T) {
+	book := testBook()
+	feed := generateXML(t, book)
+	feed = strings.Replace(feed, `<rss `, `<rss xmlns:googleplay="http://www.google.com/schemas/play-podcasts/1.0" `, 1)
+	feed = strings.Replace(feed, `<itunes:category text="Education"></itunes:category>`,
+		`<itunes:category text="Education"><itunes:category text="Language Learning"/></itunes:category>`+
+			`<itunes:summary>Read &amp; told</itunes:summary>`+
+			`<googleplay:block>yes</googleplay:block>`, 1)
+	feed = strings.Replace(feed, `<itunes:duration>`, `<itunes:summary>First</itunes:summary><itunes:duration>`, 1)
+	kept := []string{
+		`xmlns:googleplay="http://www.google.com/schemas/play-podcasts/1.0"`,
+		`<itunes:category text="Language Learning"></itunes:category>`,
+		`<itunes:summary>Read &amp; told</itunes:summary>`,
+		`<googleplay:block>yes</googleplay:block>`,
+		`<itunes:summary>First</itunes:summary>`,
+	}
+
+	parsed, err := ParseXML(strings.NewReader(feed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := ""
+	for i := 0; i < 2; i++ {
+		rendered, err := RenderXML(parsed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if previous != "" && rendered != previous {
+			t.Errorf("rendering changed on round %d:\n%s", i+1, rendered)
+		}
+		previous = rendered
+		for _, element := range kept {
+			if !strings.Contains(rendered, element) {
+				t.Errorf("round %d: %s is lost:\n%s", i+1, element, rendered)
+			}
+		}
+		if parsed, err = ParseXML(strings.NewReader(rendered)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rendered, err := RenderXML(Merge(parsed, Generate(book)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, element := range kept {
+		if !strings.Contains(rendered, element) {
+			t.Errorf("merged: %s is lost:\n%s", element, rendered)
+		}
+	}
+}
+
+func TestSignEnclosures(t *testing.T) {
+	feed, err := ParseXML(strings.NewReader(generateXML(t, testBook())))
+	if err != nil {
+		t.Fatal(err)
+	}
+	feed.SignEnclosures(func(link string) string { return link + "?sig=1" })
+	for i, item := range feed.Channel.Entries {
+		if !strings.HasSuffix(item.Enclosure.URL, "?sig=1") || strings.HasSuffix(item.Link, "?sig=1") {
+			t.Errorf("item[%d] enclosure = %s, link = %s", i, item.Enclosure.URL, item.Link)
+		}
+	}
+}
@@ -0,0 +1,305 @@
+package rss
+
+import (
+	"fmt"
+	"image"
+	_ "image/jpeg" // register decoders for the cover art checks
+	_ "image/png"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Severity of a validation issue
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
+
+// Issue is a single problem found in a feed
+type Issue struct {
+	Severity Severity `json:"severity"`
+	Path     string   `json:"path"`
+	Message  string   `json:"message"`
+}
+
+func (i Issue) String() string {
+	return fmt.Sprintf("%s: %s: %s", i.Severity, i.Path, i.Message)
+}
+
+// ValidateOptions tunes the feed validation
+type ValidateOptions struct {
+	// Dir is a directory with the feed files. Enclosures and images are
+	// looked up there by their base names. File checks are skipped if empty.
+	Dir string
+	// Now is a moment to compare publication dates with
+	Now time.Time
+}
+
+const itunesNamespace = "http://www.itunes.com/dtds/podcast-1.0.dtd"
+
+// RSS 2.0 limits for the channel image
+const (
+	rssImageMaxWidth  = 144
+	rssImageMaxHeight = 400
+)
+
+// Apple Podcasts limits for the show artwork
+const (
+	itunesImageMinSize = 1400
+	itunesImageMaxSize = 3000
+)
+
+var itunesCategories = map[string]bool{
+	"Arts": true, "Business": true, "Comedy": true, "Education": true,
+	"Fiction": true, "Government": true, "History": true, "Health & Fitness": true,
+	"Kids & Family": true, "Leisure": true, "Music": true, "News": true,
+	"Religion & Spirituality": true, "Science": true, "Society & Culture": true,
+	"Sports": true, "Technology": true, "True Crime": true, "TV & Film": true,
+}
+
+var itunesEnclosureTypes = map[string]bool{
+	"audio/mpeg":      true,
+	"audio/x-m4a":     true,
+	"audio/mp4":       true,
+	"video/mp4":       true,
+	"video/x-m4v":     true,
+	"video/quicktime": true,
+	"application/pdf": true,
+}
+
+type validator struct {
+	opts   ValidateOptions
+	issues []Issue
+}
+
+func (v *validator) errorf(path string, format string, args ...interface{}) {
+	v.issues = append(v.issues, Issue{SeverityError, path, fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) warnf(path string, format string, args ...interface{}) {
+	v.issues = append(v.issues, Issue{SeverityWarning, path, fmt.Sprintf(format, args...)})
+}
+
+// localFile maps a feed URL to a file in the feed directory
+func (v *validator) localFile(link string) (string, bool) {
+	if v.opts.Dir == "" || link == "" {
+		return "", false
+	}
+	u, err := url.Parse(link)
+	if err != nil {
+		return "", false
+	}
+	name := path.Base(u.Path)
+	if name == "/" || name == "." {
+		return "", false
+	}
+	return filepath.Join(v.opts.Dir, name), true
+}
+
+// Validate checks the feed against RSS 2.0 and Apple Podcasts requirements
+func Validate(feed RssBody, opts ValidateOptions) []Issue {
+	if opts.Now.IsZero() {
+		opts.Now = time.Now()
+	}
+	v := &validator{opts: opts}
+
+	if feed.Version != "2.0" {
+		v.errorf("rss", "version is %q, must be \"2.0\"", feed.Version)
+	}
+	if feed.Itunes != itunesNamespace {
+		v.errorf("rss", "itunes namespace must be declared as %q", itunesNamespace)
+	}
+	v.validateChannel(feed.Channel)
+	return v.issues
+}
+
+func (v *validator) validateChannel(ch rssChannel) {
+	p := "channel"
+	if strings.TrimSpace(ch.Title) == "" {
+		v.errorf(p+"/title", "required element is missing")
+	}
+	if strings.TrimSpace(ch.Link) == "" {
+		v.errorf(p+"/link", "required element is missing")
+	}
+	if strings.TrimSpace(ch.Description) == "" {
+		v.errorf(p+"/description", "required element is missing")
+	}
+	if ch.Language == "" {
+		v.errorf(p+"/language", "required by Apple Podcasts")
+	}
+	if err := ch.LastBuildDate.Err(); err != nil {
+		v.errorf(p+"/lastBuildDate", "%s", err)
+	} else if !ch.LastBuildDate.IsZero() && ch.LastBuildDate.After(v.opts.Now) {
+		v.warnf(p+"/lastBuildDate", "date %v is in the future", ch.LastBuildDate.Time)
+	}
+	v.validateImage(ch.Image)
+	v.validateItunes(ch)
+
+	if len(ch.Entries) == 0 {
+		v.warnf(p, "feed has no episodes")
+	}
+	guids := map[string]int{}
+	for i, item := range ch.Entries {
+		itemPath := fmt.Sprintf("%s/item[%d]", p, i+1)
+		v.validateItem(itemPath, item)
+		guid := item.GUID.Value
+		if guid == "" {
+			continue
+		}
+		if first, ok := guids[guid]; ok {
+			v.errorf(itemPath+"/guid", "duplicates GUID of item[%d]: %s", first, guid)
+			continue
+		}
+		guids[guid] = i + 1
+	}
+}
+
+func (v *validator) validateImage(img rssImage) {
+	p := "channel/image"
+	if img.URL == "" && img.Title == "" && img.Link == "" {
+		return
+	}
+	if img.URL == "" {
+		v.errorf(p+"/url", "required element is missing")
+	}
+	if img.Title == "" {
+		v.errorf(p+"/title", "required element is missing")
+	}
+	if img.Link == "" {
+		v.errorf(p+"/link", "required element is missing")
+	}
+	if img.Width > rssImageMaxWidth {
+		v.warnf(p+"/width", "%d exceeds RSS 2.0 maximum of %d", img.Width, rssImageMaxWidth)
+	}
+	if img.Height > rssImageMaxHeight {
+		v.warnf(p+"/height", "%d exceeds RSS 2.0 maximum of %d", img.Height, rssImageMaxHeight)
+	}
+}
+
+func (v *validator) validateItunes(ch rssChannel) {
+	p := "channel"
+	if ch.ItunesImage == nil || ch.ItunesImage.Href == "" {
+		v.errorf(p+"/itunes:image", "required by Apple Podcasts")
+	} else {
+		v.validateArtwork(p+"/itunes:image", ch.ItunesImage.Href)
+	}
+	if ch.ItunesCategory == nil || ch.ItunesCategory.Text == "" {
+		v.errorf(p+"/itunes:category", "required by Apple Podcasts")
+	} else if !itunesCategories[ch.ItunesCategory.Text] {
+		v.warnf(p+"/itunes:category", "%q is not an Apple Podcasts category", ch.ItunesCategory.Text)
+	}
+	v.validateExplicit(p+"/itunes:explicit", ch.ItunesExplicit, true)
+	if ch.ItunesAuthor == "" {
+		v.warnf(p+"/itunes:author", "recommended by Apple Podcasts")
+	}
+	if ch.ItunesOwner == nil || ch.ItunesOwner.Email == "" {
+		v.warnf(p+"/itunes:owner", "owner email is recommended by Apple Podcasts")
+	}
+}
+
+func (v *validator) validateArtwork(p string, href string) {
+	ext := strings.ToLower(path.Ext(href))
+	if u, err := url.Parse(href); err == nil {
+		ext = strings.ToLower(path.Ext(u.Path))
+	}
+	if ext != ".jpg" && ext != ".jpeg" && ext != ".png" {
+		v.warnf(p, "artwork should be a JPEG or PNG file, got %q", href)
+	}
+	filename, ok := v.localFile(href)
+	if !ok {
+		return
+	}
+	f, err := os.Open(filename)
+	if err != nil {
+		v.warnf(p, "artwork is not found locally: %s", filename)
+		return
+	}
+	defer f.Close()
+	cfg, _, err := image.DecodeConfig(f)
+	if err != nil {
+		v.errorf(p, "can't decode artwork %s: %s", filename, err)
+		return
+	}
+	if cfg.Width != cfg.Height {
+		v.errorf(p, "artwork must be square, got %dx%d", cfg.Width, cfg.Height)
+	}
+	if cfg.Width < itunesImageMinSize || cfg.Width > itunesImageMaxSize {
+		v.errorf(p, "artwork must be from %d to %d pixels, got %dx%d",
+			itunesImageMinSize, itunesImageMaxSize, cfg.Width, cfg.Height)
+	}
+}
+
+func (v *validator) validateExplicit(p string, value string, required bool) {
+	switch value {
+	case "true", "false":
+	case "yes", "no", "clean":
+		v.warnf(p, "%q is deprecated, use \"true\" or \"false\"", value)
+	case "":
+		if required {
+			v.errorf(p, "required by Apple Podcasts")
+		}
+	default:
+		v.errorf(p, "%q is not a valid value", value)
+	}
+}
+
+func (v *validator) validateItem(p string, item rssItem) {
+	if strings.TrimSpace(item.Title) == "" {
+		if strings.TrimSpace(item.Description) == "" {
+			v.errorf(p, "either title or description is required")
+		} else {
+			v.errorf(p+"/title", "required by Apple Podcasts")
+		}
+	}
+	if item.GUID.Value == "" {
+		v.warnf(p+"/guid", "recommended to keep episodes from duplicating")
+	}
+	if err := item.PubDate.Err(); err != nil {
+		v.errorf(p+"/pubDate", "%s", err)
+	} else if item.PubDate.IsZero() {
+		v.errorf(p+"/pubDate", "required element is missing")
+	} else if item.PubDate.After(v.opts.Now) {
+		v.warnf(p+"/pubDate", "date %v is in the future", item.PubDate.Time)
+	}
+	if item.ItunesDuration.Duration <= 0 {
+		v.warnf(p+"/itunes:duration", "recommended by Apple Podcasts")
+	}
+	v.validateExplicit(p+"/itunes:explicit", item.ItunesExplicit, false)
+	v.validateEnclosure(p+"/enclosure", item.Enclosure)
+}
+
+func (v *validator) validateEnclosure(p string, enc rssEnclosure) {
+	if enc.URL == "" {
+		v.errorf(p, "url is required")
+		return
+	}
+	if u, err := url.Parse(enc.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		v.errorf(p, "url must be an absolute http(s) URL: %s", enc.URL)
+	}
+	if enc.Type == "" {
+		v.errorf(p, "type is required")
+	} else if !itunesEnclosureTypes[enc.Type] {
+		v.errorf(p, "type %q is not supported by Apple Podcasts", enc.Type)
+	}
+	if enc.Length <= 0 {
+		v.errorf(p, "length must be a positive number of bytes")
+	}
+	filename, ok := v.localFile(enc.URL)
+	if !ok {
+		return
+	}
+	fi, err := os.Stat(filename)
+	if err != nil {
+		v.warnf(p, "file is not found locally: %s", filename)
+		return
+	}
+	if fi.Size() != enc.Length {
+		v.errorf(p, "length %d does not match size %d of %s", enc.Length, fi.Size(), filename)
+	}
+}
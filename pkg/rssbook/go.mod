@@ -0,0 +1,3 @@
+module histrio/rssbook/pkg/rssbook
+
+go 1.17
@@ -0,0 +1,84 @@
+package rssbook
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"strings"
+
+	"github.com/histrio/rssbook/pkg/audio"
+	"github.com/histrio/rssbook/pkg/loggers"
+	"github.com/histrio/rssbook/pkg/manifest"
+	"github.com/histrio/rssbook/pkg/progress"
+	"github.com/histrio/rssbook/pkg/publish"
+	"github.com/histrio/rssbook/pkg/utils"
+)
+
+// bookKey returns the cache key of a whole book measurement: a checksum of
+// checksums of its files in order
+func bookKey(sums []string) string {
+	sum := md5.Sum([]byte(strings.Join(sums, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+// loudness measures source files or the whole book for normalization.
+// Measurements cached in the manifest of an updated book are reused, the
+// used ones are returned to be cached again.
+func (b *Builder) loudness(ctx context.Context, p audio.Pipeline, dest string, files []utils.FileName) (*audio.Loudnorm, map[string]utils.Loudness, error) {
+	cached := map[string]utils.Loudness{}
+	if b.Update {
+		if m, err := manifest.Read(dest); err == nil && m.Loudness != nil {
+			cached = m.Loudness
+		}
+	}
+	sums := make([]string, len(files))
+	for i, f := range files {
+		if err := ctx.Err(); err != nil {
+			return nil, nil, err
+		}
+		sum, err := publish.Checksum(string(f))
+		if err != nil {
+			return nil, nil, err
+		}
+		sums[i] = sum
+	}
+
+	used := map[string]utils.Loudness{}
+	measure := func(key string, log *loggers.Logger, item string, files ...utils.FileName) (utils.Loudness, bool) {
+		defer p.Progress.Step(progress.Loudness, item, 0)
+		if m, ok := cached[key]; ok {
+			log.Debug("Loudness is cached", "lufs", m.Integrated)
+			used[key] = m
+			return m, true
+		}
+		m, err := p.MeasureLoudness(files...)
+		if err != nil {
+			log.Warning("Loudness is not measured, the audio is left as it is", "err", err)
+			return m, false
+		}
+		log.Debug("Loudness measured", "lufs", m.Integrated, "peak", m.TruePeak)
+		used[key] = m
+		return m, true
+	}
+
+	l := &audio.Loudnorm{Target: b.Loudness.OrDefault(), Measured: map[utils.FileName]utils.Loudness{}}
+	if b.Loudnorm == audio.LoudnormBook {
+		p.Progress.SetTotal(progress.Loudness, 1)
+		if m, ok := measure(bookKey(sums), p.Log, "book", files...); ok {
+			for _, f := range files {
+				l.Measured[f] = m
+			}
+		}
+		return l, used, nil
+	}
+	p.Progress.SetTotal(progress.Loudness, len(files))
+	for i, f := range files {
+		if err := ctx.Err(); err != nil {
+			return nil, nil, err
+		}
+		if m, ok := measure(sums[i], p.Log.With("file", string(f)), string(f), f); ok {
+			l.Measured[f] = m
+		}
+	}
+	return l, used, nil
+}
@@ -0,0 +1,89 @@
+package rssbook
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/histrio/rssbook/pkg/manifest"
+	"github.com/histrio/rssbook/pkg/playlist"
+	"github.com/histrio/rssbook/pkg/rss"
+	"github.com/histrio/rssbook/pkg/utils"
+)
+
+func writeFile(name string, write func(f *os.File) error) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// WriteFeed writes the feed of the book into the directory and returns its
+// path. With update the book is merged into an existing feed, so hand-edited
+// fields and publication dates survive a rebuild.
+func WriteFeed(book utils.BookMeta, dir string, update bool, opts ...rss.Option) (string, error) {
+	name := filepath.Join(dir, book.ID+".xml")
+	feed := rss.Generate(book, opts...)
+	if update {
+		existing, err := rss.ParseFile(name)
+		if err == nil {
+			feed = rss.Merge(existing, feed)
+		} else if !os.IsNotExist(err) {
+			return "", err
+		}
+	}
+	content, err := rss.RenderXML(feed)
+	if err != nil {
+		return "", err
+	}
+	return name, writeFile(name, func(f *os.File) error {
+		_, err := f.WriteString(content)
+		return err
+	})
+}
+
+// WritePlaylist writes a playlist of the book in the format into the
+// directory and returns its path
+func WritePlaylist(book utils.BookMeta, dir string, format string, absolute bool) (string, error) {
+	write, ok := playlist.Formats[format]
+	if !ok {
+		return "", fmt.Errorf("unknown playlist format %q", format)
+	}
+	name := filepath.Join(dir, book.ID+"."+format)
+	return name, writeFile(name, func(f *os.File) error {
+		return write(f, playlist.FromBook(book, absolute))
+	})
+}
+
+// WritePlaylists writes playlists of the book in the formats into the
+// directory and returns their paths
+func WritePlaylists(book utils.BookMeta, dir string, formats []string, absolute bool) ([]string, error) {
+	result := []string{}
+	for _, format := range formats {
+		name, err := WritePlaylist(book, dir, format, absolute)
+		if err != nil {
+			return result, err
+		}
+		result = append(result, name)
+	}
+	return result, nil
+}
+
+// Created returns the creation date of a book built into the directory
+// before, so its episodes keep their GUIDs
+func Created(dir string, bookID string) (time.Time, bool) {
+	if m, err := manifest.Read(dir); err == nil && !m.Book.Created.IsZero() {
+		return m.Book.Created, true
+	}
+	existing, err := rss.ParseFile(filepath.Join(dir, bookID+".xml"))
+	if err != nil || len(existing.Channel.Entries) == 0 {
+		return time.Time{}, false
+	}
+	return utils.GetIDDate(existing.Channel.Entries[0].GUID.Value)
+}
@@ -0,0 +1,83 @@
+package rssbook
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/histrio/rssbook/pkg/rss"
+	"github.com/histrio/rssbook/pkg/utils"
+)
+
+func TestWriteFeed(t *testing.T) {
+	dir := t.TempDir()
+	book := utils.BookMeta{ID: "test", Title: "Generated", Created: time.Now()}
+	book.Episodes = append(book.Episodes, utils.BookEpisode{Pos: 1, Name: "Episode 001"})
+	name, err := WriteFeed(book, dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != filepath.Join(dir, "test.xml") {
+		t.Errorf("WriteFeed() = %s", name)
+	}
+
+	feed, err := rss.ParseFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	feed.Channel.Title = "Edited"
+	edited, err := rss.RenderXML(feed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(name, []byte(edited), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	book.Episodes = append(book.Episodes, utils.BookEpisode{Pos: 2, Name: "Episode 002"})
+	if _, err := WriteFeed(book, dir, true, rss.Location(time.FixedZone("MSK", 3*60*60))); err != nil {
+		t.Fatal(err)
+	}
+	feed, err = rss.ParseFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if feed.Channel.Title != "Edited" || len(feed.Channel.Entries) != 2 {
+		t.Errorf("updated feed %q has %d items", feed.Channel.Title, len(feed.Channel.Entries))
+	}
+	for _, item := range feed.Channel.Entries {
+		if _, offset := item.PubDate.Zone(); offset != 3*60*60 {
+			t.Errorf("pubDate %v is not in the feed time zone", item.PubDate.Time)
+		}
+	}
+}
+
+func TestWritePlaylists(t *testing.T) {
+	dir := t.TempDir()
+	book := utils.BookMeta{ID: "test", Title: "Title", Author: "Author"}
+	book.Episodes = append(book.Episodes, utils.BookEpisode{
+		Pos: 1, Name: "Episode 001", File: "episode-001.mp3",
+		Href: "http://example.com/test/episode-001.mp3", Duration: 90 * time.Second,
+	})
+	names, err := WritePlaylists(book, dir, []string{"m3u", "pls", "xspf"}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{filepath.Join(dir, "test.m3u"), filepath.Join(dir, "test.pls"), filepath.Join(dir, "test.xspf")}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("WritePlaylists() = %v, want %v", names, want)
+	}
+	data, err := os.ReadFile(names[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m3u := "#EXTM3U\n#PLAYLIST:Title\n#EXTART:Author\n#EXTIMG:" + book.ImageURL() + "\n\n" +
+		"#EXTINF:90,Author - Episode 001\nepisode-001.mp3\n"; string(data) != m3u {
+		t.Errorf("m3u playlist:\n%s", data)
+	}
+	if _, err := WritePlaylist(book, dir, "wpl", false); err == nil {
+		t.Error("unknown format written")
+	}
+}
@@ -0,0 +1,550 @@
+// Package rssbook converts a folder of audio files into a book: episodes of
+// even length, a podcast feed, playlists and a manifest
+package rssbook
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gosimple/slug"
+	"github.com/histrio/rssbook/pkg/archive"
+	"github.com/histrio/rssbook/pkg/audio"
+	"github.com/histrio/rssbook/pkg/loggers"
+	"github.com/histrio/rssbook/pkg/manifest"
+	"github.com/histrio/rssbook/pkg/order"
+	"github.com/histrio/rssbook/pkg/playlist"
+	"github.com/histrio/rssbook/pkg/progress"
+	"github.com/histrio/rssbook/pkg/publish"
+	"github.com/histrio/rssbook/pkg/rss"
+	"github.com/histrio/rssbook/pkg/schedule"
+	"github.com/histrio/rssbook/pkg/series"
+	"github.com/histrio/rssbook/pkg/utils"
+)
+
+// DefaultEpisodeMinutes is the length of episodes audio is split into
+const DefaultEpisodeMinutes = 8
+
+// Hooks are called at stages of a build. An error returned by a hook stops
+// the build.
+type Hooks struct {
+	// Metadata is called before audio is converted, it may change the title,
+	// author and series of the book
+	Metadata func(book *utils.BookMeta) error
+	// Episode is called with each episode written into the book directory
+	Episode func(ep utils.BookEpisode, file string) error
+	// Feed is called with the written feed
+	Feed func(book utils.BookMeta, file string) error
+	// Playlist is called with each written playlist
+	Playlist func(book utils.BookMeta, file string) error
+}
+
+// Builder converts source folders into books. The zero value builds a book
+// with defaults taken from the source.
+type Builder struct {
+	// BookID names the book directory and feed, a slugified name of the
+	// source folder or archive if empty
+	BookID string
+	// Title and Author of the book, tags of source files if empty
+	Title  string
+	Author string
+	// SeriesIndex is a number of the book in its series, a tag of source
+	// files if zero
+	SeriesIndex int
+	// Schedule releases episodes gradually, see the schedule package
+	Schedule string
+	// Update merges episodes into an existing book keeping hand-edited
+	// fields and publication dates of its feed
+	Update bool
+	// Playlists are formats of written playlists, AbsolutePlaylists makes
+	// them use episode URLs instead of relative paths
+	Playlists         []string
+	AbsolutePlaylists bool
+	// EpisodeMinutes is the length of episodes, DefaultEpisodeMinutes if zero
+	EpisodeMinutes int
+	// Order of source files, order.Name if empty. An order file found in
+	// the source folder takes precedence, see order.FindList.
+	Order string
+	// Loudnorm normalizes loudness of episodes before they are encoded:
+	// audio.LoudnormFile measures every source file, audio.LoudnormBook the
+	// whole book. Off if empty. Measurements are cached in the manifest.
+	Loudnorm string
+	// Loudness is the target of normalization, zero fields take
+	// audio.DefaultTarget ones
+	Loudness audio.Target
+
+	// Exec runs ffmpeg and ffprobe, audio.System if nil
+	Exec     audio.Executor
+	Log      *loggers.Logger
+	Progress progress.Reporter
+	// Now is the clock of book creation and episode releases, utils.Now if
+	// nil
+	Now func() time.Time
+	// Location is the time zone of feed dates, UTC if nil
+	Location *time.Location
+	Hooks    Hooks
+}
+
+func (b *Builder) now() time.Time {
+	if b.Now != nil {
+		return b.Now()
+	}
+	return utils.Now()
+}
+
+// feedOptions returns options of the book feed
+func (b *Builder) feedOptions() []rss.Option {
+	opts := []rss.Option{rss.Clock(b.now)}
+	if b.Location != nil {
+		opts = append(opts, rss.Location(b.Location))
+	}
+	return opts
+}
+
+func (b *Builder) episodeMinutes() int {
+	if b.EpisodeMinutes > 0 {
+		return b.EpisodeMinutes
+	}
+	return DefaultEpisodeMinutes
+}
+
+// DefaultID returns the ID a book of the source gets without one given: the
+// slug of the folder or archive name
+func DefaultID(src string) string {
+	name := filepath.Base(src)
+	if archive.Supported(src) {
+		name = archive.Name(src)
+	}
+	return slug.Make(name)
+}
+
+// sources returns audio files of the source folder
+func sources(src string) ([]utils.FileName, error) {
+	files, err := utils.GetFiles(src)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("%s: no audio files found", src)
+	}
+	return files, nil
+}
+
+// order returns source files as an order file in the source folder lists
+// them, or in the order of the builder. Names and track tags ordering files
+// differently is warned about.
+func (b *Builder) order(log *loggers.Logger, src string, files []utils.FileName, tags map[utils.FileName]map[string]string) ([]utils.FileName, error) {
+	names := make([]string, len(files))
+	for i, f := range files {
+		names[i] = string(f)
+	}
+	list, err := order.FindList(src)
+	if err != nil {
+		return nil, err
+	}
+	if list != "" {
+		listed, err := order.ReadList(list)
+		if err != nil {
+			return nil, err
+		}
+		ordered, missing, unlisted := order.Apply(names, listed)
+		log.Info("Source files are ordered by the list", "list", list)
+		for _, name := range missing {
+			log.Warning("Listed file is not found", "list", list, "file", name)
+		}
+		for _, name := range unlisted {
+			log.Warning("File is not listed, it goes last", "list", list, "file", name)
+		}
+		return fileNames(ordered), nil
+	}
+
+	tracks := map[string]order.Track{}
+	for _, f := range files {
+		if track, ok := order.TrackFromTags(tags[f]); ok {
+			tracks[string(f)] = track
+		}
+	}
+	byTags := order.ByTracks(names, tracks)
+	used := order.Name
+	if b.Order == order.Tags {
+		used = order.Tags
+	}
+	if i := order.Mismatch(names, byTags); i >= 0 && len(tracks) > 0 {
+		log.Warning("File names and track tags order files differently", "position", i+1, "name", names[i], "tags", byTags[i], "used", used)
+	}
+	if used == order.Tags {
+		return fileNames(byTags), nil
+	}
+	return files, nil
+}
+
+func fileNames(names []string) []utils.FileName {
+	files := make([]utils.FileName, len(names))
+	for i, name := range names {
+		files[i] = utils.FileName(name)
+	}
+	return files
+}
+
+func channel(files []utils.FileName) chan utils.FileName {
+	c := make(chan utils.FileName)
+	go func() {
+		for _, f := range files {
+			c <- f
+		}
+		close(c)
+	}()
+	return c
+}
+
+// drain removes the rest of converted episodes
+func drain(episodes chan audio.Episode) {
+	for ep := range episodes {
+		if ep.Err == nil {
+			os.Remove(string(ep.File))
+		}
+	}
+}
+
+// estimate probes source files and sets expected totals of the pipeline
+// stages. The durations are returned for the splitter to reuse.
+func estimate(ctx context.Context, p audio.Pipeline, files []utils.FileName, minutes int) (map[utils.FileName]time.Duration, error) {
+	p.Progress.SetTotal(progress.Probe, len(files))
+	p.Progress.SetTotal(progress.Silences, len(files))
+	durations := make(map[utils.FileName]time.Duration, len(files))
+	total := time.Duration(0)
+	for _, f := range files {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		d, err := p.GetDuration(f)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f, err)
+		}
+		durations[f] = d
+		total += d
+		p.Progress.Step(progress.Probe, string(f), 0)
+	}
+	episodes := int(math.Ceil(total.Minutes() / float64(minutes)))
+	for _, stage := range []string{progress.Merge, progress.Encode, progress.Write} {
+		p.Progress.SetTotal(stage, episodes)
+	}
+	return durations, nil
+}
+
+func copyFile(src utils.FileName, dst string) error {
+	in, err := os.Open(string(src))
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// episodeFile is a converted episode waiting to be written
+type episodeFile struct {
+	ep   utils.BookEpisode
+	file utils.FileName
+}
+
+// writeEpisodes copies converted episodes into the book directory in order
+// and removes them. After a failure the rest are only removed, failed is
+// closed and the error is returned.
+func (b *Builder) writeEpisodes(p audio.Pipeline, dest string, issued chan episodeFile, failed chan struct{}) error {
+	var first error
+	for e := range issued {
+		if first == nil {
+			first = b.writeEpisode(p, dest, e)
+			if first != nil {
+				close(failed)
+			}
+		}
+		os.Remove(string(e.file))
+	}
+	return first
+}
+
+func (b *Builder) writeEpisode(p audio.Pipeline, dest string, e episodeFile) error {
+	name := filepath.Join(dest, e.ep.File)
+	if err := copyFile(e.file, name); err != nil {
+		return err
+	}
+	p.Log.Info("Issued", "episode", e.ep.File, "duration", e.ep.Duration, "size", e.ep.FileSize)
+	p.Progress.Step(progress.Write, e.ep.File, e.ep.FileSize)
+	if b.Hooks.Episode != nil {
+		return b.Hooks.Episode(e.ep, name)
+	}
+	return nil
+}
+
+// errStopped stops converting episodes after writing failed, the error of
+// writing is returned instead
+var errStopped = errors.New("writing episodes failed")
+
+// Build converts audio files of the source folder or archive into a book in a
+// directory named by its id in dst. Audio conversion already started when ctx
+// is done finishes in the background, its files are removed.
+func (b *Builder) Build(ctx context.Context, src string, dst string) (utils.BookMeta, error) {
+	var releases schedule.Schedule
+	var err error
+	if b.Schedule != "" {
+		if releases, err = schedule.Parse(b.Schedule); err != nil {
+			return utils.BookMeta{}, err
+		}
+	}
+	for _, format := range b.Playlists {
+		if _, ok := playlist.Formats[format]; !ok {
+			return utils.BookMeta{}, fmt.Errorf("unknown playlist format %q, use one of %s", format, strings.Join(playlist.FormatNames(), ", "))
+		}
+	}
+	if b.Order != "" && b.Order != order.Name && b.Order != order.Tags {
+		return utils.BookMeta{}, fmt.Errorf("unknown order %q, use one of %s", b.Order, strings.Join(order.Names(), ", "))
+	}
+	if b.Loudnorm != "" && b.Loudnorm != audio.LoudnormFile && b.Loudnorm != audio.LoudnormBook {
+		return utils.BookMeta{}, fmt.Errorf("unknown loudness normalization %q, use one of %s", b.Loudnorm, strings.Join(audio.LoudnormModes(), ", "))
+	}
+	if err := b.Loudness.OrDefault().Check(); err != nil {
+		return utils.BookMeta{}, err
+	}
+	bookID := b.BookID
+	if bookID == "" {
+		bookID = DefaultID(src)
+		b.Log.Warning("No book-id specified, the source name is used", "book", bookID)
+	}
+	if err := utils.CheckBookID(bookID); err != nil {
+		return utils.BookMeta{}, err
+	}
+	// Extracted files are removed once the pipeline stops using them
+	cleanup := func() error { return nil }
+	defer func() { cleanup() }()
+	if archive.Supported(src) {
+		extracted, err := archive.Extract(src)
+		if err != nil {
+			return utils.BookMeta{}, err
+		}
+		cleanup = extracted.Close
+		src = extracted.Dir
+	}
+	files, err := sources(src)
+	if err != nil {
+		return utils.BookMeta{}, err
+	}
+
+	log := b.Log.With("book", bookID)
+	pipeline := audio.Pipeline{Exec: b.Exec, Log: log}
+
+	tags := make(map[utils.FileName]map[string]string, len(files))
+	for _, f := range files {
+		if tags[f], err = pipeline.GetTags(f); err != nil {
+			return utils.BookMeta{}, fmt.Errorf("%s: %w", f, err)
+		}
+	}
+	if files, err = b.order(log, src, files, tags); err != nil {
+		return utils.BookMeta{}, err
+	}
+	all := make([]audio.Metadata, 0, len(files))
+	for _, f := range files {
+		all = append(all, audio.MetadataFromTags(tags[f]))
+	}
+	meta := audio.MergeMetadata(all)
+
+	dest := filepath.Join(dst, bookID)
+	_, err = os.Stat(dest)
+	created := os.IsNotExist(err)
+	if b.Update {
+		err = os.MkdirAll(dest, 0777)
+	} else {
+		err = os.Mkdir(dest, 0777)
+	}
+	if err != nil {
+		return utils.BookMeta{}, err
+	}
+	// A folder of a failed build is removed, so the build can be retried
+	built := false
+	defer func() {
+		if created && !built {
+			os.RemoveAll(dest)
+		}
+	}()
+
+	title, author := b.Title, b.Author
+	if author == "" {
+		author = meta.Artist
+		if author == "" {
+			author = meta.AlbumArtist
+		}
+		log.Warning("No book author specified, the artist of source files is used", "author", author)
+	}
+	if title == "" {
+		title = meta.Album
+		if title == "" {
+			title = meta.Title
+		}
+		log.Warning("No book title specified, the album of source files is used", "title", title)
+	}
+	seriesName, seriesIndex := series.FromTags(meta.Tags)
+	if b.SeriesIndex > 0 {
+		seriesIndex = b.SeriesIndex
+	}
+
+	book := utils.BookMeta{
+		ID:          bookID,
+		Title:       title,
+		Author:      author,
+		Series:      seriesName,
+		SeriesIndex: seriesIndex,
+		Narrator:    meta.Narrator,
+		Genre:       meta.Genre,
+		Date:        meta.Date,
+		Description: meta.Comment,
+		Language:    meta.Language,
+		Created:     b.now(),
+	}
+	if b.Update {
+		if created, ok := Created(dest, bookID); ok {
+			book.Created = created
+		}
+	}
+	if b.Hooks.Metadata != nil {
+		if err := b.Hooks.Metadata(&book); err != nil {
+			return book, err
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return book, err
+	}
+
+	if b.Progress != nil {
+		pipeline.Progress = progress.NewTracker(b.Progress)
+		if pipeline.Durations, err = estimate(ctx, pipeline, files, b.episodeMinutes()); err != nil {
+			return book, err
+		}
+	}
+	var loudness map[string]utils.Loudness
+	if b.Loudnorm != "" {
+		if pipeline.Loudnorm, loudness, err = b.loudness(ctx, pipeline, dest, files); err != nil {
+			return book, err
+		}
+		if err := ctx.Err(); err != nil {
+			return book, err
+		}
+	}
+
+	splitted := pipeline.GetSplittedEpisodes(channel(files), b.episodeMinutes())
+	episodes := pipeline.GetCompressedEpisodes(pipeline.GetMergedEpisodes(splitted))
+
+	issued := make(chan episodeFile)
+	failed := make(chan struct{})
+	written := make(chan error, 1)
+	go func() {
+		written <- b.writeEpisodes(pipeline, dest, issued, failed)
+	}()
+
+	checksums := map[string]string{}
+	for converted := range episodes {
+		epFile := converted.File
+		err = converted.Err
+		if err == nil {
+			select {
+			case <-ctx.Done():
+				err = ctx.Err()
+			case <-failed:
+				err = errStopped
+			default:
+			}
+		}
+		pos := len(book.Episodes) + 1
+		outFile := fmt.Sprintf("episode-%03d.mp3", pos)
+		if err == nil {
+			checksums[outFile], err = publish.Checksum(string(epFile))
+		}
+		var duration time.Duration
+		if err == nil {
+			duration, err = pipeline.GetDuration(epFile)
+		}
+		var size int64
+		if err == nil {
+			size, err = utils.GetFileSize(epFile)
+		}
+		if err != nil {
+			os.Remove(string(epFile))
+			go func(cleanup func() error) {
+				drain(episodes)
+				cleanup()
+			}(cleanup)
+			cleanup = func() error { return nil }
+			break
+		}
+
+		ep := utils.BookEpisode{
+			Pos:      pos,
+			Name:     fmt.Sprintf("Episode %03d", pos),
+			File:     outFile,
+			FileSize: size,
+			Href:     utils.S3Url + book.ID + "/" + outFile,
+			Duration: duration,
+		}
+		book.Episodes = append(book.Episodes, ep)
+		issued <- episodeFile{ep: ep, file: epFile}
+	}
+	close(issued)
+	if werr := <-written; werr != nil {
+		err = werr
+	}
+	if err != nil {
+		return book, err
+	}
+
+	if b.Schedule != "" {
+		for i, date := range releases.Dates(len(book.Episodes)) {
+			book.Episodes[i].PubDate = date
+		}
+	}
+	err = manifest.Manifest{Book: book, Schedule: b.Schedule, Files: checksums, Loudness: loudness}.Write(dest)
+	if err != nil {
+		return book, err
+	}
+
+	released := book.ReleasedBy(b.now())
+	feed, err := WriteFeed(released, dest, b.Update, b.feedOptions()...)
+	if err != nil {
+		return book, err
+	}
+	if b.Hooks.Feed != nil {
+		if err := b.Hooks.Feed(released, feed); err != nil {
+			return book, err
+		}
+	}
+	for _, format := range b.Playlists {
+		name, err := WritePlaylist(released, dest, format, b.AbsolutePlaylists)
+		if err != nil {
+			return book, err
+		}
+		if b.Hooks.Playlist != nil {
+			if err := b.Hooks.Playlist(released, name); err != nil {
+				return book, err
+			}
+		}
+	}
+	pipeline.Progress.Finish()
+	built = true
+	return book, nil
+}
@@ -0,0 +1,540 @@
+package rssbook
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/histrio/rssbook/pkg/audio"
+	"github.com/histrio/rssbook/pkg/audio/audiotest"
+	"github.com/histrio/rssbook/pkg/loggers"
+	"github.com/histrio/rssbook/pkg/manifest"
+	"github.com/histrio/rssbook/pkg/order"
+	"github.com/histrio/rssbook/pkg/progress"
+	"github.com/histrio/rssbook/pkg/publish"
+	"github.com/histrio/rssbook/pkg/rss"
+	"github.com/histrio/rssbook/pkg/utils"
+)
+
+// fakeExec answers ffprobe as if every file lasted five minutes and ffmpeg
+// as if it succeeded without silences found
+var fakeExec = audio.ExecFunc(func(name string, arg ...string) (string, error) {
+	args := strings.Join(arg, " ")
+	switch {
+	case name == "ffprobe" && strings.Contains(args, "format=duration"):
+		return "format,300.000000\n", nil
+	case name == "ffprobe" && strings.Contains(args, "format_tags"):
+		return `{"format": {"tags": {"title": "Tagged title", "artist": "Tagged author"}}}`, nil
+	}
+	return "", nil
+})
+
+// failingExec answers as fakeExec but fails calls of the command with the
+// argument
+func failingExec(name, arg string, err error) audio.ExecFunc {
+	return func(n string, args ...string) (string, error) {
+		if n == name && strings.Contains(strings.Join(args, " "), arg) {
+			return "", err
+		}
+		return fakeExec(n, args...)
+	}
+}
+
+// testSource returns a source folder with two audio files
+func testSource(t *testing.T) string {
+	src := filepath.Join(t.TempDir(), "Test Book")
+	if err := os.Mkdir(src, 0777); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"01.mp3", "02.mp3"} {
+		if err := os.WriteFile(filepath.Join(src, name), []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return src
+}
+
+func TestBuild(t *testing.T) {
+	src, dst := testSource(t), t.TempDir()
+	created := time.Date(2026, 10, 1, 7, 0, 0, 0, time.UTC)
+	written := []string{}
+	b := Builder{
+		Author:    "Author",
+		Playlists: []string{"m3u", "pls"},
+		Exec:      fakeExec,
+		Now:       func() time.Time { return created },
+		Hooks: Hooks{
+			Metadata: func(book *utils.BookMeta) error {
+				book.Title = strings.ToUpper(book.Title)
+				return nil
+			},
+			Episode: func(ep utils.BookEpisode, file string) error {
+				written = append(written, filepath.Base(file))
+				return nil
+			},
+			Feed: func(book utils.BookMeta, file string) error {
+				written = append(written, filepath.Base(file))
+				return nil
+			},
+			Playlist: func(book utils.BookMeta, file string) error {
+				written = append(written, filepath.Base(file))
+				return nil
+			},
+		},
+	}
+	book, err := b.Build(context.Background(), src, dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if book.ID != "test-book" || book.Title != "TAGGED TITLE" || book.Author != "Author" || !book.Created.Equal(created) {
+		t.Errorf("book = %+v", book)
+	}
+	// Ten minutes are split into eight and two minutes episodes
+	if len(book.Episodes) != 2 || book.Episodes[1].File != "episode-002.mp3" {
+		t.Fatalf("episodes = %+v", book.Episodes)
+	}
+	want := "episode-001.mp3 episode-002.mp3 test-book.xml test-book.m3u test-book.pls"
+	if got := strings.Join(written, " "); got != want {
+		t.Errorf("written %s, want %s", got, want)
+	}
+	m, err := manifest.Read(filepath.Join(dst, "test-book"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Book.Title != book.Title || len(m.Files) != 2 {
+		t.Errorf("manifest = %+v", m)
+	}
+	feed, err := rss.ParseFile(filepath.Join(dst, "test-book", "test-book.xml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !feed.Channel.LastBuildDate.Equal(created) {
+		t.Errorf("lastBuildDate = %v, want the builder clock", feed.Channel.LastBuildDate.Time)
+	}
+
+	// Books are not overwritten unless updated
+	if _, err := b.Build(context.Background(), src, dst); err == nil {
+		t.Error("existing book overwritten")
+	}
+	b.Update = true
+	b.Now = time.Now
+	book, err = b.Build(context.Background(), src, dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !book.Created.Equal(created) {
+		t.Errorf("updated book created %v, want %v", book.Created, created)
+	}
+}
+
+func TestBuildErrors(t *testing.T) {
+	failed := errors.New("upload failed")
+	broken := errors.New("exit status 1")
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	tests := []struct {
+		name string
+		ctx  context.Context
+		b    Builder
+		want error
+	}{
+		{"cancelled", cancelled, Builder{Exec: fakeExec}, context.Canceled},
+		{"hook", context.Background(), Builder{Exec: fakeExec, Hooks: Hooks{
+			Episode: func(ep utils.BookEpisode, file string) error { return failed },
+		}}, failed},
+		{"tags", context.Background(), Builder{Exec: failingExec("ffprobe", "format_tags", broken)}, broken},
+		{"silences", context.Background(), Builder{Exec: failingExec("ffmpeg", "silencedetect", broken)}, broken},
+		{"cut", context.Background(), Builder{Exec: failingExec("ffmpeg", "-write_xing", broken)}, broken},
+		{"merge", context.Background(), Builder{Exec: failingExec("ffmpeg", "concat", broken)}, broken},
+		{"encoding", context.Background(), Builder{Exec: failingExec("ffmpeg", "libmp3lame", broken)}, broken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dst := t.TempDir()
+			book, err := tt.b.Build(tt.ctx, testSource(t), dst)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("Build() error = %v, want %v", err, tt.want)
+			}
+			if _, err := manifest.Read(filepath.Join(dst, book.ID)); err == nil {
+				t.Error("manifest of a failed build written")
+			}
+			if _, err := os.Stat(filepath.Join(dst, book.ID, book.ID+".xml")); err == nil {
+				t.Error("feed of a failed build written")
+			}
+			// The build can be retried without update
+			if _, err := os.Stat(filepath.Join(dst, "test-book")); !os.IsNotExist(err) {
+				t.Errorf("folder of a failed build left: %v", err)
+			}
+		})
+	}
+
+	// A folder there before the build is kept
+	dst := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dst, "test-book"), 0777); err != nil {
+		t.Fatal(err)
+	}
+	b := Builder{Update: true, Exec: failingExec("ffmpeg", "libmp3lame", broken)}
+	if _, err := b.Build(context.Background(), testSource(t), dst); !errors.Is(err, broken) {
+		t.Fatalf("Build() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "test-book")); err != nil {
+		t.Errorf("existing folder removed: %v", err)
+	}
+
+	for _, b := range []Builder{{Schedule: "sometimes"}, {Playlists: []string{"wpl"}}, {Loudnorm: "episode"}, {Loudness: audio.Target{Integrated: -3}}} {
+		if _, err := b.Build(context.Background(), testSource(t), t.TempDir()); err == nil {
+			t.Errorf("Build(%+v) succeeded", b)
+		}
+	}
+	if _, err := (&Builder{}).Build(context.Background(), t.TempDir(), t.TempDir()); err == nil {
+		t.Error("folder without audio built")
+	}
+	if _, err := (&Builder{}).Build(context.Background(), filepath.Join(t.TempDir(), "missing"), t.TempDir()); err == nil {
+		t.Error("missing folder built")
+	}
+	library := filepath.Join(t.TempDir(), "library")
+	for _, id := range []string{"../escape", "..", ".", "-rf", `a\b`} {
+		b := Builder{BookID: id, Update: true, Author: "Author", Exec: fakeExec}
+		if _, err := b.Build(context.Background(), testSource(t), library); err == nil {
+			t.Errorf("book ID %q accepted", id)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(library, "..", "escape")); !os.IsNotExist(err) {
+		t.Errorf("book written out of the library: %v", err)
+	}
+}
+
+func TestBuildCancelledProbing(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	probed := 0
+	exec := audio.ExecFunc(func(name string, arg ...string) (string, error) {
+		if name == "ffprobe" && strings.Contains(strings.Join(arg, " "), "format=duration") {
+			probed++
+			cancel()
+		}
+		return fakeExec(name, arg...)
+	})
+	b := Builder{Author: "Author", Exec: exec, Progress: progress.JSON(io.Discard)}
+	if _, err := b.Build(ctx, testSource(t), t.TempDir()); err != context.Canceled {
+		t.Errorf("Build() error = %v, want %v", err, context.Canceled)
+	}
+	if probed != 1 {
+		t.Errorf("%d files probed after cancel", probed)
+	}
+}
+
+func TestBuildCancelledLoudness(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	measured := 0
+	exec := audio.ExecFunc(func(name string, arg ...string) (string, error) {
+		if strings.Contains(strings.Join(arg, " "), "print_format=json") {
+			measured++
+			cancel()
+			return `{"input_i": "-27.61", "input_tp": "-4.47", "input_lra": "18.06", "input_thresh": "-39.20"}`, nil
+		}
+		return fakeExec(name, arg...)
+	})
+	b := Builder{Author: "Author", Loudnorm: audio.LoudnormFile, Exec: exec}
+	if _, err := b.Build(ctx, testSource(t), t.TempDir()); err != context.Canceled {
+		t.Errorf("Build() error = %v, want %v", err, context.Canceled)
+	}
+	if measured != 1 {
+		t.Errorf("%d files measured after cancel", measured)
+	}
+}
+
+func TestBuildUnreadableSource(t *testing.T) {
+	if os.Geteuid() == 0 {
+		t.Skip("root reads any folder")
+	}
+	src := testSource(t)
+	disc := filepath.Join(src, "Disc 2")
+	if err := os.Mkdir(disc, 0); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chmod(disc, 0777)
+	if _, err := (&Builder{Exec: fakeExec}).Build(context.Background(), src, t.TempDir()); !os.IsPermission(err) {
+		t.Errorf("Build() error = %v, want a permission error", err)
+	}
+}
+
+func TestBuildProbesOnce(t *testing.T) {
+	src := testSource(t)
+	probed := map[string]int{}
+	exec := audio.ExecFunc(func(name string, arg ...string) (string, error) {
+		if name == "ffprobe" && strings.Contains(strings.Join(arg, " "), "format=duration") {
+			probed[arg[1]]++
+		}
+		return fakeExec(name, arg...)
+	})
+	// Durations estimated for progress are reused by the splitter
+	var events bytes.Buffer
+	b := Builder{Author: "Author", Exec: exec, Progress: progress.JSON(&events)}
+	if _, err := b.Build(context.Background(), src, t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"01.mp3", "02.mp3"} {
+		if n := probed[filepath.Join(src, name)]; n != 1 {
+			t.Errorf("%s probed %d times", name, n)
+		}
+	}
+	if events.Len() == 0 {
+		t.Error("no progress reported")
+	}
+}
+
+func TestBuildHostileNames(t *testing.T) {
+	tmp := filepath.Join(t.TempDir(), "it's \"tmp\"\n\\ ёлка")
+	if err := os.Mkdir(tmp, 0777); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("TMPDIR", tmp)
+
+	src := filepath.Join(t.TempDir(), "Л. Толстой: it's \"War\"")
+	if err := os.Mkdir(src, 0777); err != nil {
+		t.Fatal(err)
+	}
+	names := []string{"01 it's.mp3", "02 Part 1: Intro.mp3", "03 line\nbreak.mp3"}
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(src, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b := Builder{
+		BookID:         "hostile",
+		EpisodeMinutes: 60,
+		Playlists:      []string{"m3u"},
+		Exec: audio.ExecFunc(func(name string, arg ...string) (string, error) {
+			if name == "ffmpeg" {
+				return audiotest.Text(name, arg...)
+			}
+			return fakeExec(name, arg...)
+		}),
+	}
+	dst := t.TempDir()
+	book, err := b.Build(context.Background(), src, dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(book.Episodes) != 1 {
+		t.Fatalf("episodes = %+v", book.Episodes)
+	}
+	data, err := os.ReadFile(filepath.Join(dst, "hostile", book.Episodes[0].File))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := strings.Join(names, "\n") + "\n"; string(data) != want {
+		t.Errorf("episode = %q, want %q", data, want)
+	}
+}
+
+func TestBuildOrder(t *testing.T) {
+	// Tracks are tagged in reverse
+	names := []string{"Chapter 10.mp3", "Chapter 2.mp3", "Chapter 1.mp3"}
+	tracks := map[string]int{"Chapter 1.mp3": 3, "Chapter 2.mp3": 2, "Chapter 10.mp3": 1}
+	exec := audio.ExecFunc(func(name string, arg ...string) (string, error) {
+		if name == "ffmpeg" {
+			return audiotest.Text(name, arg...)
+		}
+		if strings.Contains(strings.Join(arg, " "), "format_tags") {
+			return fmt.Sprintf(`{"format": {"tags": {"track": "%d/3"}}}`, tracks[filepath.Base(arg[len(arg)-1])]), nil
+		}
+		return fakeExec(name, arg...)
+	})
+	tests := []struct {
+		name  string
+		order string
+		list  string
+		want  string
+	}{
+		{"names", "", "", "Chapter 1.mp3 Chapter 2.mp3 Chapter 10.mp3"},
+		{"tags", order.Tags, "", "Chapter 10.mp3 Chapter 2.mp3 Chapter 1.mp3"},
+		{"order file", order.Tags, "Chapter 2.mp3\nChapter 1.mp3\n", "Chapter 2.mp3 Chapter 1.mp3 Chapter 10.mp3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := filepath.Join(t.TempDir(), "book")
+			if err := os.Mkdir(src, 0777); err != nil {
+				t.Fatal(err)
+			}
+			for _, name := range names {
+				if err := os.WriteFile(filepath.Join(src, name), nil, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.list != "" {
+				if err := os.WriteFile(filepath.Join(src, "order.txt"), []byte(tt.list), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			var logs bytes.Buffer
+			log, err := loggers.Open(&logs, "text", "warning")
+			if err != nil {
+				t.Fatal(err)
+			}
+			dst := t.TempDir()
+			b := Builder{Author: "Author", EpisodeMinutes: 60, Order: tt.order, Exec: exec, Log: log}
+			book, err := b.Build(context.Background(), src, dst)
+			if err != nil {
+				t.Fatal(err)
+			}
+			data, err := os.ReadFile(filepath.Join(dst, "book", book.Episodes[0].File))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := strings.ReplaceAll(strings.TrimSuffix(string(data), "\n"), "\n", " "); got != tt.want {
+				t.Errorf("sources in order %q, want %q", got, tt.want)
+			}
+			warned := strings.Contains(logs.String(), "order files differently")
+			if warned != (tt.list == "") {
+				t.Errorf("order warning logged %v:\n%s", warned, logs.String())
+			}
+			if tt.list != "" && !strings.Contains(logs.String(), "Chapter 10.mp3") {
+				t.Errorf("unlisted file not warned about:\n%s", logs.String())
+			}
+		})
+	}
+	if _, err := (&Builder{Order: "random"}).Build(context.Background(), testSource(t), t.TempDir()); err == nil {
+		t.Error("unknown order accepted")
+	}
+}
+
+func TestBuildMetadataWarnings(t *testing.T) {
+	for _, b := range []Builder{{}, {Author: "Author", Title: "Title"}} {
+		var logs bytes.Buffer
+		log, err := loggers.Open(&logs, "text", "warning")
+		if err != nil {
+			t.Fatal(err)
+		}
+		b.BookID, b.Exec, b.Log = "book", fakeExec, log
+		book, err := b.Build(context.Background(), testSource(t), t.TempDir())
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Tags are only warned about when they are used
+		for _, warning := range []string{"No book author", "No book title"} {
+			if warned := strings.Contains(logs.String(), warning); warned != (b.Author == "") {
+				t.Errorf("%q logged %v for %q by %q:\n%s", warning, warned, book.Title, book.Author, logs.String())
+			}
+		}
+	}
+}
+
+func TestDefaultID(t *testing.T) {
+	for src, want := range map[string]string{
+		"/inbox/Test Book":        "test-book",
+		"/inbox/Saga, Vol. 1.zip": "saga-vol-1",
+		"/inbox/Saga.Tar.GZ":      "saga",
+		"/inbox/Notes.txt":        "notes-txt",
+		"/inbox/War and Peace.7z": "war-and-peace",
+	} {
+		if got := DefaultID(src); got != want {
+			t.Errorf("DefaultID(%q) = %q, want %q", src, got, want)
+		}
+	}
+}
+
+func TestBuildArchive(t *testing.T) {
+	tmp := t.TempDir()
+	t.Setenv("TMPDIR", tmp)
+	path := filepath.Join(t.TempDir(), "Saga, Vol. 1.zip")
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	z := zip.NewWriter(f)
+	for _, name := range []string{"Saga/02.mp3", "Saga/01.mp3", "Saga/cover.jpg"} {
+		w, err := z.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(name))
+	}
+	if err := z.Close(); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	book, err := (&Builder{Exec: fakeExec}).Build(context.Background(), path, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if book.ID != "saga-vol-1" || book.ID != DefaultID(path) || len(book.Episodes) != 2 {
+		t.Errorf("book = %+v", book)
+	}
+	if left, _ := filepath.Glob(filepath.Join(tmp, "rssbook_archive_*")); len(left) != 0 {
+		t.Errorf("extracted files left: %v", left)
+	}
+}
+
+func TestBuildLoudnorm(t *testing.T) {
+	src, dst := testSource(t), t.TempDir()
+	measured := []string{}
+	exec := audio.ExecFunc(func(name string, arg ...string) (string, error) {
+		if strings.Contains(strings.Join(arg, " "), "print_format=json") {
+			measured = append(measured, filepath.Base(arg[len(arg)-6]))
+			return `{"input_i": "-27.61", "input_tp": "-4.47", "input_lra": "18.06", "input_thresh": "-39.20"}`, nil
+		}
+		return fakeExec(name, arg...)
+	})
+	want := utils.Loudness{Integrated: -27.61, TruePeak: -4.47, Range: 18.06, Threshold: -39.2}
+	sum := func(name string) string {
+		sum, err := publish.Checksum(filepath.Join(src, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return sum
+	}
+
+	b := Builder{Author: "Author", Loudnorm: audio.LoudnormFile, Exec: exec}
+	book, err := b.Build(context.Background(), src, dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := manifest.Read(filepath.Join(dst, book.ID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(measured, " "); got != "01.mp3 02.mp3" {
+		t.Errorf("measured %s", got)
+	}
+	if len(m.Loudness) != 2 || m.Loudness[sum("01.mp3")] != want || m.Loudness[sum("02.mp3")] != want {
+		t.Errorf("cached loudness = %+v", m.Loudness)
+	}
+
+	// An update measures changed files only
+	if err := os.WriteFile(filepath.Join(src, "02.mp3"), []byte("re-recorded"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	measured = nil
+	b.Update = true
+	if _, err := b.Build(context.Background(), src, dst); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(measured, " "); got != "02.mp3" {
+		t.Errorf("measured %s on update", got)
+	}
+
+	// The whole book is measured once and cached by its files
+	measured = nil
+	b.Loudnorm = audio.LoudnormBook
+	if _, err := b.Build(context.Background(), src, dst); err != nil {
+		t.Fatal(err)
+	}
+	if m, err = manifest.Read(filepath.Join(dst, book.ID)); err != nil {
+		t.Fatal(err)
+	}
+	if len(measured) != 1 || len(m.Loudness) != 1 || m.Loudness[bookKey([]string{sum("01.mp3"), sum("02.mp3")})] != want {
+		t.Errorf("measured %q, cached loudness = %+v", measured, m.Loudness)
+	}
+}
@@ -0,0 +1,3 @@
+module histrio/rssbook/pkg/schedule
+
+go 1.17
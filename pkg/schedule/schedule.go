@@ -0,0 +1,168 @@
+package schedule
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule describes a drip release of episodes, e.g. one episode per weekday
+// at 07:00 Europe/Berlin starting 2026-11-01
+type Schedule struct {
+	Start    time.Time
+	Days     [7]bool
+	Hour     int
+	Minute   int
+	PerSlot  int
+	Location *time.Location
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "sunday": time.Sunday,
+	"mon": time.Monday, "monday": time.Monday,
+	"tue": time.Tuesday, "tuesday": time.Tuesday,
+	"wed": time.Wednesday, "wednesday": time.Wednesday,
+	"thu": time.Thursday, "thursday": time.Thursday,
+	"fri": time.Friday, "friday": time.Friday,
+	"sat": time.Saturday, "saturday": time.Saturday,
+}
+
+var numbers = map[string]int{
+	"one": 1, "two": 2, "three": 3, "four": 4, "five": 5,
+	"six": 6, "seven": 7, "eight": 8, "nine": 9, "ten": 10,
+}
+
+// fillers are words allowed to make a spec read like a sentence
+var fillers = map[string]bool{
+	"episode": true, "episodes": true, "per": true, "every": true, "each": true,
+	"at": true, "on": true, "from": true, "starting": true, "start": true,
+}
+
+func parseDays(token string) ([7]bool, bool) {
+	var days [7]bool
+	switch token {
+	case "daily", "day", "days":
+		for d := range days {
+			days[d] = true
+		}
+		return days, true
+	case "weekday", "weekdays":
+		for d := time.Monday; d <= time.Friday; d++ {
+			days[d] = true
+		}
+		return days, true
+	case "weekend", "weekends":
+		days[time.Saturday] = true
+		days[time.Sunday] = true
+		return days, true
+	}
+	for _, part := range strings.Split(token, ",") {
+		if bounds := strings.SplitN(part, "-", 2); len(bounds) == 2 {
+			from, ok1 := weekdays[bounds[0]]
+			to, ok2 := weekdays[bounds[1]]
+			if !ok1 || !ok2 {
+				return days, false
+			}
+			for d := from; d != to; d = (d + 1) % 7 {
+				days[d] = true
+			}
+			days[to] = true
+			continue
+		}
+		d, ok := weekdays[strings.TrimSuffix(part, "s")]
+		if !ok {
+			return days, false
+		}
+		days[d] = true
+	}
+	return days, true
+}
+
+// Parse reads a schedule spec. Tokens may go in any order: days ("daily",
+// "weekdays", "weekends", "mon,wed,fri", "mon-fri"), time ("07:00" or "7:00"),
+// time zone ("Europe/Berlin"), start date ("2026-11-01") and a number of
+// episodes per slot ("2" or "two"). Words like "episode", "per", "at",
+// "starting" are ignored, so "one episode per weekday at 07:00 Europe/Berlin
+// starting 2026-11-01" is a valid spec.
+func Parse(spec string) (Schedule, error) {
+	s := Schedule{PerSlot: 1, Location: time.UTC}
+	var date string
+	daysSet := false
+	for _, token := range strings.Fields(spec) {
+		lower := strings.ToLower(token)
+		if fillers[lower] {
+			continue
+		}
+		if n, ok := numbers[lower]; ok {
+			s.PerSlot = n
+			continue
+		}
+		if n, err := strconv.Atoi(strings.TrimPrefix(lower, "x")); err == nil {
+			if n < 1 {
+				return s, fmt.Errorf("schedule %q: number of episodes must be positive", spec)
+			}
+			s.PerSlot = n
+			continue
+		}
+		if t, err := time.Parse("15:04", token); err == nil {
+			s.Hour, s.Minute = t.Hour(), t.Minute()
+			continue
+		}
+		if _, err := time.Parse("2006-01-02", token); err == nil {
+			date = token
+			continue
+		}
+		if days, ok := parseDays(lower); ok {
+			for d := range days {
+				s.Days[d] = s.Days[d] || days[d]
+			}
+			daysSet = true
+			continue
+		}
+		if strings.Contains(token, "/") || token == "UTC" || token == "Local" {
+			loc, err := time.LoadLocation(token)
+			if err != nil {
+				return s, fmt.Errorf("schedule %q: %s", spec, err)
+			}
+			s.Location = loc
+			continue
+		}
+		return s, fmt.Errorf("schedule %q: unknown token %q", spec, token)
+	}
+	if date == "" {
+		return s, fmt.Errorf("schedule %q: start date is required", spec)
+	}
+	if !daysSet {
+		s.Days, _ = parseDays("daily")
+	}
+	start, err := time.ParseInLocation("2006-01-02", date, s.Location)
+	if err != nil {
+		return s, err
+	}
+	s.Start = start
+	return s, nil
+}
+
+// Dates returns publication dates for n episodes. Episodes sharing a slot are
+// a second apart to keep their order in podcast clients.
+func (s Schedule) Dates(n int) []time.Time {
+	dates := make([]time.Time, 0, n)
+	perSlot := s.PerSlot
+	if perSlot < 1 {
+		perSlot = 1
+	}
+	for day := 0; len(dates) < n; day++ {
+		slot := time.Date(s.Start.Year(), s.Start.Month(), s.Start.Day()+day, s.Hour, s.Minute, 0, 0, s.Location)
+		if !s.Days[slot.Weekday()] {
+			if day > 7 && len(dates) == 0 {
+				break
+			}
+			continue
+		}
+		for i := 0; i < perSlot && len(dates) < n; i++ {
+			dates = append(dates, slot.Add(time.Duration(i)*time.Second))
+		}
+	}
+	return dates
+}
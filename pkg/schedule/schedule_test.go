@@ -0,0 +1,97 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		spec    string
+		days    string
+		at      string
+		perSlot int
+		zone    string
+		wantErr bool
+	}{
+		{"one episode per weekday at 07:00 Europe/Berlin starting 2026-11-01", "MTWTF..", "07:00", 1, "Europe/Berlin", false},
+		{"daily 19:30 from 2026-11-01", "MTWTFSS", "19:30", 1, "UTC", false},
+		{"two episodes every mon,wed,fri at 08:15 UTC from 2026-11-01", "M.W.F..", "08:15", 2, "UTC", false},
+		{"fri-mon 06:00 x3 2026-11-01", "M...FSS", "06:00", 3, "UTC", false},
+		{"weekends 2026-11-01", ".....SS", "00:00", 1, "UTC", false},
+		{"daily at 7:00 2026-11-01", "MTWTFSS", "07:00", 1, "UTC", false},
+		{"daily at 7:5 2026-11-01", "", "", 0, "", true},
+		{"weekdays 07:00", "", "", 0, "", true},
+		{"fortnightly 2026-11-01", "", "", 0, "", true},
+		{"daily 2026-11-01 Mars/Olympus", "", "", 0, "", true},
+		{"0 daily 2026-11-01", "", "", 0, "", true},
+	}
+	order := []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday, time.Saturday, time.Sunday}
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			got, err := Parse(tt.spec)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			days := ""
+			for i, d := range order {
+				if got.Days[d] {
+					days += string("MTWTFSS"[i])
+				} else {
+					days += "."
+				}
+			}
+			if days != tt.days {
+				t.Errorf("Days = %s, want %s", days, tt.days)
+			}
+			if at := time.Date(0, 1, 1, got.Hour, got.Minute, 0, 0, time.UTC).Format("15:04"); at != tt.at {
+				t.Errorf("time = %s, want %s", at, tt.at)
+			}
+			if got.PerSlot != tt.perSlot {
+				t.Errorf("PerSlot = %d, want %d", got.PerSlot, tt.perSlot)
+			}
+			if got.Location.String() != tt.zone {
+				t.Errorf("Location = %s, want %s", got.Location, tt.zone)
+			}
+		})
+	}
+}
+
+func TestDates(t *testing.T) {
+	s, err := Parse("one episode per weekday at 07:00 Europe/Berlin starting 2026-10-23")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"2026-10-23 07:00:00 +0200", // Friday
+		"2026-10-26 07:00:00 +0100", // Monday, after DST ends
+		"2026-10-27 07:00:00 +0100",
+	}
+	got := s.Dates(len(want))
+	if len(got) != len(want) {
+		t.Fatalf("got %d dates, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if d := got[i].Format("2006-01-02 15:04:05 -0700"); d != want[i] {
+			t.Errorf("date[%d] = %s, want %s", i, d, want[i])
+		}
+	}
+}
+
+func TestDatesPerSlot(t *testing.T) {
+	s, err := Parse("2 daily 20:00 2026-11-01")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := s.Dates(3)
+	if got[1].Sub(got[0]) != time.Second {
+		t.Errorf("episodes of a slot are %v apart", got[1].Sub(got[0]))
+	}
+	if got[2].Sub(got[0]) != 24*time.Hour {
+		t.Errorf("slots are %v apart", got[2].Sub(got[0]))
+	}
+}
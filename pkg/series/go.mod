@@ -0,0 +1,3 @@
+module histrio/rssbook/pkg/series
+
+go 1.17
@@ -0,0 +1,113 @@
+package series
+
+import (
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/histrio/rssbook/pkg/rss"
+	"github.com/histrio/rssbook/pkg/utils"
+)
+
+// Volume is a built book taking part in a series
+type Volume struct {
+	Book utils.BookMeta
+	// Dir is a path of the volume directory relative to the series one,
+	// episode files are referred through it
+	Dir string
+}
+
+// nameTags and indexTags are audio tags holding the series name and the
+// volume number, in order of preference
+var (
+	nameTags  = []string{"series", "mvnm", "movementname", "grouping"}
+	indexTags = []string{"series-part", "series_part", "seriespart", "mvin", "movement", "volume"}
+)
+
+// FromTags returns the series name and the volume number found in audio
+// tags. Tag names are expected in lower case.
+func FromTags(tags map[string]string) (string, int) {
+	name := ""
+	for _, tag := range nameTags {
+		if value := strings.TrimSpace(tags[tag]); value != "" {
+			name = value
+			break
+		}
+	}
+	index := 0
+	for _, tag := range indexTags {
+		value := strings.TrimSpace(tags[tag])
+		// Numbers may come as "2/5"
+		if i := strings.Index(value, "/"); i >= 0 {
+			value = value[:i]
+		}
+		if n, err := strconv.Atoi(value); err == nil && n > 0 {
+			index = n
+			break
+		}
+	}
+	return name, index
+}
+
+// Sort orders volumes by their series index. Volumes without an index go
+// last in the given order.
+func Sort(volumes []Volume) {
+	sort.SliceStable(volumes, func(i, j int) bool {
+		a, b := volumes[i].Book.SeriesIndex, volumes[j].Book.SeriesIndex
+		if a == 0 || b == 0 {
+			return b == 0 && a != 0
+		}
+		return a < b
+	})
+}
+
+// Combine makes a single book of the volumes in their series order. Episodes
+// are numbered continuously, every volume is a season and episodes keep the
+// GUIDs of their volumes, so appending a volume leaves the published
+// episodes untouched.
+func Combine(id string, title string, volumes []Volume) utils.BookMeta {
+	ordered := append([]Volume{}, volumes...)
+	Sort(ordered)
+
+	book := utils.BookMeta{ID: id, Title: title, Series: title}
+	pos := 0
+	last := time.Time{}
+	for i, v := range ordered {
+		vol := v.Book
+		if book.Author == "" {
+			book.Author = vol.Author
+		}
+		if !vol.Created.IsZero() && (book.Created.IsZero() || vol.Created.Before(book.Created)) {
+			book.Created = vol.Created
+		}
+		season := vol.SeriesIndex
+		if season == 0 {
+			season = i + 1
+		}
+		for _, ep := range vol.Episodes {
+			pos++
+			combined := ep
+			combined.GUID = rss.EpisodeGUID(vol, ep)
+			combined.Pos = pos
+			combined.Season = season
+			combined.Name = vol.Title + ": " + ep.Name
+			if v.Dir != "" {
+				combined.File = path.Join(v.Dir, ep.File)
+			}
+			if combined.PubDate.IsZero() && !vol.Created.IsZero() {
+				combined.PubDate = vol.Created.Add(time.Duration(ep.Pos) * time.Second)
+			}
+			// Later volumes never come before earlier ones in podcast apps
+			if !combined.PubDate.IsZero() {
+				if !last.IsZero() && !combined.PubDate.After(last) {
+					combined.PubDate = last.Add(time.Second)
+				}
+				last = combined.PubDate
+			}
+			book.Episodes = append(book.Episodes, combined)
+		}
+	}
+	return book
+}
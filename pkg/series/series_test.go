@@ -0,0 +1,86 @@
+package series
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/histrio/rssbook/pkg/rss"
+	"github.com/histrio/rssbook/pkg/utils"
+)
+
+func TestFromTags(t *testing.T) {
+	var tests = []struct {
+		tags  map[string]string
+		name  string
+		index int
+	}{
+		{map[string]string{"series": "Saga", "series-part": "2"}, "Saga", 2},
+		{map[string]string{"grouping": "Saga", "mvin": "3/7"}, "Saga", 3},
+		{map[string]string{"volume": "one", "movement": "4"}, "", 4},
+		{map[string]string{"title": "Book"}, "", 0},
+	}
+	for _, tt := range tests {
+		name, index := FromTags(tt.tags)
+		if name != tt.name || index != tt.index {
+			t.Errorf("FromTags(%v) = %q, %d, want %q, %d", tt.tags, name, index, tt.name, tt.index)
+		}
+	}
+}
+
+func volume(id string, index int, episodes int, created time.Time) Volume {
+	book := utils.BookMeta{ID: id, Title: id, SeriesIndex: index, Created: created}
+	for pos := 1; pos <= episodes; pos++ {
+		book.Episodes = append(book.Episodes, utils.BookEpisode{
+			Pos: pos, Name: fmt.Sprintf("Episode %03d", pos), File: fmt.Sprintf("episode-%03d.mp3", pos),
+		})
+	}
+	return Volume{Book: book, Dir: "../" + id}
+}
+
+func TestCombine(t *testing.T) {
+	day := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	// The second volume was built first
+	first := volume("first", 1, 2, day.Add(24*time.Hour))
+	second := volume("second", 2, 2, day)
+	saga := Combine("saga", "Saga", []Volume{second, first})
+
+	if len(saga.Episodes) != 4 {
+		t.Fatalf("got %d episodes", len(saga.Episodes))
+	}
+	for i, ep := range saga.Episodes {
+		if ep.Pos != i+1 {
+			t.Errorf("episode %d has pos %d", i, ep.Pos)
+		}
+		if i > 0 && !ep.PubDate.After(saga.Episodes[i-1].PubDate) {
+			t.Errorf("episode %d is published at %v before the previous one", ep.Pos, ep.PubDate)
+		}
+	}
+	ep := saga.Episodes[2]
+	if ep.Season != 2 || ep.Name != "second: Episode 001" || ep.File != "../second/episode-001.mp3" {
+		t.Errorf("third episode = %+v", ep)
+	}
+	if ep.GUID != rss.EpisodeGUID(second.Book, second.Book.Episodes[0]) {
+		t.Errorf("GUID = %q", ep.GUID)
+	}
+	if !saga.Created.Equal(day) || saga.Series != "Saga" {
+		t.Errorf("saga = %+v", saga)
+	}
+
+	// Appending a volume keeps published episodes
+	third := volume("third", 0, 1, day.Add(48*time.Hour))
+	appended := Combine("saga", "Saga", []Volume{first, second, third})
+	for i, ep := range saga.Episodes {
+		if appended.Episodes[i].GUID != ep.GUID || !appended.Episodes[i].PubDate.Equal(ep.PubDate) {
+			t.Errorf("episode %d changed: %+v", ep.Pos, appended.Episodes[i])
+		}
+	}
+	if last := appended.Episodes[4]; last.Season != 3 || last.Pos != 5 {
+		t.Errorf("appended episode = %+v", last)
+	}
+
+	feed := rss.Generate(appended)
+	if feed.Channel.ItunesType != "serial" || feed.Channel.Entries[4].ItunesSeason != 3 || feed.Channel.Entries[4].ItunesEpisode != 5 {
+		t.Errorf("feed = %+v", feed.Channel)
+	}
+}
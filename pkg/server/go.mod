@@ -0,0 +1,3 @@
+module histrio/rssbook/pkg/server
+
+go 1.17
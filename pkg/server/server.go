@@ -0,0 +1,371 @@
+package server
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/histrio/rssbook/pkg/access"
+	"github.com/histrio/rssbook/pkg/loggers"
+	"github.com/histrio/rssbook/pkg/manifest"
+	"github.com/histrio/rssbook/pkg/rss"
+	"github.com/histrio/rssbook/pkg/utils"
+)
+
+// Book is a built book directory served by its ID
+type Book struct {
+	ID  string
+	Dir string
+}
+
+// Server hosts feeds and episodes of built books
+type Server struct {
+	// BaseURL is a public URL of the server. Feeds are rewritten to point to
+	// it. If empty it is taken from the request.
+	BaseURL string
+	// TrustProxy takes the scheme of requests from X-Forwarded-Proto. Set it
+	// behind a reverse proxy only, clients can send any header.
+	TrustProxy bool
+	Books      map[string]Book
+
+	// Tokens turn on the private mode: feeds are served to listeners with
+	// active tokens at /<token>/<book>/<book>.xml and episodes are available
+	// by signed expiring URLs only
+	Tokens *access.Store
+	// URLTTL is how long signed episode URLs stay valid
+	URLTTL time.Duration
+	// AccessLog receives a record per request in the private mode, Log
+	// does if it is nil
+	AccessLog *loggers.Logger
+	Log       *loggers.Logger
+}
+
+// DefaultURLTTL keeps signed URLs valid long enough for podcast apps to
+// download episodes they have seen in a feed
+const DefaultURLTTL = 7 * 24 * time.Hour
+
+// isBook tells whether the directory holds a built book and returns its ID
+func isBook(dir string) (string, bool) {
+	if m, err := manifest.Read(dir); err == nil && m.Book.ID != "" {
+		return m.Book.ID, true
+	}
+	id := filepath.Base(dir)
+	if _, err := os.Stat(filepath.Join(dir, id+".xml")); err == nil {
+		return id, true
+	}
+	return "", false
+}
+
+// FindBooks returns books in the directories. A directory is either a book
+// itself or a library of books in its subdirectories.
+func FindBooks(dirs []string) (map[string]Book, error) {
+	books := map[string]Book{}
+	add := func(id string, dir string) error {
+		if other, ok := books[id]; ok {
+			return fmt.Errorf("book %q is found both in %s and %s", id, other.Dir, dir)
+		}
+		books[id] = Book{ID: id, Dir: dir}
+		return nil
+	}
+	for _, dir := range dirs {
+		if id, ok := isBook(dir); ok {
+			if err := add(id, dir); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			sub := filepath.Join(dir, entry.Name())
+			if !entry.IsDir() {
+				continue
+			}
+			if id, ok := isBook(sub); ok {
+				if err := add(id, sub); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	if len(books) == 0 {
+		return nil, fmt.Errorf("no books found in %s", strings.Join(dirs, ", "))
+	}
+	return books, nil
+}
+
+// New makes a server for books found in the directories
+func New(baseURL string, dirs []string) (*Server, error) {
+	books, err := FindBooks(dirs)
+	if err != nil {
+		return nil, err
+	}
+	return &Server{BaseURL: strings.TrimSuffix(baseURL, "/"), Books: books}, nil
+}
+
+// baseURL returns the configured public URL or the one the request came to
+func (s *Server) baseURL(r *http.Request) string {
+	if s.BaseURL != "" {
+		return s.BaseURL
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); s.TrustProxy && (proto == "http" || proto == "https") {
+		scheme = proto
+	}
+	return scheme + "://" + r.Host
+}
+
+func etag(parts ...string) string {
+	hasher := md5.New()
+	for _, part := range parts {
+		hasher.Write([]byte(part))
+	}
+	return `"` + hex.EncodeToString(hasher.Sum(nil)) + `"`
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	p := strings.Trim(path.Clean("/"+r.URL.Path), "/")
+	if s.Tokens != nil {
+		s.servePrivate(w, r, strings.Split(p, "/"))
+		return
+	}
+	if p == "" {
+		s.serveIndex(w, r)
+		return
+	}
+	parts := strings.Split(p, "/")
+	book, ok := s.Books[parts[0]]
+	if !ok || len(parts) != 2 {
+		http.NotFound(w, r)
+		return
+	}
+	s.serveFile(w, r, book, parts[1], "")
+}
+
+// servePrivate serves /<token>/<book>/<file> to token holders and
+// /<book>/<file> by signed URLs
+func (s *Server) servePrivate(w http.ResponseWriter, r *http.Request, parts []string) {
+	rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+	var token access.Token
+	defer func() {
+		s.logAccess(r, parts, token, rec.status)
+	}()
+
+	switch len(parts) {
+	case 3:
+		var ok bool
+		token, ok = s.Tokens.Lookup(parts[0])
+		book, known := s.Books[parts[1]]
+		if !ok || !known {
+			http.NotFound(rec, r)
+			return
+		}
+		s.serveFile(rec, r, book, parts[2], token.Value)
+	case 2:
+		book, known := s.Books[parts[0]]
+		if !known {
+			http.NotFound(rec, r)
+			return
+		}
+		id, err := s.Tokens.Signer().Verify(parts[0]+"/"+parts[1], r.URL.Query(), time.Now())
+		if err != nil {
+			http.Error(rec, err.Error(), http.StatusForbidden)
+			return
+		}
+		var ok bool
+		if token, ok = s.Tokens.LookupID(id); !ok {
+			http.Error(rec, "token is revoked", http.StatusForbidden)
+			return
+		}
+		s.serveFile(rec, r, book, parts[1], token.Value)
+	default:
+		http.NotFound(rec, r)
+	}
+}
+
+// logAccess logs the request by the listener. Tokens are logged by their
+// IDs and cut out of feed paths.
+func (s *Server) logAccess(r *http.Request, parts []string, token access.Token, status int) {
+	log := s.AccessLog
+	if log == nil {
+		log = s.Log
+	}
+	user, tokenID := "-", "-"
+	if token.Value != "" {
+		user = token.User
+		tokenID = s.Tokens.Signer().TokenID(token.Value)
+	}
+	if len(parts) == 3 {
+		parts = append([]string{"-"}, parts[1:]...)
+	}
+	log.Info("Access", "remote", r.RemoteAddr, "method", r.Method, "path", "/"+strings.Join(parts, "/"),
+		"user", user, "token", tokenID, "status", status)
+}
+
+func (s *Server) serveFile(w http.ResponseWriter, r *http.Request, book Book, name string, token string) {
+	filename := filepath.Join(book.Dir, name)
+	f, err := os.Open(filename)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil || fi.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", utils.ContentType(name))
+	if name == book.ID+".xml" {
+		s.serveFeed(w, r, book, filename, fi.ModTime(), token)
+		return
+	}
+	w.Header().Set("ETag", etag(name, fmt.Sprint(fi.Size()), fi.ModTime().String()))
+	http.ServeContent(w, r, name, fi.ModTime(), f)
+}
+
+// serveFeed serves the book's feed with URLs pointing to the server. Feeds
+// requested with a token link to episodes by signed URLs.
+func (s *Server) serveFeed(w http.ResponseWriter, r *http.Request, book Book, filename string, modtime time.Time, token string) {
+	feed, err := rss.ParseFile(filename)
+	if err != nil {
+		s.Log.Error("Broken feed", "book", book.ID, "file", filename, "err", err)
+		http.Error(w, "broken feed", http.StatusInternalServerError)
+		return
+	}
+	base := s.baseURL(r)
+	linkBase := base
+	if token != "" {
+		linkBase += "/" + url.PathEscape(token)
+	}
+	feed.RewriteURLs(func(link string) string {
+		return s.rewrite(book, linkBase, link)
+	})
+	if token != "" {
+		ttl := s.URLTTL
+		if ttl == 0 {
+			ttl = DefaultURLTTL
+		}
+		// Links expire at the same moment for a while, so the feed
+		// stays the same between requests and caches keep working
+		expires := time.Now().Add(ttl).Truncate(time.Hour)
+		signer := s.Tokens.Signer()
+		feed.SignEnclosures(func(link string) string {
+			name, ok := s.fileName(book, link)
+			if !ok {
+				return link
+			}
+			q := signer.Query(book.ID+"/"+name, token, expires)
+			return base + "/" + url.PathEscape(book.ID) + "/" + url.PathEscape(name) + "?" + q.Encode()
+		})
+		// The file time doesn't tell signatures changed, only the ETag
+		// of the content does
+		modtime = time.Time{}
+	}
+	rendered, err := rss.RenderXML(feed)
+	if err != nil {
+		s.Log.Error("Broken feed", "book", book.ID, "file", filename, "err", err)
+		http.Error(w, "broken feed", http.StatusInternalServerError)
+		return
+	}
+	content := []byte(rendered)
+	w.Header().Set("ETag", etag(string(content)))
+	http.ServeContent(w, r, filename, modtime, bytes.NewReader(content))
+}
+
+// fileName returns a name of the book's file the link points to
+func (s *Server) fileName(book Book, link string) (string, bool) {
+	u, err := url.Parse(link)
+	if err != nil || link == "" {
+		return "", false
+	}
+	name := path.Base(u.Path)
+	if name == "/" || name == "." {
+		return "", false
+	}
+	if _, err := os.Stat(filepath.Join(book.Dir, name)); err != nil {
+		return "", false
+	}
+	return name, true
+}
+
+// rewrite points a link to a file of the book to the server. Links to
+// anything else are left as is.
+func (s *Server) rewrite(book Book, base string, link string) string {
+	name, ok := s.fileName(book, link)
+	if !ok {
+		return link
+	}
+	return base + "/" + url.PathEscape(book.ID) + "/" + url.PathEscape(name)
+}
+
+var indexTemplate = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>rssbook</title></head>
+<body>
+<ul>
+{{range .}}<li><a href="{{.URL}}">{{.ID}}</a></li>
+{{end}}</ul>
+</body>
+</html>
+`))
+
+func (s *Server) serveIndex(w http.ResponseWriter, r *http.Request) {
+	type feedLink struct {
+		ID  string
+		URL string
+	}
+	links := []feedLink{}
+	for id := range s.Books {
+		links = append(links, feedLink{ID: id, URL: "/" + url.PathEscape(id) + "/" + url.PathEscape(id+".xml")})
+	}
+	sort.Slice(links, func(i, j int) bool {
+		return links[i].ID < links[j].ID
+	})
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := indexTemplate.Execute(w, links); err != nil {
+		s.Log.Error("Index failed", "err", err)
+	}
+}
+
+// statusRecorder remembers the response status for logging
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// LogRequests logs every request handled by h. Private servers log requests
+// themselves without the tokens in paths.
+func LogRequests(log *loggers.Logger, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		h.ServeHTTP(rec, r)
+		log.Info("Request", "remote", r.RemoteAddr, "method", r.Method, "path", r.URL.Path, "status", rec.status)
+	})
+}
@@ -0,0 +1,227 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/histrio/rssbook/pkg/access"
+	"github.com/histrio/rssbook/pkg/loggers"
+	"github.com/histrio/rssbook/pkg/manifest"
+	"github.com/histrio/rssbook/pkg/rss"
+	"github.com/histrio/rssbook/pkg/utils"
+)
+
+func testLibrary(t *testing.T) string {
+	root := t.TempDir()
+	dir := filepath.Join(root, "book")
+	os.Mkdir(dir, 0777)
+	book := utils.BookMeta{ID: "book", Title: "Book"}
+	book.Episodes = append(book.Episodes, utils.BookEpisode{
+		Pos: 1, Name: "Episode 001", File: "episode-001.mp3", FileSize: 10,
+		Href: utils.S3Url + "book/episode-001.mp3",
+	})
+	os.WriteFile(filepath.Join(dir, "episode-001.mp3"), []byte("0123456789"), 0644)
+	feed, err := rss.GenerateXML(book)
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(dir, "book.xml"), []byte(feed), 0644)
+	if err := (manifest.Manifest{Book: book}).Write(dir); err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+func TestFindBooks(t *testing.T) {
+	root := testLibrary(t)
+	books, err := FindBooks([]string{root})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if books["book"].Dir != filepath.Join(root, "book") {
+		t.Errorf("FindBooks() = %v", books)
+	}
+	if _, err := FindBooks([]string{root, filepath.Join(root, "book")}); err == nil {
+		t.Errorf("FindBooks() accepted the same book twice")
+	}
+	if _, err := FindBooks([]string{t.TempDir()}); err == nil {
+		t.Errorf("FindBooks() found books in an empty directory")
+	}
+}
+
+func TestServeRange(t *testing.T) {
+	srv, err := New("", []string{testLibrary(t)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest("GET", "/book/episode-001.mp3", nil)
+	r.Header.Set("Range", "bytes=2-5")
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, r)
+
+	if w.Code != http.StatusPartialContent {
+		t.Fatalf("status = %d, want %d", w.Code, http.StatusPartialContent)
+	}
+	if got := w.Body.String(); got != "2345" {
+		t.Errorf("body = %q, want %q", got, "2345")
+	}
+	if got := w.Header().Get("Content-Type"); got != "audio/mpeg" {
+		t.Errorf("Content-Type = %q", got)
+	}
+	tag := w.Header().Get("ETag")
+	if tag == "" || w.Header().Get("Last-Modified") == "" {
+		t.Fatalf("no validators in %v", w.Header())
+	}
+
+	r = httptest.NewRequest("GET", "/book/episode-001.mp3", nil)
+	r.Header.Set("If-None-Match", tag)
+	w = httptest.NewRecorder()
+	srv.ServeHTTP(w, r)
+	if w.Code != http.StatusNotModified {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusNotModified)
+	}
+}
+
+func TestServeFeed(t *testing.T) {
+	srv, err := New("https://books.example.com/", []string{testLibrary(t)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, httptest.NewRequest("GET", "/book/book.xml", nil))
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d", w.Code)
+	}
+	feed, err := rss.ParseXML(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := feed.Channel.Entries[0].Enclosure.URL; got != "https://books.example.com/book/episode-001.mp3" {
+		t.Errorf("enclosure = %q", got)
+	}
+	if got := feed.Channel.AtomLink.Href; got != "https://books.example.com/book/book.xml" {
+		t.Errorf("self link = %q", got)
+	}
+	if !strings.HasPrefix(feed.Channel.Image.URL, "https://www.gravatar.com/") {
+		t.Errorf("external image is rewritten: %q", feed.Channel.Image.URL)
+	}
+}
+
+func TestBaseURL(t *testing.T) {
+	r := httptest.NewRequest("GET", "/book/book.xml", nil)
+	r.Header.Set("X-Forwarded-Proto", "https")
+	srv := &Server{}
+	if got := srv.baseURL(r); got != "http://example.com" {
+		t.Errorf("baseURL() = %s, X-Forwarded-Proto of a client is trusted", got)
+	}
+	srv.TrustProxy = true
+	if got := srv.baseURL(r); got != "https://example.com" {
+		t.Errorf("baseURL() behind a proxy = %s", got)
+	}
+	r.Header.Set("X-Forwarded-Proto", "javascript")
+	if got := srv.baseURL(r); got != "http://example.com" {
+		t.Errorf("baseURL() = %s of an unknown scheme", got)
+	}
+}
+
+func TestServeNotFound(t *testing.T) {
+	srv, err := New("", []string{testLibrary(t)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{"/other/other.xml", "/book/missing.mp3", "/book/../book/../../etc/passwd", "/book/a/b"} {
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, httptest.NewRequest("GET", p, nil))
+		if w.Code != http.StatusNotFound {
+			t.Errorf("%s: status = %d, want %d", p, w.Code, http.StatusNotFound)
+		}
+	}
+}
+
+func TestServePrivate(t *testing.T) {
+	srv, err := New("http://books.example.com", []string{testLibrary(t)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv.Tokens, err = access.Open(filepath.Join(t.TempDir(), "tokens.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var accessLog strings.Builder
+	srv.AccessLog = loggers.New(loggers.TextHandler(&accessLog), loggers.LevelInfo)
+	token, _ := srv.Tokens.Add("alice")
+
+	get := func(target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		srv.ServeHTTP(w, httptest.NewRequest("GET", target, nil))
+		return w
+	}
+
+	for _, p := range []string{"/", "/book/book.xml", "/book/episode-001.mp3", "/wrong/book/book.xml"} {
+		if w := get(p); w.Code == http.StatusOK {
+			t.Errorf("%s is served without a token", p)
+		}
+	}
+
+	w := get("/" + token.Value + "/book/book.xml")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d", w.Code)
+	}
+	feed, err := rss.ParseXML(w.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := feed.Channel.AtomLink.Href; got != "http://books.example.com/"+token.Value+"/book/book.xml" {
+		t.Errorf("self link = %q", got)
+	}
+	enclosure := feed.Channel.Entries[0].Enclosure.URL
+	if !strings.HasPrefix(enclosure, "http://books.example.com/book/episode-001.mp3?") {
+		t.Fatalf("enclosure = %q", enclosure)
+	}
+	if strings.Contains(enclosure, token.Value) {
+		t.Errorf("enclosure %q carries the token", enclosure)
+	}
+	// Signed feeds change with expiry, the file time can't validate them
+	if modified := w.Header().Get("Last-Modified"); modified != "" {
+		t.Errorf("signed feed Last-Modified = %q", modified)
+	}
+	r := httptest.NewRequest("GET", "/"+token.Value+"/book/book.xml", nil)
+	r.Header.Set("If-Modified-Since", time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))
+	revalidated := httptest.NewRecorder()
+	srv.ServeHTTP(revalidated, r)
+	if revalidated.Code != http.StatusOK {
+		t.Errorf("signed feed If-Modified-Since: status = %d", revalidated.Code)
+	}
+	r.Header.Set("If-None-Match", w.Header().Get("ETag"))
+	revalidated = httptest.NewRecorder()
+	srv.ServeHTTP(revalidated, r)
+	if revalidated.Code != http.StatusNotModified {
+		t.Errorf("signed feed If-None-Match: status = %d", revalidated.Code)
+	}
+	episode := strings.TrimPrefix(enclosure, "http://books.example.com")
+	if w := get(episode); w.Code != http.StatusOK || w.Body.String() != "0123456789" {
+		t.Errorf("signed episode: status = %d", w.Code)
+	}
+	if w := get(strings.Replace(episode, "episode-001", "episode-002", 1)); w.Code != http.StatusForbidden {
+		t.Errorf("signature is accepted for another file: status = %d", w.Code)
+	}
+	if !strings.Contains(accessLog.String(), "user=alice") || strings.Contains(accessLog.String(), token.Value) {
+		t.Errorf("access log = %q", accessLog.String())
+	}
+	if !strings.Contains(accessLog.String(), "path=/-/book/book.xml") {
+		t.Errorf("access log has no feed request without the token: %q", accessLog.String())
+	}
+
+	srv.Tokens.Revoke("alice")
+	if w := get(episode); w.Code != http.StatusForbidden {
+		t.Errorf("revoked token: status = %d", w.Code)
+	}
+	if w := get("/" + token.Value + "/book/book.xml"); w.Code != http.StatusNotFound {
+		t.Errorf("revoked token: status = %d", w.Code)
+	}
+}
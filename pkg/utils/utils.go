@@ -5,13 +5,15 @@ import (
 	"encoding/hex"
 	"fmt"
 	"io"
-	"log"
+	"mime"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
-	"github.com/histrio/rssbook/pkg/loggers"
+	"github.com/histrio/rssbook/pkg/order"
 )
 
 // S3Url is a root URL for files serving
@@ -23,88 +25,210 @@ type FileSplit struct {
 	To        time.Duration
 }
 
-type AudioMeta struct {
-	Author string
-	Title  string
-}
-
 type Silence struct {
 	Start    time.Duration
 	End      time.Duration
 	Duration time.Duration
 }
 
+// Loudness is measured by the first pass of the ffmpeg loudnorm filter
+type Loudness struct {
+	// Integrated loudness in LUFS
+	Integrated float64 `json:"integrated"`
+	// TruePeak in dBTP
+	TruePeak float64 `json:"truePeak"`
+	// Range is the loudness range in LU
+	Range     float64 `json:"range"`
+	Threshold float64 `json:"threshold"`
+}
+
 type SplitPlan []FileSplit
 type FileName string
 
 type BookMeta struct {
-	ID       string
-	Title    string
-	Author   string
-	Episodes episodesList
+	ID          string       `json:"id"`
+	Title       string       `json:"title"`
+	Author      string       `json:"author"`
+	Series      string       `json:"series,omitempty"`
+	SeriesIndex int          `json:"seriesIndex,omitempty"`
+	Narrator    string       `json:"narrator,omitempty"`
+	Genre       string       `json:"genre,omitempty"`
+	Date        string       `json:"date,omitempty"`
+	Description string       `json:"description,omitempty"`
+	Language    string       `json:"language,omitempty"`
+	Created     time.Time    `json:"created"`
+	Episodes    episodesList `json:"episodes"`
 }
 
 type BookEpisode struct {
-	Name     string
-	Href     string
-	N        string
-	Pos      int
-	File     string
-	FileSize int64
-	Duration time.Duration
+	Name     string        `json:"name"`
+	Href     string        `json:"href"`
+	N        string        `json:"n,omitempty"`
+	Pos      int           `json:"pos"`
+	File     string        `json:"file"`
+	FileSize int64         `json:"fileSize"`
+	Duration time.Duration `json:"duration"`
+	PubDate  time.Time     `json:"pubDate"`
+	// GUID is kept from the original book when episodes are reused, e.g. in
+	// a series feed
+	GUID   string `json:"guid,omitempty"`
+	Season int    `json:"season,omitempty"`
 }
 
 type episodesList []BookEpisode
 
+// FeedURL returns a public URL of the book's feed
+func (b BookMeta) FeedURL() string {
+	return S3Url + b.ID + "/" + b.ID + ".xml"
+}
+
+// ImageSize is a size of the generated book cover
+const ImageSize int = 1400
+
+// ImageURL returns a URL of the generated book cover
+func (b BookMeta) ImageURL() string {
+	return fmt.Sprintf("https://www.gravatar.com/avatar/%s?s=%d&d=retro&r=g", GetMD5Hash(b.FeedURL()), ImageSize)
+}
+
+// ReleasedBy returns the book with episodes published by the moment t only.
+// Episodes without a publication date are considered released.
+func (b BookMeta) ReleasedBy(t time.Time) BookMeta {
+	released := b
+	released.Episodes = nil
+	for _, ep := range b.Episodes {
+		if ep.PubDate.IsZero() || !ep.PubDate.After(t) {
+			released.Episodes = append(released.Episodes, ep)
+		}
+	}
+	return released
+}
+
+// SourceDateEpoch returns the time set by the SOURCE_DATE_EPOCH variable of
+// reproducible builds
+func SourceDateEpoch() (time.Time, bool) {
+	value := os.Getenv("SOURCE_DATE_EPOCH")
+	if value == "" {
+		return time.Time{}, false
+	}
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(seconds, 0).UTC(), true
+}
+
+// Now returns the current time. If SOURCE_DATE_EPOCH is set, it returns that
+// time, so repeated builds give the same output.
+func Now() time.Time {
+	if t, ok := SourceDateEpoch(); ok {
+		return t
+	}
+	return time.Now()
+}
+
 // GetID generate id from args
 func GetID(domain string, link string, date time.Time) string {
 	dateFormatted := fmt.Sprintf("%d-%02d-%02d", date.Year(), date.Month(), date.Day())
 	return fmt.Sprintf("tag:%v,%v:%v", domain, dateFormatted, link)
 }
 
-// GetFiles returns a channel with files in directory. Ordered by names and subfolders included.
-func GetFiles(dir string) chan FileName {
-	c := make(chan FileName)
-	go func() {
+// GetIDDate returns the date of an id generated by GetID
+func GetIDDate(id string) (time.Time, bool) {
+	if !strings.HasPrefix(id, "tag:") {
+		return time.Time{}, false
+	}
+	parts := strings.SplitN(id, ":", 3)
+	if len(parts) < 3 {
+		return time.Time{}, false
+	}
+	comma := strings.LastIndex(parts[1], ",")
+	if comma < 0 {
+		return time.Time{}, false
+	}
+	var year, month, day int
+	if _, err := fmt.Sscanf(parts[1][comma+1:], "%d-%d-%d", &year, &month, &day); err != nil {
+		return time.Time{}, false
+	}
+	return time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC), true
+}
+
+// AudioExtensions are extensions of source audio files in lower case
+var AudioExtensions = []string{".mp3", ".flac", ".ogg", ".opus", ".m4a", ".m4b"}
+
+// IsAudio tells whether the file is a source audio file by its extension in
+// any case
+func IsAudio(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	for _, e := range AudioExtensions {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckBookID tells why the book ID can't name a folder of the book
+func CheckBookID(id string) error {
+	switch {
+	case id == "":
+		return fmt.Errorf("book ID is empty")
+	case strings.ContainsAny(id, `/\`):
+		return fmt.Errorf("book ID %q has a path separator", id)
+	case id == "." || strings.Contains(id, ".."):
+		return fmt.Errorf("book ID %q points out of the folder", id)
+	case strings.HasPrefix(id, "-"):
+		return fmt.Errorf("book ID %q starts with a dash", id)
+	}
+	return nil
+}
 
-		e := filepath.Walk(dir, func(path string, f os.FileInfo, err error) error {
-			ext := filepath.Ext(path)
-			if ext == ".mp3" {
-				log.Println("Processing: " + path)
-				c <- FileName(path)
-			}
+// GetFiles returns audio files in directory. Ordered naturally by names,
+// e.g. 2 goes before 10, and subfolders included.
+func GetFiles(dir string) ([]FileName, error) {
+	paths := []string{}
+	err := filepath.Walk(dir, func(path string, f os.FileInfo, err error) error {
+		if err != nil {
 			return err
-		})
-		Check(e)
-		close(c)
-	}()
-	return c
+		}
+		if IsAudio(path) {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	order.Sort(paths)
+	files := make([]FileName, len(paths))
+	for i, p := range paths {
+		files[i] = FileName(p)
+	}
+	return files, nil
 }
 
 // GetFileSize calculate file's size
-func GetFileSize(fn FileName) int64 {
-	file, err := os.Open(string(fn))
-	Check(err)
-	fi, err := file.Stat()
-	Check(err)
-	return fi.Size()
+func GetFileSize(fn FileName) (int64, error) {
+	fi, err := os.Stat(string(fn))
+	if err != nil {
+		return 0, err
+	}
+	return fi.Size(), nil
 }
 
-// Check checks last error
+// Check checks last error, the program exits on it
 func Check(e error) {
 	if e != nil {
-		log.Fatalf("%s\n", e)
+		fmt.Fprintf(os.Stderr, "%s\n", e)
+		os.Exit(1)
 	}
 }
 
-// SimpleExec executes command with args
+// SimpleExec executes command with args, an error includes the output
 func SimpleExec(name string, arg ...string) (string, error) {
 	cmd := exec.Command(name, arg...)
-	// loggers.Debug.Printf("Executing: `%v`", cmd)
 	output, err := cmd.CombinedOutput()
 	if err != nil {
-		loggers.Error.Println(fmt.Sprint(err) + ": " + string(output))
-		return "", err
+		return "", fmt.Errorf("%s: %s: %s", name, err, strings.TrimSpace(string(output)))
 	}
 	return string(output), nil
 }
@@ -136,6 +260,33 @@ func CopyFile(src FileName, dst string) {
 	Check(err)
 }
 
+// contentTypes are media types of files a built book consists of
+var contentTypes = map[string]string{
+	".mp3":  "audio/mpeg",
+	".m4a":  "audio/mp4",
+	".m4b":  "audio/mp4",
+	".xml":  "application/rss+xml; charset=utf-8",
+	".m3u":  "audio/x-mpegurl",
+	".pls":  "audio/x-scpls",
+	".xspf": "application/xspf+xml",
+	".json": "application/json",
+	".jpg":  "image/jpeg",
+	".jpeg": "image/jpeg",
+	".png":  "image/png",
+}
+
+// ContentType returns a media type of the file by its extension
+func ContentType(name string) string {
+	ext := strings.ToLower(filepath.Ext(name))
+	if t, ok := contentTypes[ext]; ok {
+		return t
+	}
+	if t := mime.TypeByExtension(ext); t != "" {
+		return t
+	}
+	return "application/octet-stream"
+}
+
 // GetMD5Hash calculates md5 for a string
 func GetMD5Hash(text string) string {
 	hasher := md5.New()
@@ -13,10 +13,20 @@ func TestGetFileSize(t *testing.T) {
 	d2 := []byte{115, 111, 109, 101, 10}
 	n2, err := f.Write(d2)
 	Check(err)
-	size := GetFileSize(FileName(filename))
-	if size != int64(n2) {
+	f.Close()
+	size, err := GetFileSize(FileName(filename))
+	if err != nil || size != int64(n2) {
 		t.Errorf("Size not right")
 	}
+	if _, err := GetFileSize("/tmp/missing-dat2"); err == nil {
+		t.Error("size of a missing file")
+	}
+}
+
+func TestGetFiles(t *testing.T) {
+	if _, err := GetFiles("/tmp/missing-rssbook-source"); err == nil {
+		t.Error("files of a missing folder")
+	}
 }
 
 func TestGetID(t *testing.T) {
@@ -41,6 +51,29 @@ func TestGetID(t *testing.T) {
 	}
 }
 
+func TestGetIDDate(t *testing.T) {
+	date := time.Date(2021, 3, 4, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		id     string
+		want   time.Time
+		wantOk bool
+	}{
+		{"generated", GetID("example.com", "test1", date), date, true},
+		{"link with colons", "tag:example.com,2021-03-04:a:b", date, true},
+		{"not a tag", "https://example.com/1", time.Time{}, false},
+		{"no date", "tag:example.com:test", time.Time{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := GetIDDate(tt.id)
+			if ok != tt.wantOk || !got.Equal(tt.want) {
+				t.Errorf("GetIDDate() = %v, %v, want %v, %v", got, ok, tt.want, tt.wantOk)
+			}
+		})
+	}
+}
+
 func TestGetMD5Hash(t *testing.T) {
 	type args struct {
 		text string
@@ -100,3 +133,42 @@ func TestFormatDuration(t *testing.T) {
 		})
 	}
 }
+
+func TestBookMetaReleasedBy(t *testing.T) {
+	now := time.Date(2026, 11, 2, 7, 0, 0, 0, time.UTC)
+	book := BookMeta{ID: "test", Episodes: episodesList{
+		{Pos: 1, PubDate: now.Add(-24 * time.Hour)},
+		{Pos: 2, PubDate: now},
+		{Pos: 3, PubDate: now.Add(24 * time.Hour)},
+		{Pos: 4},
+	}}
+	released := book.ReleasedBy(now)
+	got := []int{}
+	for _, ep := range released.Episodes {
+		got = append(got, ep.Pos)
+	}
+	if len(got) != 3 || got[0] != 1 || got[1] != 2 || got[2] != 4 {
+		t.Errorf("ReleasedBy() episodes = %v, want [1 2 4]", got)
+	}
+	if len(book.Episodes) != 4 {
+		t.Errorf("ReleasedBy() modified the book")
+	}
+}
+
+func TestCheckBookID(t *testing.T) {
+	for id, valid := range map[string]bool{
+		"war-and-peace": true,
+		"saga.vol.1":    true,
+		"":              false,
+		".":             false,
+		"..":            false,
+		"../escape":     false,
+		"a/b":           false,
+		`a\b`:           false,
+		"-name":         false,
+	} {
+		if err := CheckBookID(id); (err == nil) != valid {
+			t.Errorf("CheckBookID(%q) = %v", id, err)
+		}
+	}
+}
@@ -0,0 +1,3 @@
+module histrio/rssbook/pkg/watch
+
+go 1.17
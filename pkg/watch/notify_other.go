@@ -0,0 +1,10 @@
+//go:build !linux
+
+package watch
+
+import "errors"
+
+// newNotifier is not implemented besides Linux, the inbox is polled
+func newNotifier(root string) (notifier, error) {
+	return nil, errors.New("not supported on this platform")
+}
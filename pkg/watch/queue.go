@@ -0,0 +1,133 @@
+package watch
+
+import (
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// Job states
+const (
+	Pending = "pending"
+	Running = "running"
+	Done    = "done"
+	Failed  = "failed"
+)
+
+// Job is a book folder waiting for a build or built already
+type Job struct {
+	Source string `json:"source"`
+	// Signature identifies the folder content the job was added for
+	Signature string    `json:"signature"`
+	State     string    `json:"state"`
+	Added     time.Time `json:"added"`
+	Finished  time.Time `json:"finished"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// Queue keeps jobs in a JSON file, so pending builds survive restarts
+type Queue struct {
+	path string
+	mu   sync.Mutex
+	jobs []Job
+}
+
+// OpenQueue loads the queue, a missing file is an empty queue. Jobs
+// interrupted by a restart are pending again.
+func OpenQueue(path string) (*Queue, error) {
+	q := &Queue{path: path}
+	content, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return q, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(content, &q.jobs); err != nil {
+		return nil, err
+	}
+	for i := range q.jobs {
+		if q.jobs[i].State == Running {
+			q.jobs[i].State = Pending
+		}
+	}
+	return q, nil
+}
+
+func (q *Queue) save() error {
+	content, err := json.MarshalIndent(q.jobs, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := q.path + ".tmp"
+	if err := os.WriteFile(tmp, append(content, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, q.path)
+}
+
+// Jobs returns all jobs in order they were added
+func (q *Queue) Jobs() []Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return append([]Job{}, q.jobs...)
+}
+
+// Known tells whether there is a job for the folder content
+func (q *Queue) Known(source string, signature string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, job := range q.jobs {
+		if job.Source == source && job.Signature == signature {
+			return true
+		}
+	}
+	return false
+}
+
+// Add queues a build of the folder. A pending job of the same folder is
+// replaced.
+func (q *Queue) Add(source string, signature string, now time.Time) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	job := Job{Source: source, Signature: signature, State: Pending, Added: now}
+	for i := range q.jobs {
+		if q.jobs[i].Source == source && q.jobs[i].State == Pending {
+			q.jobs[i] = job
+			return q.save()
+		}
+	}
+	q.jobs = append(q.jobs, job)
+	return q.save()
+}
+
+// Next marks the first pending job as running and returns it
+func (q *Queue) Next() (Job, bool, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i := range q.jobs {
+		if q.jobs[i].State == Pending {
+			q.jobs[i].State = Running
+			return q.jobs[i], true, q.save()
+		}
+	}
+	return Job{}, false, nil
+}
+
+// Finish records the result of the running job of the folder
+func (q *Queue) Finish(source string, buildErr error, now time.Time) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for i := range q.jobs {
+		if q.jobs[i].Source == source && q.jobs[i].State == Running {
+			q.jobs[i].State = Done
+			q.jobs[i].Finished = now
+			if buildErr != nil {
+				q.jobs[i].State = Failed
+				q.jobs[i].Error = buildErr.Error()
+			}
+		}
+	}
+	return q.save()
+}
@@ -0,0 +1,214 @@
+package watch
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/histrio/rssbook/pkg/archive"
+	"github.com/histrio/rssbook/pkg/loggers"
+	"github.com/histrio/rssbook/pkg/utils"
+)
+
+// DefaultSettle is how long a folder stays unchanged before it is built
+const DefaultSettle = 30 * time.Second
+
+// folderState tracks changes of a folder in the inbox
+type folderState struct {
+	signature string
+	changed   time.Time
+}
+
+// Watcher builds book folders and archives dropped into the inbox once they
+// stop changing, and moves built ones to the archive
+type Watcher struct {
+	Inbox   string
+	Archive string
+	// Settle is how long a folder stays unchanged before it is queued
+	Settle time.Duration
+	// Poll is an interval of rescans, changes reported by the file system
+	// trigger them earlier
+	Poll  time.Duration
+	Queue *Queue
+	// Build converts the source folder into a book
+	Build func(source string) error
+	Log   *loggers.Logger
+
+	now     func() time.Time
+	folders map[string]folderState
+}
+
+func (w *Watcher) clock() time.Time {
+	if w.now != nil {
+		return w.now()
+	}
+	return time.Now()
+}
+
+// signature summarizes audio files of the folder, or the archive, it changes
+// while files are being copied. It is empty if there are no audio files.
+func signature(dir string) (string, error) {
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return "", err
+	}
+	if !fi.IsDir() {
+		if fi.Size() == 0 {
+			return "", nil
+		}
+		return fmt.Sprintf("%d:%d", fi.Size(), fi.ModTime().UnixNano()), nil
+	}
+	count := 0
+	size := int64(0)
+	latest := time.Time{}
+	err = filepath.Walk(dir, func(path string, f os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if f.IsDir() {
+			return nil
+		}
+		if f.ModTime().After(latest) {
+			latest = f.ModTime()
+		}
+		if utils.IsAudio(path) {
+			count++
+			size += f.Size()
+		}
+		return nil
+	})
+	if err != nil || count == 0 {
+		return "", err
+	}
+	return fmt.Sprintf("%d:%d:%d", count, size, latest.UnixNano()), nil
+}
+
+// Scan looks through the inbox and queues folders unchanged for the settle
+// time
+func (w *Watcher) Scan() error {
+	if w.folders == nil {
+		w.folders = map[string]folderState{}
+	}
+	entries, err := os.ReadDir(w.Inbox)
+	if err != nil {
+		return err
+	}
+	now := w.clock()
+	present := map[string]bool{}
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), ".") || !e.IsDir() && !archive.Supported(e.Name()) {
+			continue
+		}
+		source := filepath.Join(w.Inbox, e.Name())
+		present[source] = true
+		sig, err := signature(source)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		state, ok := w.folders[source]
+		if !ok || state.signature != sig {
+			w.folders[source] = folderState{signature: sig, changed: now}
+			continue
+		}
+		if sig == "" || now.Sub(state.changed) < w.Settle || w.Queue.Known(source, sig) {
+			continue
+		}
+		w.Log.Info("Queued", "source", source)
+		if err := w.Queue.Add(source, sig, now); err != nil {
+			return err
+		}
+	}
+	for source := range w.folders {
+		if !present[source] {
+			delete(w.folders, source)
+		}
+	}
+	return nil
+}
+
+// archive moves the built source out of the inbox, keeping earlier sources
+// of the same name
+func (w *Watcher) archive(source string) error {
+	if err := os.MkdirAll(w.Archive, 0777); err != nil {
+		return err
+	}
+	dst := filepath.Join(w.Archive, filepath.Base(source))
+	if _, err := os.Stat(dst); err == nil {
+		dst += w.clock().Format("-20060102-150405")
+	}
+	return os.Rename(source, dst)
+}
+
+// RunPending builds queued folders one by one
+func (w *Watcher) RunPending() error {
+	for {
+		job, ok, err := w.Queue.Next()
+		if err != nil || !ok {
+			return err
+		}
+		log := w.Log.With("source", job.Source)
+		log.Info("Building")
+		buildErr := w.Build(job.Source)
+		if buildErr == nil && w.Archive != "" {
+			buildErr = w.archive(job.Source)
+		}
+		if buildErr != nil {
+			log.Error("Build failed", "err", buildErr)
+		} else {
+			log.Info("Built")
+		}
+		if err := w.Queue.Finish(job.Source, buildErr, w.clock()); err != nil {
+			return err
+		}
+	}
+}
+
+// Run watches the inbox until stop is closed. Pending jobs left by a previous
+// run are built first.
+func (w *Watcher) Run(stop <-chan struct{}) error {
+	poll := w.Poll
+	if poll <= 0 {
+		poll = time.Second
+	}
+	ticker := time.NewTicker(poll)
+	defer ticker.Stop()
+
+	var events <-chan struct{}
+	n, err := newNotifier(w.Inbox)
+	if err != nil {
+		w.Log.Warning("No file system notifications, polling", "inbox", w.Inbox, "every", poll, "err", err)
+	} else {
+		defer n.Close()
+		events = n.Events()
+	}
+
+	for {
+		if err := w.RunPending(); err != nil {
+			return err
+		}
+		if err := w.Scan(); err != nil {
+			return err
+		}
+		select {
+		case <-stop:
+			return nil
+		case _, ok := <-events:
+			if !ok {
+				// Notifications broke down, keep polling
+				events = nil
+			}
+		case <-ticker.C:
+		}
+	}
+}
+
+// notifier reports changes in a directory tree
+type notifier interface {
+	Events() <-chan struct{}
+	Close() error
+}
@@ -0,0 +1,165 @@
+package watch
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestQueue(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "queue.json")
+	q, err := OpenQueue(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	q.Add("a", "1", now)
+	q.Add("b", "1", now)
+	q.Add("a", "2", now)
+	if jobs := q.Jobs(); len(jobs) != 2 || jobs[0].Signature != "2" {
+		t.Fatalf("pending job is not replaced: %+v", jobs)
+	}
+	job, ok, err := q.Next()
+	if err != nil || !ok || job.Source != "a" {
+		t.Fatalf("Next() = %+v, %v, %v", job, ok, err)
+	}
+
+	// The running job is interrupted by a restart
+	q, err = OpenQueue(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jobs := q.Jobs(); jobs[0].State != Pending {
+		t.Fatalf("interrupted job = %+v", jobs[0])
+	}
+	q.Next()
+	q.Finish("a", errors.New("broken"), now)
+	q.Next()
+	q.Finish("b", nil, now)
+	if jobs := q.Jobs(); jobs[0].State != Failed || jobs[0].Error != "broken" || jobs[1].State != Done {
+		t.Errorf("jobs = %+v", jobs)
+	}
+	if !q.Known("a", "2") || q.Known("a", "3") {
+		t.Errorf("Known() mismatch")
+	}
+}
+
+func TestWatcher(t *testing.T) {
+	root := t.TempDir()
+	inbox := filepath.Join(root, "inbox")
+	book := filepath.Join(inbox, "book")
+	os.MkdirAll(book, 0777)
+	os.MkdirAll(filepath.Join(inbox, "no-audio"), 0777)
+	os.WriteFile(filepath.Join(book, "01.mp3"), []byte("01"), 0644)
+
+	q, _ := OpenQueue(filepath.Join(root, "queue.json"))
+	now := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	built := []string{}
+	w := &Watcher{
+		Inbox:   inbox,
+		Archive: filepath.Join(root, "archive"),
+		Settle:  10 * time.Second,
+		Queue:   q,
+		Build: func(source string) error {
+			built = append(built, source)
+			return nil
+		},
+		now: func() time.Time { return now },
+	}
+	scan := func(after time.Duration) {
+		now = now.Add(after)
+		if err := w.Scan(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	scan(0)
+	scan(5 * time.Second)
+	// Copying goes on
+	os.WriteFile(filepath.Join(book, "02.mp3"), []byte("02"), 0644)
+	scan(5 * time.Second)
+	if len(q.Jobs()) != 0 {
+		t.Fatalf("changing folder is queued: %+v", q.Jobs())
+	}
+	scan(10 * time.Second)
+	if jobs := q.Jobs(); len(jobs) != 1 || jobs[0].Source != book {
+		t.Fatalf("jobs = %+v", jobs)
+	}
+	scan(10 * time.Second)
+	if len(q.Jobs()) != 1 {
+		t.Errorf("folder is queued twice")
+	}
+
+	if err := w.RunPending(); err != nil {
+		t.Fatal(err)
+	}
+	if len(built) != 1 || q.Jobs()[0].State != Done {
+		t.Errorf("built = %v, jobs = %+v", built, q.Jobs())
+	}
+	if _, err := os.Stat(filepath.Join(root, "archive", "book", "02.mp3")); err != nil {
+		t.Errorf("source is not archived: %s", err)
+	}
+}
+
+func TestWatcherArchives(t *testing.T) {
+	root := t.TempDir()
+	inbox := filepath.Join(root, "inbox")
+	os.MkdirAll(inbox, 0777)
+	saga := filepath.Join(inbox, "saga.zip")
+	os.WriteFile(saga, []byte("PK"), 0644)
+	os.WriteFile(filepath.Join(inbox, "notes.txt"), []byte("notes"), 0644)
+	os.WriteFile(filepath.Join(inbox, "empty.tar"), nil, 0644)
+
+	q, _ := OpenQueue(filepath.Join(root, "queue.json"))
+	now := time.Date(2026, 10, 1, 0, 0, 0, 0, time.UTC)
+	w := &Watcher{
+		Inbox:   inbox,
+		Archive: filepath.Join(root, "archive"),
+		Settle:  10 * time.Second,
+		Queue:   q,
+		Build:   func(source string) error { return nil },
+		now:     func() time.Time { return now },
+	}
+	for _, after := range []time.Duration{0, 20 * time.Second} {
+		now = now.Add(after)
+		if err := w.Scan(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if jobs := q.Jobs(); len(jobs) != 1 || jobs[0].Source != saga {
+		t.Fatalf("jobs = %+v", jobs)
+	}
+	if err := w.RunPending(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "archive", "saga.zip")); err != nil {
+		t.Errorf("archive is not moved: %s", err)
+	}
+}
+
+func TestNotifier(t *testing.T) {
+	root := t.TempDir()
+	n, err := newNotifier(root)
+	if err != nil {
+		t.Skip(err)
+	}
+	defer n.Close()
+	// Files in new subdirectories are watched too
+	os.Mkdir(filepath.Join(root, "book"), 0777)
+	wait := func() {
+		select {
+		case <-n.Events():
+		case <-time.After(5 * time.Second):
+			t.Fatal("no event")
+		}
+	}
+	wait()
+	time.Sleep(50 * time.Millisecond)
+	for len(n.Events()) > 0 {
+		<-n.Events()
+	}
+	os.WriteFile(filepath.Join(root, "book", "01.mp3"), []byte("01"), 0644)
+	wait()
+}